@@ -0,0 +1,454 @@
+package fine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// actionKind identifies how a compiled action must be executed.
+type actionKind uint8
+
+const (
+	kindInvalid actionKind = iota
+	kindNil
+	kindTarget
+	kindFunc
+	kindFuncArgs
+	kindFuncTarget
+	kindFuncArgsTarget
+	kindDispatch
+)
+
+// Dispatch is an action that selects the next state depending on the first
+// argument passed to the action, which is formatted as with fmt.Sprint and
+// looked up among the keys. If no key matches, or no argument is passed, the
+// DispatchDefault entry is used, if present. Otherwise, the state does not
+// change.
+//
+// For example, with the following action, doing "signal" with the "red"
+// argument leads to the "stopped" state.
+//
+//	fine.Dispatch{"red": "stopped", "green": "running"}
+type Dispatch map[string]string
+
+// DispatchDefault is the key of the Dispatch entry used when no other entry
+// matches.
+const DispatchDefault = "@default"
+
+// resolve returns the target selected by the given arguments.
+func (d Dispatch) resolve(args []interface{}) (string, bool) {
+	if len(args) > 0 {
+		if target, ok := d[fmt.Sprint(args[0])]; ok {
+			return target, true
+		}
+	}
+	target, ok := d[DispatchDefault]
+	return target, ok
+}
+
+// Prefixes of the special keys of the transition-scoped hooks, which are
+// executed right before and right after the action named by the rest of key.
+const (
+	beforePrefix = "@before:"
+	afterPrefix  = "@after:"
+)
+
+// action is the precompiled form of a transition value. Actions whose kind is
+// kindTarget or kindNil are resolved without any function call, all the other
+// ones are executed through run.
+type action struct {
+	kind     actionKind
+	target   string
+	dispatch Dispatch
+	run      func(ctx context.Context, args []interface{}) (target string, ok bool, err error)
+
+	// The transition-scoped hooks of the action, if any.
+	before, after hook
+
+	// How to resume the machine embedded in the target, for History and
+	// DeepHistory actions.
+	history historyMode
+
+	// Whether the action is wrapped in Internal.
+	internal bool
+
+	// Whether the action is a Reenter one, so that leading to the current
+	// state exits and enters it again.
+	reenter bool
+
+	// The action attached to the transition, for Transition actions.
+	effect func(Metadata)
+
+	// How long after entering the state the action is done automatically,
+	// for Timeout actions.
+	timeout time.Duration
+}
+
+// hook is the precompiled form of a lifecycle action. It returns the value
+// returned by the lifecycle action, if any.
+type hook func(m *FSM, metadata Metadata) interface{}
+
+// state is the precompiled form of a state and its transitions.
+type state struct {
+	// The original transitions, as given by the user. It must never be
+	// mutated after compilation.
+	transitions Transitions
+
+	actions map[string]action
+	enter   hook
+	exit    hook
+
+	// The events of the Timeout actions, mapped to their durations.
+	timeouts map[string]time.Duration
+
+	// Whether the state is marked as final.
+	final bool
+}
+
+// compileState precompiles the given transitions of the named state. The
+// given map is copied, so later changes to it do not affect the FSM.
+//
+// Invalid action types are not rejected here: they panic when dispatched.
+func compileState(name string, transitions Transitions) *state {
+	s := &state{
+		transitions: make(Transitions, len(transitions)),
+		actions:     make(map[string]action, len(transitions)),
+	}
+	var scoped []string
+	for event, value := range transitions {
+		value = copyValue(value)
+		s.transitions[event] = value
+		switch {
+		case event == "@enter":
+			s.enter = compileHook(name, event, value)
+		case event == "@exit":
+			s.exit = compileHook(name, event, value)
+		case event == Final:
+			s.final, _ = value.(bool)
+		case isScopedHook(event):
+			scoped = append(scoped, event)
+		default:
+			a := compileAction(name, event, value)
+			s.actions[event] = a
+			if a.timeout > 0 {
+				if s.timeouts == nil {
+					s.timeouts = make(map[string]time.Duration)
+				}
+				s.timeouts[event] = a.timeout
+			}
+		}
+	}
+
+	// Attach the transition-scoped hooks to their actions, ignoring the ones
+	// of missing actions.
+	for _, event := range scoped {
+		target := strings.TrimPrefix(event, beforePrefix)
+		target = strings.TrimPrefix(target, afterPrefix)
+		a, ok := s.actions[target]
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(event, beforePrefix) {
+			a.before = compileHook(name, event, s.transitions[event])
+		} else {
+			a.after = compileHook(name, event, s.transitions[event])
+		}
+		s.actions[target] = a
+	}
+	return s
+}
+
+// isScopedHook reports whether the given event is the key of a
+// transition-scoped hook.
+func isScopedHook(event string) bool {
+	return strings.HasPrefix(event, beforePrefix) ||
+		strings.HasPrefix(event, afterPrefix)
+}
+
+// copyValue returns a copy of the given transition value, if it is mutable.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case Dispatch:
+		c := make(Dispatch, len(v))
+		for key, target := range v {
+			c[key] = target
+		}
+		return c
+	case Internal:
+		return Internal{Action: copyValue(v.Action)}
+	case Timeout:
+		return Timeout{After: v.After, Action: copyValue(v.Action)}
+	}
+	return value
+}
+
+// compileAction precompiles the given action value.
+func compileAction(name, event string, value interface{}) action {
+	switch next := value.(type) {
+	case nil:
+		return action{kind: kindNil}
+
+	case string:
+		return action{kind: kindTarget, target: next}
+
+	case History:
+		return action{kind: kindTarget, target: string(next), history: historyShallow}
+
+	case DeepHistory:
+		return action{kind: kindTarget, target: string(next), history: historyDeep}
+
+	case Reenter:
+		return action{kind: kindTarget, target: string(next), reenter: true}
+
+	case Transition:
+		return action{kind: kindTarget, target: next.Target, effect: next.Action}
+
+	case func():
+		return action{kind: kindFunc, run: func(context.Context, []interface{}) (string, bool, error) {
+			next()
+			return "", false, nil
+		}}
+
+	case func(...interface{}):
+		return action{kind: kindFuncArgs, run: func(_ context.Context, args []interface{}) (string, bool, error) {
+			next(args...)
+			return "", false, nil
+		}}
+
+	case func() string:
+		return action{kind: kindFuncTarget, run: func(context.Context, []interface{}) (string, bool, error) {
+			return next(), true, nil
+		}}
+
+	case func(...interface{}) string:
+		return action{kind: kindFuncArgsTarget, run: func(_ context.Context, args []interface{}) (string, bool, error) {
+			return next(args...), true, nil
+		}}
+
+	case func(context.Context):
+		return action{kind: kindFunc, run: func(ctx context.Context, _ []interface{}) (string, bool, error) {
+			next(ctx)
+			return "", false, nil
+		}}
+
+	case func(context.Context, ...interface{}):
+		return action{kind: kindFuncArgs, run: func(ctx context.Context, args []interface{}) (string, bool, error) {
+			next(ctx, args...)
+			return "", false, nil
+		}}
+
+	case func(context.Context) string:
+		return action{kind: kindFuncTarget, run: func(ctx context.Context, _ []interface{}) (string, bool, error) {
+			return next(ctx), true, nil
+		}}
+
+	case func(context.Context, ...interface{}) string:
+		return action{kind: kindFuncArgsTarget, run: func(ctx context.Context, args []interface{}) (string, bool, error) {
+			return next(ctx, args...), true, nil
+		}}
+
+	case func() (string, error):
+		return action{kind: kindFuncTarget, run: func(context.Context, []interface{}) (string, bool, error) {
+			target, err := next()
+			return target, true, err
+		}}
+
+	case func(...interface{}) (string, error):
+		return action{kind: kindFuncArgsTarget, run: func(_ context.Context, args []interface{}) (string, bool, error) {
+			target, err := next(args...)
+			return target, true, err
+		}}
+
+	case func(context.Context) (string, error):
+		return action{kind: kindFuncTarget, run: func(ctx context.Context, _ []interface{}) (string, bool, error) {
+			target, err := next(ctx)
+			return target, true, err
+		}}
+
+	case func(context.Context, ...interface{}) (string, error):
+		return action{kind: kindFuncArgsTarget, run: func(ctx context.Context, args []interface{}) (string, bool, error) {
+			target, err := next(ctx, args...)
+			return target, true, err
+		}}
+
+	case Dispatch:
+		return action{kind: kindDispatch, dispatch: next, run: func(_ context.Context, args []interface{}) (string, bool, error) {
+			target, ok := next.resolve(args)
+			return target, ok, nil
+		}}
+
+	case payloadHandler:
+		return action{kind: kindFuncArgsTarget, run: func(_ context.Context, args []interface{}) (string, bool, error) {
+			return next.handle(event, args)
+		}}
+
+	case Internal:
+		if _, nested := next.Action.(Internal); !nested {
+			a := compileAction(name, event, next.Action)
+			a.internal = true
+			return a
+		}
+
+	case Timeout:
+		if _, nested := next.Action.(Timeout); !nested {
+			a := compileAction(name, event, next.Action)
+			a.timeout = next.After
+			return a
+		}
+	}
+
+	return action{kind: kindInvalid, run: func(context.Context, []interface{}) (string, bool, error) {
+		panic(fmt.Sprintf(
+			"invalid type for action %q on state %q", event, name,
+		))
+	}}
+}
+
+// compileHook precompiles the given lifecycle action value. A nil hook is
+// returned when there is nothing to execute.
+func compileHook(name, event string, value interface{}) hook {
+	switch lifecycle := value.(type) {
+	case nil:
+		return nil
+
+	case func():
+		return func(*FSM, Metadata) interface{} {
+			lifecycle()
+			return nil
+		}
+
+	case func(*FSM):
+		return func(m *FSM, _ Metadata) interface{} {
+			lifecycle(m)
+			return nil
+		}
+
+	case func(Metadata):
+		return func(_ *FSM, metadata Metadata) interface{} {
+			lifecycle(metadata)
+			return nil
+		}
+
+	case func(*FSM, Metadata):
+		return func(m *FSM, metadata Metadata) interface{} {
+			lifecycle(m, metadata)
+			return nil
+		}
+
+	case func() interface{}:
+		return func(*FSM, Metadata) interface{} {
+			return lifecycle()
+		}
+
+	case func(*FSM) interface{}:
+		return func(m *FSM, _ Metadata) interface{} {
+			return lifecycle(m)
+		}
+
+	case func(Metadata) interface{}:
+		return func(_ *FSM, metadata Metadata) interface{} {
+			return lifecycle(metadata)
+		}
+
+	case func(*FSM, Metadata) interface{}:
+		return lifecycle
+
+	case func(context.Context):
+		return func(_ *FSM, metadata Metadata) interface{} {
+			lifecycle(metadata.context())
+			return nil
+		}
+
+	case func(context.Context, *FSM, Metadata):
+		return func(m *FSM, metadata Metadata) interface{} {
+			lifecycle(metadata.context(), m, metadata)
+			return nil
+		}
+
+	case func(context.Context) interface{}:
+		return func(_ *FSM, metadata Metadata) interface{} {
+			return lifecycle(metadata.context())
+		}
+
+	case func(context.Context, *FSM, Metadata) interface{}:
+		return func(m *FSM, metadata Metadata) interface{} {
+			return lifecycle(metadata.context(), m, metadata)
+		}
+
+	default:
+		return func(m *FSM, _ Metadata) interface{} {
+			if m.safeDispatch {
+				m.report(badActionType(event, name))
+				return nil
+			}
+			panic(fmt.Sprintf(
+				"invalid type for action %q on state %q", event, name,
+			))
+		}
+	}
+}
+
+// exec executes the action and returns the resulting state, given the
+// current one, or the error returned by the action, if any. A nil context is
+// passed to the action as context.Background().
+func (a action) exec(ctx context.Context, current string, args []interface{}) (string, error) {
+	switch a.kind {
+	case kindNil:
+		return current, nil
+	case kindTarget:
+		return a.target, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	target, ok, err := a.run(ctx, args)
+	switch {
+	case err != nil:
+		return current, err
+	case ok:
+		return target, nil
+	}
+	return current, nil
+}
+
+// validAction reports whether the given action has one of the allowed types
+// for the given event.
+func validAction(event string, action interface{}) bool {
+	if event == Final {
+		_, ok := action.(bool)
+		return ok
+	}
+	if event == "@enter" || event == "@exit" || isScopedHook(event) {
+		switch action.(type) {
+		case nil, func(), func(*FSM), func(Metadata), func(*FSM, Metadata),
+			func() interface{}, func(*FSM) interface{},
+			func(Metadata) interface{}, func(*FSM, Metadata) interface{},
+			func(context.Context), func(context.Context, *FSM, Metadata),
+			func(context.Context) interface{},
+			func(context.Context, *FSM, Metadata) interface{}:
+			return true
+		}
+		return false
+	}
+	switch next := action.(type) {
+	case nil, string, func(), func(...interface{}),
+		func() string, func(...interface{}) string,
+		func(context.Context), func(context.Context, ...interface{}),
+		func(context.Context) string,
+		func(context.Context, ...interface{}) string,
+		func() (string, error), func(...interface{}) (string, error),
+		func(context.Context) (string, error),
+		func(context.Context, ...interface{}) (string, error), Dispatch,
+		History, DeepHistory, Reenter, Transition, payloadHandler:
+		return true
+	case Internal:
+		_, nested := next.Action.(Internal)
+		return !nested && validAction(event, next.Action)
+	case Timeout:
+		_, nested := next.Action.(Timeout)
+		return !nested && validAction(event, next.Action)
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package fine
+
+import "sync"
+
+// Result is the outcome of an action done asynchronously with DoAsync.
+type Result struct {
+	// The state of the FSM after the action, as returned by Do.
+	State string
+
+	// The error returned by Do, if any.
+	Err error
+}
+
+// DoAsync executes the specified action as with Do, but on a new goroutine, so
+// that the caller does not wait for the action, the lifecycle actions and the
+// notification of the subscribers. The outcome is delivered on the returned
+// channel, which is then closed, so the caller can wait for it later, or
+// simply ignore it.
+//
+// Note: actions done with consecutive calls to DoAsync run concurrently, so
+// their order is not guaranteed.
+func (m *FSM) DoAsync(action string, args ...interface{}) <-chan Result {
+	result := make(chan Result, 1)
+	go func() {
+		defer close(result)
+		state, _, err := m.do(nil, action, args)
+		result <- Result{State: state, Err: err}
+	}()
+	return result
+}
+
+// WithAsyncSubscribers makes the FSM notify the subscribers on a dedicated
+// goroutine, so that a slow subscriber does not stall the transitions: Do
+// queues the notification and returns without waiting for the subscribers,
+// which receive the notifications in the order of the state changes, one at a
+// time and without holding any lock. The goroutine is started when there is
+// something to notify, and it exits once done.
+//
+// By default, instead, the subscribers are called synchronously by Do, still
+// without holding any lock. Only the notifications of the state changes
+// are asynchronous: the first call of a subscriber, when subscribing, is still
+// synchronous. See DoSync for waiting for the notifications.
+func WithAsyncSubscribers() Option {
+	return func(m *FSM) {
+		m.asyncSubscribers = true
+	}
+}
+
+// notification is a state change queued for the subscribers, with the
+// subscribers registered at the time of the change.
+type notification struct {
+	metadata    Metadata
+	subscribers []*subscriber
+}
+
+// mailbox is the queue of the notifications to deliver asynchronously.
+type mailbox struct {
+	mu      sync.Mutex
+	idle    sync.Cond
+	queue   []notification
+	running bool
+}
+
+// post queues the given notification, starting the goroutine delivering them
+// if it is not running.
+func (m *FSM) post(n notification) {
+	b := &m.mailbox
+	b.mu.Lock()
+	b.queue = append(b.queue, n)
+	if !b.running {
+		b.running = true
+		go m.deliver()
+	}
+	b.mu.Unlock()
+}
+
+// deliver delivers the queued notifications in order, until the queue is
+// empty.
+func (m *FSM) deliver() {
+	b := &m.mailbox
+	for {
+		b.mu.Lock()
+		if len(b.queue) == 0 {
+			b.running = false
+			b.idle.Broadcast()
+			b.mu.Unlock()
+			return
+		}
+		n := b.queue[0]
+		b.queue[0] = notification{}
+		b.queue = b.queue[1:]
+		b.mu.Unlock()
+
+		for _, s := range n.subscribers {
+			if m.subscribed(s) && !s.hold(n.metadata) {
+				if err := m.call(s, n.metadata); err != nil {
+					m.report(err)
+				}
+			}
+		}
+	}
+}
+
+// flush waits for the queued notifications to be delivered.
+func (m *FSM) flush() {
+	b := &m.mailbox
+	b.mu.Lock()
+	if b.idle.L == nil {
+		b.idle.L = &b.mu
+	}
+	for b.running {
+		b.idle.Wait()
+	}
+	b.mu.Unlock()
+}
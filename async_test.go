@@ -0,0 +1,85 @@
+package fine_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestDoAsync(t *testing.T) {
+	release := make(chan struct{})
+	machine := fine.Machine("idle", fine.States{
+		"idle": {"start": "running"},
+		"running": {
+			"@enter": func() { <-release },
+		},
+	})
+
+	// Test that DoAsync returns before the lifecycle actions complete.
+	result := machine.DoAsync("start")
+	close(release)
+	r, ok := <-result
+	if !ok || r.Err != nil || r.State != "running" {
+		t.Fatalf("wrong result: got %+v, want state %q", r, "running")
+	}
+
+	// Test that the channel is closed after the result.
+	if _, ok := <-result; ok {
+		t.Fatal("closed channel expected")
+	}
+
+	// Test that errors are delivered too.
+	if r := <-machine.DoAsync("start"); r.Err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+}
+
+func TestAsyncSubscribers(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"next": "c"},
+		"c": {"next": "a"},
+	}, fine.WithAsyncSubscribers())
+
+	release := make(chan struct{})
+	var notified []string
+	machine.Subscribe(func(state string) {
+		if notified != nil {
+			<-release
+		}
+		notified = append(notified, state)
+	})
+
+	// Test that a slow subscriber does not stall the transitions.
+	for i := 0; i < 3; i++ {
+		machine.Do("next")
+	}
+	if state := machine.State(); state != "a" {
+		t.Fatalf("wrong state: got %q, want %q", state, "a")
+	}
+
+	// Test that DoSync waits for the notifications, which are delivered in
+	// order.
+	close(release)
+	machine.DoSync("next")
+	want := []string{"a", "b", "c", "a", "b"}
+	if fmt.Sprint(notified) != fmt.Sprint(want) {
+		t.Fatalf("wrong notifications: got %v, want %v", notified, want)
+	}
+
+	// Concurrency test (run with `-race`).
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unsubscribe := machine.Subscribe(func(string) {})
+			machine.Do("next")
+			unsubscribe()
+		}()
+	}
+	wg.Wait()
+	machine.DoSync("next")
+}
@@ -0,0 +1,106 @@
+package fine
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// lastID is the identifier of the last FSM created.
+var lastID uint64
+
+// Atomic runs fn, which is expected to do actions on the given machines, so
+// that their state changes happen all together or not at all: if fn returns a
+// non-nil error, or panics, every given machine whose state changed is rolled
+// back to the state it had before fn, and the error is returned.
+//
+// Rolling back a machine restores its state directly, without executing any
+// lifecycle action, and notifies its subscribers. Side effects of the actions
+// and lifecycle actions executed by fn are not undone.
+//
+// Atomic holds the transition lock of every given machine, as Do does, for the
+// whole execution of fn, locking the machines in the same order regardless of
+// the order they are given in, so that Atomic calls on machines in common
+// cannot deadlock with each other. The lock is lent to the actions done while
+// fn runs, as described by Do, so they run right away: they are all part of
+// the transaction, including the ones done by other goroutines, and they are
+// rolled back with it. The Do calls that are already waiting for the lock
+// when Atomic takes it, instead, run after Atomic returns.
+func Atomic(fn func() error, machines ...*FSM) (err error) {
+	// Sort the machines by creation order, skipping duplicates, so that
+	// concurrent calls always lock them in the same order.
+	machines = append([]*FSM(nil), machines...)
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].id < machines[j].id
+	})
+	unique := machines[:0]
+	for i, m := range machines {
+		if i == 0 || m != machines[i-1] {
+			unique = append(unique, m)
+		}
+	}
+	machines = unique
+
+	// Lock the machines, and record their states.
+	held := make([]*level, len(machines))
+	saved := make([]string, len(machines))
+	for i, m := range machines {
+		held[i] = m.tmu.lock()
+		saved[i] = m.State()
+	}
+	defer func() {
+		for i := len(machines) - 1; i >= 0; i-- {
+			machines[i].tmu.unlock(held[i])
+		}
+	}()
+
+	// Lend the locks to the actions done while fn runs.
+	for i, m := range machines {
+		m.tmu.lend(held[i])
+	}
+
+	// Roll back if fn fails.
+	committed := false
+	defer func() {
+		if !committed {
+			for i, m := range machines {
+				m.restore(saved[i])
+			}
+		}
+	}()
+
+	if err = fn(); err != nil {
+		return err
+	}
+	committed = true
+
+	return nil
+}
+
+// restore moves the FSM back to the given state, without executing any
+// lifecycle action, and notifies the subscribers if the state changed.
+func (m *FSM) restore(state string) {
+	m.mu.Lock()
+	if m.current == state {
+		m.mu.Unlock()
+		return
+	}
+	metadata := Metadata{From: m.current, To: state, Event: "@rollback"}
+	m.mu.Unlock()
+
+	err := m.writeAhead(metadata)
+	m.mu.Lock()
+	m.commit(metadata)
+	m.mu.Unlock()
+	if err == nil {
+		err = m.writeDone(metadata)
+	}
+	m.reportWAL(err)
+	m.checkInvariants(metadata)
+
+	m.notify(metadata)
+}
+
+// nextID returns a new unique FSM identifier.
+func nextID() uint64 {
+	return atomic.AddUint64(&lastID, 1)
+}
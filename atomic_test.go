@@ -0,0 +1,113 @@
+package fine_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestAtomic(t *testing.T) {
+	newSwitch := func() *fine.FSM {
+		return fine.Machine("off", fine.States{
+			"off": {"toggle": "on"},
+			"on":  {"toggle": "off"},
+		})
+	}
+	a, b := newSwitch(), newSwitch()
+
+	var notified []string
+	a.Subscribe(func(state string) {
+		notified = append(notified, state)
+	})
+
+	// Test that a failing transaction rolls back every machine.
+	failure := errors.New("failure")
+	err := fine.Atomic(func() error {
+		a.Do("toggle")
+		b.Do("toggle")
+		return failure
+	}, a, b)
+	if err != failure {
+		t.Fatalf("wrong error: got %v, want %v", err, failure)
+	}
+	if a.State() != "off" || b.State() != "off" {
+		t.Fatalf("wrong states: got (%q, %q), want (off, off)", a.State(), b.State())
+	}
+	want := []string{"off", "on", "off"}
+	if len(notified) != len(want) {
+		t.Fatalf("wrong notifications: got %v, want %v", notified, want)
+	}
+
+	// Test that a panicking transaction rolls back every machine.
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic expected")
+			}
+		}()
+		fine.Atomic(func() error {
+			a.Do("toggle")
+			panic("failure")
+		}, a, b)
+	}()
+	if a.State() != "off" {
+		t.Fatalf("wrong state: got %q, want %q", a.State(), "off")
+	}
+
+	// Test that a successful transaction commits every machine.
+	err = fine.Atomic(func() error {
+		a.Do("toggle")
+		b.Do("toggle")
+		return nil
+	}, a, b, a)
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if a.State() != "on" || b.State() != "on" {
+		t.Fatalf("wrong states: got (%q, %q), want (on, on)", a.State(), b.State())
+	}
+
+	// Test that the Do calls made while fn runs, even by other goroutines,
+	// are part of the transaction, so that they are rolled back with it.
+	err = fine.Atomic(func() error {
+		done := make(chan string)
+		go func() {
+			state, _ := a.Do("toggle")
+			done <- state
+		}()
+		if state := <-done; state != "off" {
+			t.Errorf("wrong state: got %q, want %q", state, "off")
+		}
+		return failure
+	}, a)
+	if err != failure {
+		t.Fatalf("wrong error: got %v, want %v", err, failure)
+	}
+	if state := a.State(); state != "on" {
+		t.Fatalf("wrong state: got %q, want %q", state, "on")
+	}
+
+	// Concurrency test (run with `-race`): opposite orders must not
+	// deadlock.
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			fine.Atomic(func() error {
+				a.Do("toggle")
+				return nil
+			}, a, b)
+		}()
+		go func() {
+			defer wg.Done()
+			fine.Atomic(func() error {
+				b.Do("toggle")
+				return nil
+			}, b, a)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,64 @@
+package fine
+
+// DoAll does the given events in order, with no arguments, as a single batch,
+// holding the transition lock of the FSM, as Do does, for the whole batch: the
+// Do calls that other goroutines make meanwhile, and any other change such as
+// Undo, Reset, Atomic or Close, wait for the whole batch to complete, so that
+// they cannot interleave with it. It returns the states reached after each
+// event, stopping at the first event that fails, whose error is returned. The
+// events done before it are not rolled back: see DoAllOrRollback.
+//
+// The batch waits for the transitions in progress to complete before
+// starting, including the actions they do from within their lifecycle
+// actions and subscribers. With WithMailbox, it is executed by the owner goroutine, as Do,
+// and with WithRunToCompletion, a batch done while a transition is in progress
+// is queued as a whole, as Do, in which case nil states are returned.
+//
+// Note: doing an action from within a lifecycle action or a subscriber,
+// synchronously, while DoAll is running deadlocks, as the lock is not lent to
+// it, and so does calling DoAll from within them, as it waits for the
+// transition in progress to complete.
+func (m *FSM) DoAll(events ...string) ([]string, error) {
+	_, result, err := m.dispatch(pendingEvent{batch: &batch{events: events}})
+	states, _ := result.([]string)
+	return states, err
+}
+
+// DoAllOrRollback is like DoAll, but if an event fails, the FSM is rolled back
+// to the state it had before the batch, as with Atomic: the state is restored
+// directly, without executing any lifecycle action, and the subscribers are
+// notified. Side effects of the events done before the failing one are not
+// undone.
+func (m *FSM) DoAllOrRollback(events ...string) ([]string, error) {
+	_, result, err := m.dispatch(pendingEvent{batch: &batch{events: events, rollback: true}})
+	states, _ := result.([]string)
+	return states, err
+}
+
+// batch is a batch of events done with DoAll or DoAllOrRollback.
+type batch struct {
+	events   []string
+	rollback bool
+}
+
+// runBatch does the events of the given batch in order, holding the transition
+// lock, stopping at the first one that fails, and rolling back if requested.
+// The result is the states reached after each event.
+func (m *FSM) runBatch(b *batch) (string, interface{}, error) {
+	held := m.tmu.lockOuter()
+	defer m.tmu.unlock(held)
+
+	saved := m.State()
+	states := make([]string, 0, len(b.events))
+	for _, event := range b.events {
+		state, _, err := m.run(pendingEvent{action: event, held: held})
+		if err != nil {
+			if b.rollback {
+				m.restore(saved)
+			}
+			return m.State(), states, err
+		}
+		states = append(states, state)
+	}
+	return m.State(), states, nil
+}
@@ -0,0 +1,198 @@
+package fine_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestDoAll(t *testing.T) {
+	m := fine.Machine("idle", fine.States{
+		"idle":    {"start": "running"},
+		"running": {"pause": "paused", "stop": "idle"},
+		"paused":  {"resume": "running"},
+	})
+
+	// Test that every event is done in order.
+	states, err := m.DoAll("start", "pause", "resume")
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	want := []string{"running", "paused", "running"}
+	if !reflect.DeepEqual(states, want) {
+		t.Fatalf("wrong states: got %v, want %v", states, want)
+	}
+
+	// Test that the batch stops at the first failing event, without rolling
+	// back.
+	states, err = m.DoAll("pause", "stop", "resume")
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	want = []string{"paused"}
+	if !reflect.DeepEqual(states, want) {
+		t.Fatalf("wrong states: got %v, want %v", states, want)
+	}
+	if m.State() != "paused" {
+		t.Fatalf("wrong state: got %q, want %q", m.State(), "paused")
+	}
+
+	// Test that an empty batch does nothing.
+	states, err = m.DoAll()
+	if err != nil || len(states) != 0 {
+		t.Fatalf("wrong result: got (%v, %v), want ([], <nil>)", states, err)
+	}
+}
+
+func TestDoAllOrRollback(t *testing.T) {
+	m := fine.Machine("idle", fine.States{
+		"idle":    {"start": "running"},
+		"running": {"pause": "paused", "stop": "idle"},
+		"paused":  {"resume": "running"},
+	})
+	var notified []string
+	m.Subscribe(func(state string) {
+		notified = append(notified, state)
+	})
+
+	// Test that a failing batch rolls back to the state before it, and
+	// notifies the subscribers.
+	states, err := m.DoAllOrRollback("start", "pause", "stop")
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	want := []string{"running", "paused"}
+	if !reflect.DeepEqual(states, want) {
+		t.Fatalf("wrong states: got %v, want %v", states, want)
+	}
+	if m.State() != "idle" {
+		t.Fatalf("wrong state: got %q, want %q", m.State(), "idle")
+	}
+	want = []string{"idle", "running", "paused", "idle"}
+	if !reflect.DeepEqual(notified, want) {
+		t.Fatalf("wrong notifications: got %v, want %v", notified, want)
+	}
+
+	// Test that a successful batch is kept.
+	if _, err := m.DoAllOrRollback("start", "pause"); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if m.State() != "paused" {
+		t.Fatalf("wrong state: got %q, want %q", m.State(), "paused")
+	}
+}
+
+// Test that a Do done from within another one, by a lifecycle action, does
+// not wait for a pending batch.
+func TestDoAllReentrant(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	m := fine.Machine("a", fine.States{
+		"a": {"go": "b"},
+		"b": {
+			"@enter": func(m *fine.FSM) {
+				close(entered)
+				<-release
+				m.Do("go")
+			},
+			"go": "c",
+		},
+		"c": {"back": "a"},
+	})
+
+	go m.Do("go")
+	<-entered
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.DoAll("back")
+	}()
+	close(release)
+	<-done
+
+	if m.State() != "a" {
+		t.Fatalf("wrong state: got %q, want %q", m.State(), "a")
+	}
+}
+
+// Concurrency test (run with `-race`): test that the Do calls of other
+// goroutines do not interleave with a batch.
+func TestDoAllConcurrent(t *testing.T) {
+	m := fine.Machine("off", fine.States{
+		"off": {"toggle": "on"},
+		"on":  {"toggle": "off"},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			m.Do("toggle")
+		}()
+		go func() {
+			defer wg.Done()
+			states, err := m.DoAll("toggle", "toggle")
+			if err != nil {
+				t.Errorf("no error expected, got: %v", err)
+				return
+			}
+			if states[0] == states[1] {
+				t.Errorf("interleaved batch: got %v", states)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Test that Undo and Reset, from other goroutines, wait for a batch too.
+func TestDoAllExclusive(t *testing.T) {
+	for _, name := range []string{"undo", "reset"} {
+		t.Run(name, func(t *testing.T) {
+			m := fine.Machine("a", fine.States{
+				"a": {"next": "b"},
+				"b": {"next": "c"},
+				"c": {},
+			}, fine.WithUndo(10))
+
+			entered := make(chan struct{})
+			release := make(chan struct{})
+			var once sync.Once
+			m.OnEnter("b", func(fine.Metadata) {
+				once.Do(func() {
+					close(entered)
+					<-release
+				})
+			})
+
+			done := make(chan []string)
+			go func() {
+				states, _ := m.DoAll("next", "next")
+				done <- states
+			}()
+			<-entered
+
+			changed := make(chan struct{})
+			go func() {
+				defer close(changed)
+				if name == "undo" {
+					m.Undo()
+				} else {
+					m.Reset(false)
+				}
+			}()
+			close(release)
+
+			if states := <-done; len(states) != 2 || states[1] != "c" {
+				t.Fatalf("interleaved batch: got %v", states)
+			}
+			<-changed
+			if want := map[string]string{"undo": "b", "reset": "a"}[name]; m.State() != want {
+				t.Fatalf("wrong state: got %q, want %q", m.State(), want)
+			}
+		})
+	}
+}
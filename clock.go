@@ -0,0 +1,99 @@
+package fine
+
+import (
+	"errors"
+	"time"
+)
+
+// Clock is the source of time used by the time-based features of the FSM. It
+// can be replaced with WithClock, for example to test such features without
+// actually waiting, using the Clock of the finetest package.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// AfterFunc waits for the duration to elapse and then calls f in its own
+	// goroutine. It returns a Timer that can be used to cancel the call.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a single scheduled call, created by a Clock.
+type Timer interface {
+	// Stop prevents the Timer from firing. It returns false if the call has
+	// already been made or the Timer has already been stopped.
+	Stop() bool
+}
+
+// realClock is the default Clock, based on the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// WithClock sets the Clock used by the time-based features of the FSM. By
+// default, the real time is used.
+func WithClock(clock Clock) Option {
+	return func(m *FSM) {
+		m.clock = clock
+	}
+}
+
+// scheduled is an event scheduled while in a given state.
+type scheduled struct {
+	key   string
+	timer Timer
+	epoch uint64
+}
+
+// errUnscheduled is returned by step for a scheduled event whose execution has
+// been replaced or cancelled.
+var errUnscheduled = errors.New("the scheduled event has been cancelled")
+
+// schedule arranges for the given event to be done after the given duration,
+// unless the FSM leaves the current state in the meantime. Scheduling again
+// with the same key replaces the previous event. Errors are reported to the
+// hooks registered with OnError. The caller must hold m.mu for writing.
+func (m *FSM) schedule(key string, d time.Duration, e pendingEvent) {
+	if old := m.scheduled[key]; old != nil {
+		old.timer.Stop()
+	}
+
+	s := &scheduled{key: key, epoch: m.epoch}
+	e.scheduled = s
+	s.timer = m.clock.AfterFunc(d, func() {
+		if _, _, err := m.dispatch(e); err != nil && err != errUnscheduled {
+			m.report(err)
+		}
+	})
+	m.scheduled[key] = s
+}
+
+// unschedule removes the given scheduled event, reporting whether it was still
+// to be done: it is not if it has been replaced or cancelled, possibly while
+// its timer was already firing. The caller must hold the transition lock, so
+// that the FSM cannot leave the state in which the event was scheduled until
+// it is done.
+func (m *FSM) unschedule(s *scheduled) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.scheduled[s.key] != s || m.epoch != s.epoch {
+		return false
+	}
+	delete(m.scheduled, s.key)
+	return true
+}
+
+// cancelScheduled cancels all the scheduled calls. The caller must hold m.mu
+// for writing.
+func (m *FSM) cancelScheduled() {
+	for key, s := range m.scheduled {
+		s.timer.Stop()
+		delete(m.scheduled, key)
+	}
+}
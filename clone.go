@@ -0,0 +1,87 @@
+package fine
+
+// Clone returns a new, independent FSM with the same definition as this one:
+// the same states and transitions, including the global ones, the same
+// options, and the same configuration of the states, such as their order,
+// results, and the events they defer, argument schemas and rate limits. The
+// machines embedded in the states are cloned too.
+//
+// The clone starts from the initial state, executing its @enter lifecycle
+// action, as a new FSM created with Machine does. It has no subscribers, and
+// none of the hooks registered on this FSM, such as the ones of OnError and
+// OnLifecycle, since they usually refer to this specific instance.
+func (m *FSM) Clone() *FSM {
+	m.mu.RLock()
+	c := newFSM(m.initial)
+
+	// The precompiled states are never modified, so they can be shared.
+	states := make(stateTable, len(m.table()))
+	for name, s := range m.table() {
+		states[name] = s
+	}
+	c.states.Store(&states)
+	c.global.Store(m.global.Load())
+	if order := m.order.Load(); order != nil {
+		cloned := append([]string(nil), *order...)
+		c.order.Store(&cloned)
+	}
+
+	// Copy the options.
+	c.cow = m.cow
+	c.runToCompletion = m.runToCompletion
+	c.asyncSubscribers = m.asyncSubscribers
+	if m.inbox != nil {
+		c.inbox = newInbox(m.inbox.size)
+	}
+	c.safeDispatch = m.safeDispatch
+	c.recoverHandler = m.recoverHandler
+	c.strictForbid = m.strictForbid
+	c.clock = m.clock
+	c.undoDepth = m.undoDepth
+	c.historyDepth = m.historyDepth
+	c.version = m.version
+	c.logger = m.logger
+	c.tracer = m.tracer
+	if m.coverage != nil {
+		c.coverage = &coverage{counts: make(map[[2]string]int)}
+	}
+	c.migration = m.migration
+
+	// Copy the configuration of the states and of the events.
+	c.forbidden = cloneMap(m.forbidden)
+	c.results = cloneMap(m.results)
+	c.schemas = cloneMap(m.schemas)
+	c.rateLimits = cloneMap(m.rateLimits)
+	for state, events := range m.deferrals {
+		if c.deferrals == nil {
+			c.deferrals = make(map[string]map[string]bool, len(m.deferrals))
+		}
+		c.deferrals[state] = cloneMap(events)
+	}
+	embedded := make(map[string]*embedding, len(m.embedded))
+	for name, e := range m.embedded {
+		embedded[name] = e
+	}
+	m.mu.RUnlock()
+
+	// Embed a clone of every embedded machine, replacing the forwarding
+	// transitions, which refer to the original children.
+	for name, e := range embedded {
+		c.Embed(name, e.child.Clone(), cloneMap(e.forward))
+	}
+
+	c.start()
+	return c
+}
+
+// cloneMap returns a shallow copy of the given map, or nil if it is nil.
+func cloneMap[K comparable, V interface{}](m map[K]V) map[K]V {
+	if m == nil {
+		return nil
+	}
+	c := make(map[K]V, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
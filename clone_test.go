@@ -0,0 +1,92 @@
+package fine_test
+
+import (
+	"sync"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestClone(t *testing.T) {
+	var entered int
+	machine := fine.Machine("off", fine.States{
+		"off": {
+			"@enter": func() { entered++ },
+			"toggle": "on",
+		},
+		"on": {"toggle": "off"},
+	}, fine.WithSafeDispatch())
+	machine.AddGlobal("halt", "off")
+	machine.Do("toggle")
+	var notified []string
+	machine.Subscribe(func(state string) { notified = append(notified, state) })
+	notified = nil
+
+	// Test that the clone starts from the initial state, executing its
+	// @enter lifecycle action.
+	clone := machine.Clone()
+	if state := clone.State(); state != "off" {
+		t.Fatalf("wrong state: got %q, want %q", state, "off")
+	}
+	if entered != 2 {
+		t.Fatalf("wrong number of entries: got %d, want 2", entered)
+	}
+
+	// Test that the clone has the same definition, and it is independent.
+	for _, action := range []string{"toggle", "halt"} {
+		if _, err := clone.Do(action); err != nil {
+			t.Fatalf("no error expected, got: %v", err)
+		}
+	}
+	clone.Add("broken", fine.Transitions{})
+	if machine.Exists("broken") || machine.State() != "on" || len(notified) != 0 {
+		t.Fatal("the original FSM should not be affected by the clone")
+	}
+}
+
+func TestCloneEmbedded(t *testing.T) {
+	child := fine.Machine("idle", fine.States{
+		"idle":    {"run": "running"},
+		"running": {},
+	})
+	parent := fine.Machine("off", fine.States{
+		"off": {"start": "on"},
+	})
+	parent.Embed("on", child, map[string]string{"go": "run"})
+
+	// Test that embedded machines are cloned too.
+	clone := parent.Clone()
+	var notified []string
+	clone.Subscribe(func(state string) { notified = append(notified, state) })
+	clone.Do("start")
+	clone.Do("go")
+	if state := child.State(); state != "idle" {
+		t.Fatalf("wrong state of the original child: got %q, want %q", state, "idle")
+	}
+	if n := len(notified); n == 0 || notified[n-1] != "on.running" {
+		t.Fatalf("wrong notifications: got %v", notified)
+	}
+}
+
+func TestCloneConcurrent(t *testing.T) {
+	machine := fine.Machine("off", fine.States{
+		"off": {"toggle": "on"},
+		"on":  {"toggle": "off"},
+	})
+
+	// Concurrency test (run with `-race`): test that clones can be created
+	// and driven while the original FSM is driven.
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			machine.Do("toggle")
+		}()
+		go func() {
+			defer wg.Done()
+			machine.Clone().Do("toggle")
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,73 @@
+package fine
+
+import "errors"
+
+// ErrClosed is returned by Do when the FSM has been closed.
+var ErrClosed = errors.New("the FSM is closed")
+
+// Close ends the life of the FSM. In order, Close:
+//
+//  1. marks the FSM as closed, so that any following Do returns ErrClosed;
+//  2. cancels everything pending, as CancelPending does, including the
+//     deferred events;
+//  3. executes the @exit lifecycle action of the current state, with "@close"
+//     as the event and an empty destination, and stops any embedded machine;
+//  4. executes the @close hooks registered with OnClose;
+//  5. removes all the subscribers, without notifying them.
+//
+// The current state is left unchanged. Calling Close more than once has no
+// effect after the first call.
+//
+// Note: a Do already in progress when Close is called completes normally, as
+// Close waits for it, as Reset and Undo do.
+func (m *FSM) Close() {
+	held := m.tmu.lock()
+	defer m.tmu.unlock(held)
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	m.cancelScheduled()
+	m.dropDeferred()
+	current := m.current
+	m.mu.Unlock()
+
+	// Nothing can change the state anymore: the actions done from now on,
+	// even from within the @exit lifecycle action, return ErrClosed.
+	m.tmu.lend(held)
+
+	m.doLifecycle("@exit", Metadata{From: current, Event: "@close"})
+	m.stopEmbedded(current)
+
+	m.mu.RLock()
+	hooks := m.closeHooks
+	m.mu.RUnlock()
+	for _, hook := range hooks {
+		hook()
+	}
+
+	m.UnsubscribeAll()
+}
+
+// OnClose registers a machine-level @close hook, executed by Close after the
+// @exit lifecycle action of the current state. It is meant for releasing the
+// resources owned by the FSM. Multiple hooks can be registered, and they run
+// in registration order.
+func (m *FSM) OnClose(hook func()) {
+	m.mu.Lock()
+	m.closeHooks = append(m.closeHooks, hook)
+	m.mu.Unlock()
+}
+
+// CancelPending cancels every execution scheduled for the future, such as the
+// ones requested with DoDebounced, that has not started yet, and discards the
+// deferred events waiting to be replayed.
+func (m *FSM) CancelPending() {
+	m.mu.Lock()
+	m.cancelScheduled()
+	m.dropDeferred()
+	m.mu.Unlock()
+}
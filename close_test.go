@@ -0,0 +1,113 @@
+package fine_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"interrato.dev/fine"
+	"interrato.dev/fine/finetest"
+)
+
+func TestClose(t *testing.T) {
+	clock := finetest.NewClock(time.Unix(0, 0))
+	var calls []string
+	machine := fine.Machine("on", fine.States{
+		"on": {
+			"@exit": func(metadata fine.Metadata) {
+				calls = append(calls, "@exit "+metadata.From+" "+metadata.Event)
+			},
+			"blink":  func() { calls = append(calls, "blink") },
+			"toggle": "off",
+		},
+		"off": {
+			"toggle": "on",
+		},
+	}, fine.WithClock(clock))
+	machine.OnClose(func() {
+		calls = append(calls, "@close")
+	})
+	machine.Subscribe(func(state string) {
+		calls = append(calls, "notify "+state)
+	})
+	machine.DoDebounced(time.Second, "blink")
+
+	// Test the exact teardown sequence.
+	machine.Close()
+	want := []string{"notify on", "@exit on @close", "@close"}
+	if len(calls) != len(want) {
+		t.Fatalf("wrong calls: got %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("wrong calls: got %v, want %v", calls, want)
+		}
+	}
+
+	// Test that the FSM is not usable anymore, and that pending executions
+	// have been cancelled.
+	if _, err := machine.Do("toggle"); !errors.Is(err, fine.ErrClosed) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrClosed)
+	}
+	clock.Advance(time.Minute)
+	if state := machine.State(); state != "on" {
+		t.Fatalf("wrong state: got %q, want %q", state, "on")
+	}
+
+	// Test that closing again has no effect.
+	machine.Close()
+	if len(calls) != len(want) {
+		t.Fatalf("wrong calls: got %v, want %v", calls, want)
+	}
+}
+
+// Test that Close waits for the transition in progress, and that the actions
+// done from the @exit lifecycle action fail.
+func TestCloseInProgress(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var exited string
+	var exitErr error
+	var machine *fine.FSM
+	machine = fine.Machine("a", fine.States{
+		"a": {
+			"next": func() string {
+				close(started)
+				<-release
+				return "b"
+			},
+			"@exit": func(metadata fine.Metadata) {
+				exited += metadata.From + " on " + metadata.Event + ";"
+			},
+		},
+		"b": {
+			"@exit": func(metadata fine.Metadata) {
+				exited += metadata.From + " on " + metadata.Event + ";"
+				_, exitErr = machine.Do("next")
+			},
+			"next": "a",
+		},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		machine.Do("next")
+	}()
+	<-started
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		machine.Close()
+	}()
+	close(release)
+	<-done
+	<-closed
+
+	if want := "a on next;b on @close;"; exited != want {
+		t.Fatalf("wrong exits: got %q, want %q", exited, want)
+	}
+	if !errors.Is(exitErr, fine.ErrClosed) {
+		t.Fatalf("wrong error: got %v, want %v", exitErr, fine.ErrClosed)
+	}
+}
@@ -0,0 +1,49 @@
+package fine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrEmptyExpectedState is returned by CompareAndDo when the expected state is
+// empty.
+var ErrEmptyExpectedState = errors.New("the expected state must not be empty")
+
+// StateConflictError is returned by CompareAndDo when the current state is not
+// the expected one.
+type StateConflictError struct {
+	// The state the FSM was expected to be in.
+	Expected string
+
+	// The state the FSM was actually in.
+	Actual string
+}
+
+func (e *StateConflictError) Error() string {
+	return fmt.Sprintf("state conflict: expected %q, got %q", e.Expected, e.Actual)
+}
+
+// CompareAndDo executes the specified action as Do, but only if the current
+// state is the expected one. Otherwise, nothing is executed, and the current
+// state is returned with a *StateConflictError. ErrEmptyExpectedState is
+// returned, with the current state, and nothing is executed, if the expected
+// state is empty.
+//
+// The comparison happens while holding the transition lock, as described by
+// Do, so the action is never executed from any other state. This closes the
+// race between checking State and calling Do.
+//
+// Note: if the FSM runs to completion, an action queued behind the transition
+// in progress is compared once it is processed, and a conflict is reported to
+// the hooks registered with OnError.
+func (m *FSM) CompareAndDo(expectedState, action string, args ...interface{}) (string, error) {
+	if expectedState == "" {
+		return m.State(), ErrEmptyExpectedState
+	}
+	state, _, err := m.dispatch(pendingEvent{
+		action:   action,
+		args:     args,
+		expected: expectedState,
+	})
+	return state, err
+}
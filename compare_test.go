@@ -0,0 +1,58 @@
+package fine_test
+
+import (
+	"errors"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestCompareAndDo(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"next": "c"},
+		"c": {},
+	})
+
+	// Test that the action is executed from the expected state.
+	if state, err := machine.CompareAndDo("a", "next"); err != nil || state != "b" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "b")
+	}
+
+	// Test that nothing is executed from another state.
+	state, err := machine.CompareAndDo("a", "next")
+	var conflict *fine.StateConflictError
+	if !errors.As(err, &conflict) || conflict.Expected != "a" || conflict.Actual != "b" {
+		t.Fatalf("wrong error: got %v", err)
+	}
+	if state != "b" || machine.State() != "b" {
+		t.Fatalf("wrong state: got %q, want %q", machine.State(), "b")
+	}
+
+	// Test that the other errors are the ones of Do.
+	if _, err := machine.CompareAndDo("b", "missing"); err == nil || errors.As(err, &conflict) {
+		t.Fatalf("wrong error: got %v", err)
+	}
+
+	// Test that an empty expected state is rejected without executing
+	// anything.
+	state, err = machine.CompareAndDo("", "next")
+	if !errors.Is(err, fine.ErrEmptyExpectedState) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrEmptyExpectedState)
+	}
+	if state != "b" || machine.State() != "b" {
+		t.Fatalf("wrong state: got %q (%q), want %q", state, machine.State(), "b")
+	}
+
+	// Test that the comparison also works through the mailbox.
+	machine = fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {},
+	}, fine.WithMailbox(1))
+	if _, err := machine.CompareAndDo("b", "next"); !errors.As(err, &conflict) {
+		t.Fatalf("wrong error: got %v", err)
+	}
+	if state, err := machine.CompareAndDo("a", "next"); err != nil || state != "b" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "b")
+	}
+}
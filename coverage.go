@@ -0,0 +1,89 @@
+package fine
+
+import (
+	"sort"
+	"sync"
+)
+
+// CoverageEntry is the number of times an event fired from a state, as
+// returned by Coverage.
+type CoverageEntry struct {
+	State string
+	Event string
+	Count int
+}
+
+// coverage counts the events fired from every state.
+type coverage struct {
+	mu     sync.Mutex
+	counts map[[2]string]int
+}
+
+// WithCoverage makes the FSM count how many times each event fires from each
+// state, so that Coverage can tell which transitions were exercised, for
+// example by a test suite. An event fires when its action is executed
+// successfully, even if the state does not change.
+func WithCoverage() Option {
+	return func(m *FSM) {
+		m.coverage = &coverage{counts: make(map[[2]string]int)}
+	}
+}
+
+// Coverage returns, for every event of every state of the transition table,
+// including the global ones and the UnknownEvent actions, how many times it
+// fired, as counted when enabled with WithCoverage, or nil otherwise. The
+// entries are sorted as the edges of Table, and the events that fired without
+// being in the table anymore, such as the ones of removed states, follow in
+// alphabetical order.
+func (m *FSM) Coverage() []CoverageEntry {
+	if m.coverage == nil {
+		return nil
+	}
+	m.coverage.mu.Lock()
+	counts := make(map[[2]string]int, len(m.coverage.counts))
+	for pair, count := range m.coverage.counts {
+		counts[pair] = count
+	}
+	m.coverage.mu.Unlock()
+
+	// The branches of Dispatch actions share their entry.
+	var entries []CoverageEntry
+	for _, e := range m.describe().edges {
+		pair := [2]string{e.from, e.event}
+		if n := len(entries); n > 0 && entries[n-1].State == e.from && entries[n-1].Event == e.event {
+			continue
+		}
+		entries = append(entries, CoverageEntry{State: e.from, Event: e.event, Count: counts[pair]})
+		delete(counts, pair)
+	}
+
+	remaining := make([]CoverageEntry, 0, len(counts))
+	for pair, count := range counts {
+		remaining = append(remaining, CoverageEntry{State: pair[0], Event: pair[1], Count: count})
+	}
+	sort.Slice(remaining, func(i, j int) bool {
+		a, b := remaining[i], remaining[j]
+		if a.State != b.State {
+			return a.State < b.State
+		}
+		return a.Event < b.Event
+	})
+	return append(entries, remaining...)
+}
+
+// cover counts the given event as fired from the given state, if enabled. The
+// events handled by an UnknownEvent action are counted as UnknownEvent.
+func (m *FSM) cover(state, event string) {
+	if m.coverage == nil {
+		return
+	}
+	m.mu.RLock()
+	if _, ok := lookup(m.table()[state], m.global.Load(), event); !ok {
+		event = UnknownEvent
+	}
+	m.mu.RUnlock()
+
+	m.coverage.mu.Lock()
+	m.coverage.counts[[2]string{state, event}]++
+	m.coverage.mu.Unlock()
+}
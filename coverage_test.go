@@ -0,0 +1,40 @@
+package fine_test
+
+import (
+	"fmt"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestCoverage(t *testing.T) {
+	machine := fine.Machine("off", fine.States{
+		"off": {"toggle": "on", "check": nil, fine.UnknownEvent: func() {}},
+		"on":  {"toggle": "off", "signal": fine.Dispatch{"red": "off", "green": "on"}},
+	}, fine.WithCoverage())
+
+	// Test that every pair of the table is listed, with the number of
+	// times it fired, including the self-transitions and the fallbacks.
+	machine.Do("check")
+	machine.Do("toggle")
+	machine.Do("toggle")
+	machine.Do("check")
+	machine.Do("missing")
+	machine.Do("toggle")
+	machine.Do("missing")
+	want := []fine.CoverageEntry{
+		{State: "off", Event: fine.UnknownEvent, Count: 1},
+		{State: "off", Event: "check", Count: 2},
+		{State: "off", Event: "toggle", Count: 2},
+		{State: "on", Event: "signal", Count: 0},
+		{State: "on", Event: "toggle", Count: 1},
+	}
+	if got := machine.Coverage(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("wrong coverage:\ngot  %v\nwant %v", got, want)
+	}
+
+	// Test that the coverage is not counted by default.
+	if got := fine.Machine("a", fine.States{"a": {}}).Coverage(); got != nil {
+		t.Fatalf("no coverage expected, got: %v", got)
+	}
+}
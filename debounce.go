@@ -0,0 +1,19 @@
+package fine
+
+import "time"
+
+// DoDebounced schedules the execution of the specified action, as with Do,
+// after the given time window. If the same action is requested again within
+// the window, the pending execution is replaced by the new one, with its own
+// arguments, and the window starts over. Thus, only the last request of a
+// burst is actually executed.
+//
+// A pending execution is cancelled if the FSM leaves the state in which it was
+// requested, even if its window elapsed while the transition leaving it was in
+// progress, and a replaced one is never executed. Since there is no caller to
+// return them to, errors are reported to the hooks registered with OnError.
+func (m *FSM) DoDebounced(window time.Duration, action string, args ...interface{}) {
+	m.mu.Lock()
+	m.schedule("debounce "+action, window, pendingEvent{action: action, args: args})
+	m.mu.Unlock()
+}
@@ -0,0 +1,104 @@
+package fine_test
+
+import (
+	"testing"
+	"time"
+
+	"interrato.dev/fine"
+	"interrato.dev/fine/finetest"
+)
+
+func TestDoDebounced(t *testing.T) {
+	clock := finetest.NewClock(time.Unix(0, 0))
+	var received []interface{}
+	machine := fine.Machine("idle", fine.States{
+		"idle": {
+			"sense": func(args ...interface{}) {
+				received = append(received, args[0])
+			},
+			"sleep": "asleep",
+		},
+		"asleep": {
+			"wake": "idle",
+		},
+	}, fine.WithClock(clock))
+
+	// Test that only the last request of a burst is executed, after the
+	// window has elapsed since that request.
+	machine.DoDebounced(10*time.Millisecond, "sense", 1)
+	clock.Advance(5 * time.Millisecond)
+	machine.DoDebounced(10*time.Millisecond, "sense", 2)
+	clock.Advance(5 * time.Millisecond)
+	if len(received) != 0 {
+		t.Fatalf("no execution expected, got: %v", received)
+	}
+	clock.Advance(5 * time.Millisecond)
+	if len(received) != 1 || received[0] != 2 {
+		t.Fatalf("wrong executions: got %v, want [2]", received)
+	}
+	clock.Advance(time.Second)
+	if len(received) != 1 {
+		t.Fatalf("wrong executions: got %v, want [2]", received)
+	}
+
+	// Test that leaving the state cancels the pending execution.
+	machine.DoDebounced(10*time.Millisecond, "sense", 3)
+	machine.Do("sleep")
+	machine.Do("wake")
+	clock.Advance(time.Second)
+	if len(received) != 1 {
+		t.Fatalf("wrong executions: got %v, want [2]", received)
+	}
+}
+
+func TestDoDebouncedRace(t *testing.T) {
+	clock := finetest.NewClock(time.Unix(0, 0))
+	var received []interface{}
+	var fired chan struct{}
+	fire := func() {
+		// Fire the pending execution while the transition is in progress.
+		fired = make(chan struct{})
+		go func() {
+			defer close(fired)
+			clock.Advance(time.Second)
+		}()
+		time.Sleep(time.Millisecond)
+	}
+	var machine *fine.FSM
+	machine = fine.Machine("idle", fine.States{
+		"idle": {
+			"sense": func(args ...interface{}) {
+				received = append(received, args[0])
+			},
+			"resense": func() {
+				fire()
+				machine.DoDebounced(time.Second, "sense", 2)
+			},
+			"sleep": func() string {
+				fire()
+				return "asleep"
+			},
+		},
+		"asleep": {
+			"sense": "idle",
+		},
+	}, fine.WithClock(clock))
+
+	// Test that a pending execution replaced while firing is dropped.
+	machine.DoDebounced(time.Second, "sense", 1)
+	machine.Do("resense")
+	<-fired
+	clock.Advance(time.Second)
+	if len(received) != 1 || received[0] != 2 {
+		t.Fatalf("wrong executions: got %v, want [2]", received)
+	}
+
+	// Test that a pending execution cancelled while firing, by leaving the
+	// state, is dropped.
+	machine.DoDebounced(time.Second, "sense", 3)
+	machine.Do("sleep")
+	<-fired
+	if state := machine.State(); state != "asleep" || len(received) != 1 {
+		t.Fatalf("wrong state: got %q after %v, want %q", state, received, "asleep")
+	}
+}
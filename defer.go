@@ -0,0 +1,116 @@
+package fine
+
+import "context"
+
+// Defer declares that the given state defers the given events: doing any of
+// them while in that state does not execute anything, and Do returns the
+// current state with a nil error. Instead, the event is queued, with its
+// arguments and context, and replayed automatically as soon as the FSM
+// reaches a state that handles it, and does not defer it, after a successful
+// Do. Deferred events are replayed in the order they were done, and the
+// errors they cause are reported to the hooks registered with OnError.
+//
+// Deferral takes precedence over any transition of the state for the same
+// event, which CheckDeterministic reports as an ambiguity.
+func (m *FSM) Defer(state string, events ...string) {
+	m.mu.Lock()
+	if m.deferrals == nil {
+		m.deferrals = make(map[string]map[string]bool)
+	}
+	if m.deferrals[state] == nil {
+		m.deferrals[state] = make(map[string]bool, len(events))
+	}
+	for _, event := range events {
+		m.deferrals[state][event] = true
+	}
+	m.mu.Unlock()
+}
+
+// Deferred returns the events that are deferred and waiting to be replayed, in
+// the order they will be replayed.
+func (m *FSM) Deferred() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := make([]string, len(m.deferred))
+	for i, e := range m.deferred {
+		events[i] = e.action
+	}
+	return events
+}
+
+// pendingEvent is an event waiting to be done, such as one deferred by a
+// state.
+type pendingEvent struct {
+	ctx    context.Context
+	action string
+	args   []interface{}
+
+	// The state the FSM must be in, if not empty. See CompareAndDo.
+	expected string
+
+	// Whether the event is dropped if a transition is in progress. See
+	// TryDo.
+	try bool
+
+	// The scheduling of the event, if it was scheduled, which is dropped if
+	// it has been cancelled meanwhile.
+	scheduled *scheduled
+
+	// The batch of events to do instead, if any. See DoAll.
+	batch *batch
+
+	// The level of the transition lock held by the caller for the event, if
+	// any, which is not lent. See DoAll.
+	held *level
+}
+
+// enqueueDeferred queues the given deferred event.
+func (m *FSM) enqueueDeferred(e pendingEvent) {
+	m.mu.Lock()
+	m.deferred = append(m.deferred, e)
+	m.queued.Store(int32(len(m.deferred)))
+	m.mu.Unlock()
+}
+
+// replayDeferred replays the deferred events that the current state handles,
+// until there are none left. The level of the transition lock held by the
+// caller, if any, is held for them too.
+func (m *FSM) replayDeferred(held *level) {
+	for m.queued.Load() > 0 {
+		m.mu.Lock()
+		e, ok := m.nextDeferred()
+		m.mu.Unlock()
+		if !ok {
+			return
+		}
+		e.held = held
+		if _, _, err := m.step(e); err != nil {
+			m.report(err)
+		}
+	}
+}
+
+// nextDeferred removes and returns the first deferred event that the current
+// state handles and does not defer. The caller must hold m.mu for writing.
+func (m *FSM) nextDeferred() (pendingEvent, bool) {
+	s, global := m.table()[m.current], m.global.Load()
+	for i, e := range m.deferred {
+		if m.deferrals[m.current][e.action] {
+			continue
+		}
+		if _, ok := resolve(s, global, e.action); ok {
+			m.deferred = append(m.deferred[:i:i], m.deferred[i+1:]...)
+			m.queued.Store(int32(len(m.deferred)))
+			return e, true
+		}
+	}
+	return pendingEvent{}, false
+}
+
+// dropDeferred discards all the deferred events. The caller must hold m.mu for
+// writing.
+func (m *FSM) dropDeferred() {
+	m.deferred = nil
+	m.queued.Store(0)
+}
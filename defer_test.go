@@ -0,0 +1,77 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestDefer(t *testing.T) {
+	var printed []interface{}
+	machine := fine.Machine("booting", fine.States{
+		"booting": {"ready": "idle"},
+		"busy":    {"done": "idle"},
+		"idle": {
+			"print": func(args ...interface{}) string {
+				printed = append(printed, args[0])
+				return "busy"
+			},
+		},
+	})
+	machine.Defer("booting", "print")
+	machine.Defer("busy", "print")
+
+	// Test that deferred events are queued.
+	for _, doc := range []string{"a", "b"} {
+		if state, err := machine.Do("print", doc); err != nil || state != "booting" {
+			t.Fatalf("wrong state: got %q (%v), want %q", state, err, "booting")
+		}
+	}
+	if deferred := machine.Deferred(); len(deferred) != 2 || len(printed) != 0 {
+		t.Fatalf("wrong deferred events: got %v, printed %v", deferred, printed)
+	}
+
+	// Test that deferred events are replayed in order, one for each time a
+	// state handling them is reached.
+	machine.Do("ready")
+	if len(printed) != 1 || printed[0] != "a" || machine.State() != "busy" {
+		t.Fatalf("wrong replay: printed %v, state %q", printed, machine.State())
+	}
+	machine.Do("done")
+	if len(printed) != 2 || printed[1] != "b" || machine.State() != "busy" {
+		t.Fatalf("wrong replay: printed %v, state %q", printed, machine.State())
+	}
+	if deferred := machine.Deferred(); len(deferred) != 0 {
+		t.Fatalf("no deferred events expected, got: %v", deferred)
+	}
+
+	// Test that CancelPending discards the deferred events.
+	machine.Do("print", "c")
+	machine.CancelPending()
+	machine.Do("done")
+	if len(printed) != 2 || machine.State() != "idle" {
+		t.Fatalf("wrong replay: printed %v, state %q", printed, machine.State())
+	}
+}
+
+func TestDeferAmbiguous(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"x": "b"},
+		"b": {},
+	})
+	machine.Defer("a", "x")
+
+	// Test that deferring a handled event is reported as ambiguous.
+	if errs := machine.CheckDeterministic(); len(errs) != 1 {
+		t.Fatalf("wrong errors: got %v, want 1 error", errs)
+	}
+	if e := machine.Explain("x"); e.Mechanism != "deferral" {
+		t.Fatalf("wrong explanation: got %+v", e)
+	}
+	// Test that deferring a global event is not, as the deferral wins.
+	machine.Defer("b", "y")
+	machine.AddGlobal("y", "a")
+	if errs := machine.CheckDeterministic(); len(errs) != 1 {
+		t.Fatalf("wrong errors: got %v, want 1 error", errs)
+	}
+}
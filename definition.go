@@ -0,0 +1,152 @@
+package fine
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Definition is an immutable set of states and transitions, validated once,
+// from which any number of independent FSM instances can be created with
+// NewInstance. All the instances share the same precompiled states, so that
+// creating one, for example for every order, session or device, costs very
+// little time and memory.
+//
+// An instance can still be changed, for example with Add or AddOrMerge: its
+// first change makes it stop sharing the states, without affecting the
+// Definition nor the other instances.
+type Definition struct {
+	states stateTable
+	opts   []Option
+}
+
+// Define validates and precompiles the given states, returning a Definition
+// whose instances are configured with the given options. A non-nil error is
+// returned if any action has an invalid type, or if any static target, such
+// as the one of a string action, is not among the given states.
+func Define(states States, opts ...Option) (*Definition, error) {
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	compiled := make(stateTable, len(states))
+	for _, name := range names {
+		if err := checkActions(name, states[name]); err != nil {
+			return nil, err
+		}
+		compiled[name] = compileState(name, states[name])
+	}
+
+	// Check that every static target exists, in a deterministic order.
+	var edges []edge
+	for _, name := range names {
+		edges = appendEdges(edges, name, compiled[name].actions, nil)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		a, b := edges[i], edges[j]
+		if a.from != b.from {
+			return a.from < b.from
+		}
+		return a.event < b.event
+	})
+	for _, e := range edges {
+		if _, ok := compiled[e.to]; !e.dynamic && !ok {
+			return nil, fmt.Errorf(
+				"action %q on state %q leads to the missing state %q",
+				e.event, e.from, e.to,
+			)
+		}
+	}
+
+	return &Definition{states: compiled, opts: opts}, nil
+}
+
+// States returns a slice with all the states of the Definition, sorted
+// alphabetically.
+func (d *Definition) States() []string {
+	states := make([]string, 0, len(d.states))
+	for name := range d.states {
+		states = append(states, name)
+	}
+	sort.Strings(states)
+	return states
+}
+
+// DeadEnds returns, sorted alphabetically, the states that cannot be left:
+// the ones whose transitions, if any, all lead back to the state itself.
+// Final states are not dead ends, since they are not meant to be left.
+//
+// Note: since the targets of function actions are not known statically, they
+// are assumed to leave the state.
+func (d *Definition) DeadEnds() []string {
+	leaving := make(map[string]bool, len(d.states))
+	for _, e := range d.describe().edges {
+		if e.dynamic || e.to != e.from {
+			leaving[e.from] = true
+		}
+	}
+
+	var deadEnds []string
+	for _, name := range d.States() {
+		if !leaving[name] && !d.states[name].final {
+			deadEnds = append(deadEnds, name)
+		}
+	}
+	return deadEnds
+}
+
+// Unreachable returns, sorted alphabetically, the states that are not
+// reachable from the given one by doing any sequence of actions, which is
+// usually the initial state. If the given state does not exist, nil is
+// returned.
+//
+// Note: as for the ReachableFrom method of FSM, only string, nil and Dispatch
+// actions are followed, so some states that are actually reachable through
+// function actions may be reported.
+func (d *Definition) Unreachable(from string) []string {
+	if _, ok := d.states[from]; !ok {
+		return nil
+	}
+	reachable := d.describe().reachable(from)
+
+	var unreachable []string
+	for _, name := range d.States() {
+		if !reachable[name] {
+			unreachable = append(unreachable, name)
+		}
+	}
+	return unreachable
+}
+
+// describe takes a snapshot of the structure of the Definition, with no
+// initial nor current state.
+func (d *Definition) describe() description {
+	return describe("", "", d.states, nil, func(a, b string) bool { return a < b })
+}
+
+// NewInstance instantiates a new FSM from the Definition, with the given
+// initial state, as Machine does.
+//
+// Note: the given initial state must be within the states of the Definition.
+func (d *Definition) NewInstance(initialState string) *FSM {
+	if _, ok := d.states[initialState]; !ok {
+		panic("the initial state must exist")
+	}
+
+	m := d.instance(initialState)
+	m.start()
+	return m
+}
+
+// instance returns a new FSM from the Definition, in the given state, without
+// starting it.
+func (d *Definition) instance(state string) *FSM {
+	m := newFSM(state)
+	m.states.Store(&d.states)
+	m.shared = true
+	for _, opt := range d.opts {
+		opt(m)
+	}
+	return m
+}
@@ -0,0 +1,112 @@
+package fine_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestDefine(t *testing.T) {
+	// Test that invalid definitions are rejected.
+	for _, states := range []fine.States{
+		{"a": {"bad": 42}},
+		{"a": {"next": "missing"}},
+		{"a": {"signal": fine.Dispatch{"go": "missing"}}},
+	} {
+		if _, err := fine.Define(states); err == nil {
+			t.Fatalf("error expected for %v, got <nil>", states)
+		}
+	}
+	if _, err := fine.Define(fine.States{"a": {"bad": 42}}); !errors.Is(err, fine.ErrBadActionType) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrBadActionType)
+	}
+
+	def, err := fine.Define(fine.States{
+		"off": {"toggle": "on"},
+		"on":  {"toggle": "off", "compute": func() string { return "off" }},
+	}, fine.WithSafeDispatch())
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if states := def.States(); len(states) != 2 || states[0] != "off" {
+		t.Fatalf("wrong states: got %v", states)
+	}
+
+	// Test that instances are independent.
+	a, b := def.NewInstance("off"), def.NewInstance("on")
+	a.Do("toggle")
+	if a.State() != "on" || b.State() != "on" {
+		t.Fatalf("wrong states: got %q and %q, want %q", a.State(), b.State(), "on")
+	}
+	b.Do("toggle")
+	if a.State() != "on" || b.State() != "off" {
+		t.Fatalf("wrong states: got %q and %q", a.State(), b.State())
+	}
+
+	// Test that changing an instance affects neither the other instances,
+	// nor the definition.
+	a.Add("broken", fine.Transitions{})
+	a.AddOrMerge("on", fine.Transitions{"toggle": "broken"})
+	if b.Exists("broken") || len(def.States()) != 2 {
+		t.Fatal("the change should only affect its instance")
+	}
+	if state, _ := def.NewInstance("on").Do("toggle"); state != "off" {
+		t.Fatalf("wrong state: got %q, want %q", state, "off")
+	}
+}
+
+func TestDefinitionAnalysis(t *testing.T) {
+	def, err := fine.Define(fine.States{
+		"draft":     {"submit": "review", "save": nil},
+		"review":    {"approve": "published", "reject": fine.Dispatch{"fix": "draft", "drop": "trash"}},
+		"published": {"@final": true},
+		"trash":     {"touch": "trash"},
+		"imported":  {"check": func() string { return "review" }},
+		"legacy":    {},
+	})
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+
+	// Test that the states that cannot be left are dead ends, except the
+	// final ones.
+	if got := def.DeadEnds(); strings.Join(got, " ") != "legacy trash" {
+		t.Fatalf("wrong dead ends: got %v, want [legacy trash]", got)
+	}
+
+	// Test that the states not reachable from the given one are reported.
+	if got := def.Unreachable("draft"); strings.Join(got, " ") != "imported legacy" {
+		t.Fatalf("wrong unreachable states: got %v, want [imported legacy]", got)
+	}
+	if got := def.Unreachable("trash"); len(got) != 5 {
+		t.Fatalf("wrong unreachable states: got %v", got)
+	}
+	if got := def.Unreachable("missing"); got != nil {
+		t.Fatalf("no states expected, got: %v", got)
+	}
+}
+
+func TestDefineConcurrent(t *testing.T) {
+	def, _ := fine.Define(fine.States{
+		"off": {"toggle": "on"},
+		"on":  {"toggle": "off"},
+	})
+
+	// Concurrency test (run with `-race`): test that instances can be
+	// created, driven and changed concurrently.
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m := def.NewInstance("off")
+			m.Do("toggle")
+			m.AddOrMerge("on", fine.Transitions{"reset": "off"})
+			m.Do("reset")
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,412 @@
+package fine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MachineFromDOT instantiates a new FSM from a directed graph in the DOT
+// language, with the given initial state. Every node is a state, and every
+// edge is a string transition whose event is the edge label, so that the
+// output of ExportDOT can be read back. As done by ExportDOT, the edges whose
+// label has the form "event [key]" make up a Dispatch action, dashed edges
+// and the node standing for the unknown targets of function actions are
+// ignored, and all the other attributes are ignored too.
+//
+// Since DOT cannot carry functions, the resulting FSM only has string
+// transitions: it is meant as a skeleton, that can be completed in code with
+// AddOrMerge, for example with lifecycle actions.
+//
+// A non-nil error is returned if the source cannot be parsed, if an edge has
+// no label, if the same event leads to different states, or if the initial
+// state is not among the nodes. Subgraphs, ports, and undirected graphs are
+// not supported.
+func MachineFromDOT(src string, initial string) (*FSM, error) {
+	p := &dotParser{lexer: dotLexer{src: src, line: 1}, states: make(States)}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	if _, ok := p.states[initial]; !ok {
+		return nil, fmt.Errorf("the initial state %q is not in the graph", initial)
+	}
+
+	return Machine(initial, p.states), nil
+}
+
+// dotToken is a token of the DOT language. Identifiers, including the
+// keywords, have the id kind, while the other tokens are their own kind.
+type dotToken struct {
+	kind   string
+	text   string
+	quoted bool
+	line   int
+}
+
+// dotLexer splits a DOT source into tokens.
+type dotLexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+// next returns the next token, whose kind is empty at the end of the source.
+func (l *dotLexer) next() (dotToken, error) {
+	if err := l.skip(); err != nil {
+		return dotToken{}, err
+	}
+	if l.pos >= len(l.src) {
+		return dotToken{line: l.line}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case strings.ContainsRune("{}[];,=", rune(c)):
+		l.pos++
+		return dotToken{kind: string(c), text: string(c), line: l.line}, nil
+	case strings.HasPrefix(l.src[l.pos:], "->"), strings.HasPrefix(l.src[l.pos:], "--"):
+		l.pos += 2
+		return dotToken{kind: l.src[l.pos-2 : l.pos], line: l.line}, nil
+	case c == '"':
+		return l.quoted()
+	case isDOTIDChar(c):
+		start := l.pos
+		for l.pos < len(l.src) && isDOTIDChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return dotToken{kind: "id", text: l.src[start:l.pos], line: l.line}, nil
+	}
+	return dotToken{}, fmt.Errorf("line %d: unexpected character %q", l.line, c)
+}
+
+// skip skips the spaces and the comments.
+func (l *dotLexer) skip() error {
+	atLineStart := l.pos == 0
+	for l.pos < len(l.src) {
+		rest := l.src[l.pos:]
+		switch {
+		case rest[0] == '\n':
+			l.line++
+			l.pos++
+			atLineStart = true
+			continue
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\r':
+			l.pos++
+			continue
+		case strings.HasPrefix(rest, "//"), atLineStart && rest[0] == '#':
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			l.pos += end
+			continue
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest, "*/")
+			if end < 0 {
+				return fmt.Errorf("line %d: unterminated comment", l.line)
+			}
+			l.line += strings.Count(rest[:end], "\n")
+			l.pos += end + 2
+			continue
+		}
+		return nil
+	}
+	return nil
+}
+
+// quoted reads a quoted identifier.
+func (l *dotLexer) quoted() (dotToken, error) {
+	line := l.line
+	var b strings.Builder
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		c := l.src[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return dotToken{kind: "id", text: b.String(), quoted: true, line: line}, nil
+		case c == '\\' && l.pos+1 < len(l.src):
+			l.pos++
+			switch next := l.src[l.pos]; next {
+			case '"', '\\':
+				b.WriteByte(next)
+			case '\n':
+				// An escaped newline continues the string.
+				l.line++
+			default:
+				b.WriteByte(c)
+				b.WriteByte(next)
+			}
+		default:
+			if c == '\n' {
+				l.line++
+			}
+			b.WriteByte(c)
+		}
+	}
+	return dotToken{}, fmt.Errorf("line %d: unterminated string", line)
+}
+
+// isDOTIDChar reports whether the given byte can be part of an unquoted
+// identifier.
+func isDOTIDChar(c byte) bool {
+	return c == '_' || c == '.' || c >= 0x80 ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// dotParser builds the states described by a DOT source.
+type dotParser struct {
+	lexer  dotLexer
+	tok    dotToken
+	states States
+}
+
+// advance moves to the next token.
+func (p *dotParser) advance() error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+// expect checks that the current token has the given kind, and moves past it.
+func (p *dotParser) expect(kind string) error {
+	if p.tok.kind != kind {
+		return p.unexpected(fmt.Sprintf("%q", kind))
+	}
+	return p.advance()
+}
+
+// unexpected returns the error for an unexpected token.
+func (p *dotParser) unexpected(want string) error {
+	got := fmt.Sprintf("%q", p.tok.kind)
+	switch {
+	case p.tok.kind == "":
+		got = "end of input"
+	case p.tok.kind == "id":
+		got = fmt.Sprintf("%q", p.tok.text)
+	}
+	return fmt.Errorf("line %d: expected %s, got %s", p.tok.line, want, got)
+}
+
+// keyword reports whether the current token is the given keyword, which is
+// case-insensitive.
+func (p *dotParser) keyword(kw string) bool {
+	return p.tok.kind == "id" && !p.tok.quoted && strings.EqualFold(p.tok.text, kw)
+}
+
+// parse parses the whole graph.
+func (p *dotParser) parse() error {
+	if err := p.advance(); err != nil {
+		return err
+	}
+	if p.keyword("strict") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+	if p.keyword("graph") {
+		return fmt.Errorf("line %d: undirected graphs are not supported", p.tok.line)
+	}
+	if !p.keyword("digraph") {
+		return p.unexpected(`"digraph"`)
+	}
+	if err := p.advance(); err != nil {
+		return err
+	}
+	if p.tok.kind == "id" {
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for p.tok.kind != "}" {
+		if err := p.statement(); err != nil {
+			return err
+		}
+	}
+	if err := p.advance(); err != nil {
+		return err
+	}
+	if p.tok.kind != "" {
+		return p.unexpected("end of input")
+	}
+	return nil
+}
+
+// statement parses a single statement.
+func (p *dotParser) statement() error {
+	switch {
+	case p.tok.kind == ";":
+		return p.advance()
+	case p.keyword("subgraph") || p.tok.kind == "{":
+		return fmt.Errorf("line %d: subgraphs are not supported", p.tok.line)
+	case p.keyword("graph") || p.keyword("node") || p.keyword("edge"):
+		// Default attributes are ignored.
+		if err := p.advance(); err != nil {
+			return err
+		}
+		_, err := p.attributes()
+		return err
+	case p.tok.kind != "id":
+		return p.unexpected("a statement")
+	}
+
+	id := p.tok
+	if err := p.advance(); err != nil {
+		return err
+	}
+	switch p.tok.kind {
+	case "=":
+		// Graph attributes are ignored.
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if p.tok.kind != "id" {
+			return p.unexpected("an identifier")
+		}
+		return p.advance()
+	case "--":
+		return fmt.Errorf("line %d: undirected edges are not supported", p.tok.line)
+	case "->":
+		return p.edges(id)
+	}
+
+	// A node statement.
+	if _, err := p.attributes(); err != nil {
+		return err
+	}
+	if id.text != dynamicNode {
+		p.node(id.text)
+	}
+	return nil
+}
+
+// edges parses an edge statement, whose first node is given.
+func (p *dotParser) edges(first dotToken) error {
+	nodes := []string{first.text}
+	for p.tok.kind == "->" {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if p.tok.kind != "id" {
+			return p.unexpected("a node")
+		}
+		nodes = append(nodes, p.tok.text)
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+	attrs, err := p.attributes()
+	if err != nil {
+		return err
+	}
+	label, ok := attrs["label"]
+	if !ok {
+		return fmt.Errorf(
+			"line %d: the edge from %q to %q has no label",
+			first.line, nodes[0], nodes[1],
+		)
+	}
+
+	for i := 0; i+1 < len(nodes); i++ {
+		from, to := nodes[i], nodes[i+1]
+		if from == dynamicNode {
+			continue
+		}
+		p.node(from)
+		if to == dynamicNode || attrs["style"] == "dashed" {
+			continue
+		}
+		p.node(to)
+		if err := p.transition(from, label, to); err != nil {
+			return fmt.Errorf("line %d: %w", first.line, err)
+		}
+	}
+	return nil
+}
+
+// transition adds the transition described by an edge label.
+func (p *dotParser) transition(from, label, to string) error {
+	transitions := p.states[from]
+	if event := strings.SplitN(label, " [", 2)[0]; event == "@enter" || event == "@exit" || event == Final || isScopedHook(event) {
+		return fmt.Errorf("the lifecycle action %q cannot be an edge", event)
+	}
+
+	// Labels in the form "event [key]" are Dispatch entries.
+	if open := strings.LastIndex(label, " ["); open > 0 && strings.HasSuffix(label, "]") {
+		event, key := label[:open], label[open+2:len(label)-1]
+		dispatch, ok := transitions[event].(Dispatch)
+		if _, exists := transitions[event]; exists && !ok {
+			return fmt.Errorf("event %q on state %q is not a dispatch", event, from)
+		}
+		if dispatch == nil {
+			dispatch = make(Dispatch)
+			transitions[event] = dispatch
+		}
+		if target, exists := dispatch[key]; exists && target != to {
+			return fmt.Errorf(
+				"event %q on state %q with key %q leads to both %q and %q",
+				event, from, key, target, to,
+			)
+		}
+		dispatch[key] = to
+		return nil
+	}
+
+	if target, exists := transitions[label]; exists && target != to {
+		return fmt.Errorf(
+			"event %q on state %q leads to both %v and %q",
+			label, from, target, to,
+		)
+	}
+	transitions[label] = to
+	return nil
+}
+
+// node adds a state, if not present yet.
+func (p *dotParser) node(name string) {
+	if _, ok := p.states[name]; !ok {
+		p.states[name] = make(Transitions)
+	}
+}
+
+// attributes parses any number of attribute lists.
+func (p *dotParser) attributes() (map[string]string, error) {
+	attrs := make(map[string]string)
+	for p.tok.kind == "[" {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		for p.tok.kind != "]" {
+			if p.tok.kind != "id" {
+				return nil, p.unexpected("an attribute")
+			}
+			key := p.tok.text
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			if p.tok.kind != "id" {
+				return nil, p.unexpected("an attribute value")
+			}
+			attrs[key] = p.tok.text
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if p.tok.kind == "," || p.tok.kind == ";" {
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	return attrs, nil
+}
@@ -0,0 +1,82 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestMachineFromDOT(t *testing.T) {
+	// Test that the output of ExportDOT is read back, apart from function
+	// actions.
+	machine, err := fine.MachineFromDOT(newExportMachine().ExportDOT(), "locked")
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	want := `digraph fsm {
+	"broken";
+	"locked" [style=filled];
+	"storage";
+	"unlocked";
+	"broken" -> "locked" [label="fix"];
+	"locked" -> "unlocked" [label="pay"];
+	"locked" -> "locked" [label="push"];
+	"storage" -> "locked" [label="deploy [@default]"];
+	"storage" -> "unlocked" [label="deploy [fast]"];
+	"unlocked" -> "unlocked" [label="pay"];
+	"unlocked" -> "locked" [label="push"];
+}
+`
+	if got := machine.ExportDOT(); got != want {
+		t.Fatalf("wrong DOT:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Test that a hand-written graph is understood.
+	machine, err = fine.MachineFromDOT(`
+		// A light switch.
+		strict digraph "switch" {
+			rankdir = LR
+			node [shape=circle]
+			off; on
+			broken [color=red] /* never left */
+			off -> on [label=toggle]
+			on -> off [label = "toggle", color = blue]
+			on -> broken -> broken [label="break"];
+		}`, "off")
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	for _, tc := range []struct {
+		action, want string
+	}{
+		{"toggle", "on"},
+		{"toggle", "off"},
+		{"toggle", "on"},
+		{"break", "broken"},
+		{"break", "broken"},
+	} {
+		if state, err := machine.Do(tc.action); err != nil || state != tc.want {
+			t.Fatalf("wrong state: got %q (%v), want %q", state, err, tc.want)
+		}
+	}
+}
+
+func TestMachineFromDOTInvalid(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`graph { a -- b [label=x] }`,
+		`digraph { a -> b }`,
+		`digraph { a -> b [label=x]; a -> c [label=x] }`,
+		`digraph { a -> b [label="@enter"] }`,
+		`digraph { a -> b [label="x] }`,
+		`digraph { subgraph s { a } }`,
+		`digraph { a -> b [label=x] } extra`,
+		`digraph { a -> b [label=x]`,
+		`digraph { a:p -> b [label=x] }`,
+		`digraph { b -> c [label=x] }`,
+	} {
+		if _, err := fine.MachineFromDOT(src, "a"); err == nil {
+			t.Fatalf("error expected for %q, got <nil>", src)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package fine
+
+import "context"
+
+// embedding describes a child FSM embedded in a state of its parent.
+type embedding struct {
+	child   *FSM
+	forward map[string]string
+
+	// The function that stops surfacing the child state changes, or nil if
+	// the child is not running.
+	stop func()
+}
+
+// Embed composes the child FSM as a sub-machine of the named state of the
+// parent FSM. If the parent has no state with the given name, it is added.
+//
+// The forward mapping associates events of the parent to events of the child:
+// while the parent is in the named state, doing one of the mapped events on
+// the parent does the associated event on the child, passing the same
+// arguments and context. Forwarding never changes the state of the parent, and
+// the error of the child, if any, is returned by the Do of the parent, as the
+// one of a function action, so that the parent transition is aborted.
+//
+// The child runs only while the parent is in the named state. When the parent
+// enters that state, right before its @enter lifecycle action, the child is
+// restarted from its initial state, executing the child lifecycle actions if
+// it was elsewhere, unless the state is entered through a History or
+// DeepHistory target. From then on, every state change of the child is notified
+// to the parent subscribers using the namespaced name "name.substate". When
+// the parent exits the named state, right after its @exit lifecycle action,
+// the child stops being notified to the parent subscribers, but it keeps its
+// current state.
+//
+// Note: a child can be embedded in at most one state at a time, and it should
+// not be driven directly while embedded.
+func (m *FSM) Embed(name string, child *FSM, forward map[string]string) {
+	// Add the forwarding transitions to the parent state.
+	transitions := make(Transitions, len(forward))
+	for parentEvent, childEvent := range forward {
+		childEvent := childEvent
+		transitions[parentEvent] = func(ctx context.Context, args ...interface{}) (string, error) {
+			_, err := child.DoContext(ctx, childEvent, args...)
+			return m.State(), err
+		}
+	}
+	m.AddOrMerge(name, transitions)
+
+	// Register the child, replacing any previously embedded one.
+	m.stopEmbedded(name)
+	m.mu.Lock()
+	m.embedded[name] = &embedding{child: child, forward: forward}
+	running := m.current == name
+	m.mu.Unlock()
+
+	// Start the child immediately if the parent is already in the state.
+	if running {
+		m.startEmbedded(name, historyNone)
+	}
+}
+
+// startEmbedded restarts the child embedded in the given state, if any, and
+// starts surfacing its state changes. Depending on the history mode, the
+// child restarts from its initial state, or it resumes its current state.
+func (m *FSM) startEmbedded(name string, history historyMode) {
+	m.mu.RLock()
+	e := m.embedded[name]
+	m.mu.RUnlock()
+	if e == nil {
+		return
+	}
+
+	// Restart the child from its initial state, or resume it. With shallow
+	// history, only the child resumes, while its own embedded machines are
+	// restarted.
+	child := e.child
+	child.mu.RLock()
+	from, initial := child.current, child.initial
+	child.mu.RUnlock()
+	switch {
+	case history == historyShallow:
+		child.stopEmbedded(from)
+		child.startEmbedded(from, historyNone)
+	case history == historyNone && from != initial:
+		child.transition(Metadata{
+			From:  from,
+			To:    initial,
+			Event: "@start",
+		}, nil)
+	}
+
+	// Surface the child state changes to the parent subscribers. The child
+	// subscription immediately receives the current state of the child, which
+	// is not a change, so it is skipped.
+	subscribing := true
+	unsubscribe := child.SubscribeMeta(func(metadata Metadata) {
+		if subscribing {
+			subscribing = false
+			return
+		}
+		metadata.To = name + "." + metadata.To
+		if metadata.From != "" {
+			metadata.From = name + "." + metadata.From
+		}
+		m.notify(metadata)
+	})
+
+	m.mu.Lock()
+	e.stop = unsubscribe
+	m.mu.Unlock()
+}
+
+// stopEmbedded stops surfacing the state changes of the child embedded in the
+// given state, if any.
+func (m *FSM) stopEmbedded(name string) {
+	m.mu.Lock()
+	var stop func()
+	if e := m.embedded[name]; e != nil {
+		stop, e.stop = e.stop, nil
+	}
+	m.mu.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+}
@@ -0,0 +1,72 @@
+package fine_test
+
+import (
+	"errors"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestEmbed(t *testing.T) {
+	led := fine.Machine("off", fine.States{
+		"off": {"toggle": "on"},
+		"on":  {"toggle": "off"},
+	})
+	panel := fine.Machine("idle", fine.States{
+		"idle":   {"activate": "active"},
+		"active": {"deactivate": "idle"},
+	})
+	panel.Embed("active", led, map[string]string{"press": "toggle"})
+
+	var history []string
+	unsubscribe := panel.Subscribe(func(state string) {
+		history = append(history, state)
+	})
+	defer unsubscribe()
+
+	// Test that forwarded events are only accepted in the embedding state.
+	if _, err := panel.Do("press"); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+
+	// Test that forwarded events drive the child, and that its state changes
+	// surface to the parent subscribers, while the parent stays put.
+	panel.Do("activate")
+	if state, _ := panel.Do("press"); state != "active" {
+		t.Fatalf("wrong state: got %q, want %q", state, "active")
+	}
+	if state := led.State(); state != "on" {
+		t.Fatalf("wrong child state: got %q, want %q", state, "on")
+	}
+
+	// Test that the child stops surfacing after the parent exits the state,
+	// and that it is restarted when the parent enters the state again.
+	panel.Do("deactivate")
+	led.Do("toggle")
+	led.Do("toggle")
+	panel.Do("activate")
+	if state := led.State(); state != "off" {
+		t.Fatalf("wrong child state: got %q, want %q", state, "off")
+	}
+	panel.Do("press")
+
+	want := []string{"idle", "active", "active.on", "idle", "active", "active.on"}
+	if len(history) != len(want) {
+		t.Fatalf("wrong notifications: got %v, want %v", history, want)
+	}
+	for i := range want {
+		if history[i] != want[i] {
+			t.Fatalf("wrong notifications: got %v, want %v", history, want)
+		}
+	}
+	// Test that the errors of the child are returned by the parent, which
+	// stays put.
+	led.Close()
+	state, err := panel.Do("press")
+	if !errors.Is(err, fine.ErrClosed) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrClosed)
+	}
+	if state != "active" {
+		t.Fatalf("wrong state: got %q, want %q", state, "active")
+	}
+}
@@ -0,0 +1,137 @@
+package fine
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LogEntry is a state change of an FSM, as appended to an EventLog.
+type LogEntry struct {
+	From  string        `json:"from"`
+	To    string        `json:"to"`
+	Event string        `json:"event"`
+	Args  []interface{} `json:"args,omitempty"`
+	Time  time.Time     `json:"time"`
+}
+
+// EventLog is an append-only log of the state changes of an FSM, from which
+// Replay can rebuild it. See WithEventLog.
+type EventLog interface {
+	// Append appends the given entry to the log.
+	Append(entry LogEntry) error
+
+	// Entries returns all the entries of the log, from the oldest to the
+	// newest.
+	Entries() ([]LogEntry, error)
+}
+
+// MemoryLog is an EventLog keeping its entries in memory. Its zero value is
+// an empty log, ready to use.
+type MemoryLog struct {
+	mu      sync.Mutex
+	entries []LogEntry
+}
+
+// Append appends the given entry to the log. It never fails.
+func (l *MemoryLog) Append(entry LogEntry) error {
+	l.mu.Lock()
+	l.entries = append(l.entries, entry)
+	l.mu.Unlock()
+	return nil
+}
+
+// Entries returns a copy of the entries of the log. It never fails.
+func (l *MemoryLog) Entries() ([]LogEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]LogEntry(nil), l.entries...), nil
+}
+
+// WithEventLog makes the FSM append every state change to the given log, in
+// the order they happen, including the internal transitions and the ones of
+// Reset, Undo and of the rollbacks of Atomic, which have their own
+// pseudo-events. The entries are appended while holding the lock of the FSM,
+// so the log should be fast; the errors it returns are reported to the hooks
+// registered with OnError, asynchronously.
+//
+// Clones do not inherit the log, since their entries would be interleaved
+// with the ones of this FSM.
+func WithEventLog(log EventLog) Option {
+	return func(m *FSM) {
+		m.eventLog = log
+	}
+}
+
+// appendLog appends the given transition to the event log, if any. The caller
+// must hold m.mu for writing.
+func (m *FSM) appendLog(metadata Metadata) {
+	if m.eventLog == nil {
+		return
+	}
+	err := m.eventLog.Append(LogEntry{
+		From:  metadata.From,
+		To:    metadata.To,
+		Event: metadata.Event,
+		Args:  metadata.Args,
+		Time:  m.clock.Now(),
+	})
+	if err != nil {
+		go m.report(fmt.Errorf("appending %q to the event log: %w", metadata.Event, err))
+	}
+}
+
+// Replay instantiates a new FSM from the given Definition, rebuilding its state
+// from the given log, as written by an FSM of the same Definition created with
+// WithEventLog. The FSM starts from the state the first entry leaves, and
+// re-applies every entry in order, without executing any action, lifecycle
+// action or hook, so that side effects are not repeated. Its history and its
+// journal are rebuilt too, as far as the options of the Definition enable
+// them, and the timeouts of the final state are started anew, as for Restore.
+//
+// The replayed FSM keeps appending to the log, if the Definition has the
+// WithEventLog option, without appending the replayed entries again.
+//
+// A non-nil error is returned if the log cannot be read, if it is empty, if
+// any state of its entries is not within the states of the Definition, or if
+// an entry does not leave the state the previous one entered.
+func Replay(d *Definition, log EventLog) (*FSM, error) {
+	entries, err := log.Entries()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("the event log is empty")
+	}
+
+	for _, entry := range entries {
+		for _, state := range []string{entry.From, entry.To} {
+			if _, ok := d.states[state]; !ok {
+				return nil, fmt.Errorf("the state %q is not in the definition", state)
+			}
+		}
+	}
+
+	m := d.instance(entries[0].From)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, entry := range entries {
+		if entry.From != m.current {
+			return nil, fmt.Errorf(
+				"entry %d leaves the state %q, instead of %q", i, entry.From, m.current,
+			)
+		}
+		metadata := Metadata{From: entry.From, To: entry.To, Event: entry.Event, Args: entry.Args}
+		m.appendRecord(Record{Metadata: metadata, Time: entry.Time})
+		if entry.Event == undoEvent && len(m.journal) > 0 {
+			// Undo pops the journal, instead of journaling.
+			m.journal = m.journal[:len(m.journal)-1]
+		}
+		m.journalize(entry.Event, entry.To)
+		m.current = entry.To
+	}
+	m.scheduleTimeouts()
+	return m, nil
+}
@@ -0,0 +1,126 @@
+package fine_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+// failingLog is a fine.EventLog failing every append.
+type failingLog struct{ err error }
+
+func (l failingLog) Append(fine.LogEntry) error        { return l.err }
+func (l failingLog) Entries() ([]fine.LogEntry, error) { return nil, l.err }
+
+func TestEventLog(t *testing.T) {
+	var log fine.MemoryLog
+	sent := 0
+	d, err := fine.Define(fine.States{
+		"draft":     {"submit": "review"},
+		"review":    {"approve": "published", "reject": "draft", "@enter": func() { sent++ }},
+		"published": {"edit": fine.Internal{Action: "draft"}},
+	}, fine.WithEventLog(&log), fine.WithUndo(10), fine.WithHistory(10))
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	m := d.NewInstance("draft")
+	m.Do("submit")
+	m.Do("reject")
+	m.Do("submit")
+	m.Do("approve")
+	m.Do("edit")
+	m.Undo()
+
+	// Test that every state change is logged, including the internal ones
+	// and the pseudo-events.
+	entries, _ := log.Entries()
+	var events []string
+	for _, entry := range entries {
+		events = append(events, entry.Event)
+	}
+	if got, want := strings.Join(events, " "), "submit reject submit approve edit @undo"; got != want {
+		t.Fatalf("wrong events: got %q, want %q", got, want)
+	}
+
+	// Test that the replayed FSM has the same state, history and journal,
+	// without executing any action.
+	sent = 0
+	replayed, err := fine.Replay(d, &log)
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if state := replayed.State(); state != "published" {
+		t.Fatalf("wrong state: got %q, want %q", state, "published")
+	}
+	if sent != 0 {
+		t.Fatalf("wrong @enter calls: got %d, want 0", sent)
+	}
+	if h := replayed.History(); len(h) != 6 || h[5].Event != "@undo" {
+		t.Fatalf("wrong history: got %+v", h)
+	}
+	if state, err := replayed.Undo(); err != nil || state != "review" {
+		t.Fatalf("wrong undo: got (%q, %v), want %q", state, err, "review")
+	}
+
+	// Test that the replayed FSM keeps logging, without duplicating the
+	// replayed entries.
+	if entries, _ := log.Entries(); len(entries) != 7 {
+		t.Fatalf("wrong entries: got %d, want 7", len(entries))
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	d, err := fine.Define(fine.States{
+		"on":  {"toggle": "off"},
+		"off": {"toggle": "on"},
+	})
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+
+	// Test that empty, unreadable and inconsistent logs cannot be replayed.
+	var empty fine.MemoryLog
+	if _, err := fine.Replay(d, &empty); err == nil {
+		t.Fatalf("error expected for an empty log")
+	}
+	readErr := errors.New("unreadable")
+	if _, err := fine.Replay(d, failingLog{readErr}); !errors.Is(err, readErr) {
+		t.Fatalf("wrong error: got %v, want %v", err, readErr)
+	}
+	var unknown fine.MemoryLog
+	unknown.Append(fine.LogEntry{From: "on", To: "broken", Event: "toggle"})
+	if _, err := fine.Replay(d, &unknown); err == nil {
+		t.Fatalf("error expected for an unknown state")
+	}
+	var gap fine.MemoryLog
+	gap.Append(fine.LogEntry{From: "on", To: "off", Event: "toggle"})
+	gap.Append(fine.LogEntry{From: "on", To: "off", Event: "toggle"})
+	if _, err := fine.Replay(d, &gap); err == nil {
+		t.Fatalf("error expected for an inconsistent log")
+	}
+}
+
+func TestEventLogError(t *testing.T) {
+	appendErr := errors.New("disk full")
+	d, err := fine.Define(fine.States{
+		"on":  {"toggle": "off"},
+		"off": {"toggle": "on"},
+	}, fine.WithEventLog(failingLog{appendErr}))
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	m := d.NewInstance("on")
+	reported := make(chan error, 1)
+	m.OnError(func(err error) { reported <- err })
+
+	// Test that the errors of the log are reported, without preventing the
+	// transition.
+	if state, err := m.Do("toggle"); err != nil || state != "off" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "off")
+	}
+	if err := <-reported; !errors.Is(err, appendErr) {
+		t.Fatalf("wrong error: got %v, want %v", err, appendErr)
+	}
+}
@@ -8,37 +8,12 @@ import (
 )
 
 func main() {
-	// Initialize the traffic light FSM. At every @enter, a new goroutine
-	// starts, waits for some time, and finally requests the execution of the
-	// change action.
+	// Initialize the traffic light FSM. Every state does the change action
+	// automatically, after the light has been on for some time.
 	trafficLight := fine.Machine("red", fine.States{
-		"green": {
-			"@enter": func(this *fine.FSM) {
-				go func() {
-					time.Sleep(14 * time.Second)
-					this.Do("change")
-				}()
-			},
-			"change": "yellow",
-		},
-		"yellow": {
-			"@enter": func(this *fine.FSM) {
-				go func() {
-					time.Sleep(3 * time.Second)
-					this.Do("change")
-				}()
-			},
-			"change": "red",
-		},
-		"red": {
-			"@enter": func(this *fine.FSM) {
-				go func() {
-					time.Sleep(12 * time.Second)
-					this.Do("change")
-				}()
-			},
-			"change": "green",
-		},
+		"green":  {"change": fine.After(14*time.Second, "yellow")},
+		"yellow": {"change": fine.After(3*time.Second, "red")},
+		"red":    {"change": fine.After(12*time.Second, "green")},
 	})
 
 	// Subscribe to the FSM, and every time the state changes print the
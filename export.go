@@ -0,0 +1,279 @@
+package fine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// edge is a transition between two states. Dynamic edges come from function
+// actions, whose target cannot be known without executing them. Edges coming
+// from a Dispatch action have the matching key as branch.
+type edge struct {
+	from, event, to string
+	branch          string
+	dynamic         bool
+}
+
+// label returns the label of the edge in diagrams.
+func (e edge) label() string {
+	if e.branch != "" {
+		return e.event + " [" + e.branch + "]"
+	}
+	return e.event
+}
+
+// description is a consistent snapshot of the structure of the FSM, used by
+// the introspection and export features.
+type description struct {
+	initial string
+	current string
+	states  []string
+	edges   []edge
+}
+
+// describe takes a snapshot of the structure of the FSM. States and edges are
+// sorted, following the recorded order of the states if any, so that the
+// snapshot is deterministic.
+func (m *FSM) describe() description {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return describe(m.initial, m.current, m.table(), m.global.Load(), m.stateLess())
+}
+
+// describe builds the description of the given states and global transitions,
+// which may be nil, sorting the states with the given function. The global
+// transitions result in edges from every state that does not override them.
+func describe(initial, current string, states stateTable, global *state, less func(a, b string) bool) description {
+	d := description{initial: initial, current: current}
+	for name, s := range states {
+		d.states = append(d.states, name)
+		d.edges = appendEdges(d.edges, name, s.actions, nil)
+		if global != nil {
+			d.edges = appendEdges(d.edges, name, global.actions, s.actions)
+		}
+	}
+	sort.Slice(d.states, func(i, j int) bool {
+		return less(d.states[i], d.states[j])
+	})
+	sort.Slice(d.edges, func(i, j int) bool {
+		a, b := d.edges[i], d.edges[j]
+		if a.from != b.from {
+			return less(a.from, b.from)
+		}
+		if a.event != b.event {
+			return a.event < b.event
+		}
+		return a.branch < b.branch
+	})
+
+	return d
+}
+
+// appendEdges appends to the given edges the ones of the given actions from
+// the named state, skipping the events of the overriding actions.
+func appendEdges(edges []edge, from string, actions, overriding map[string]action) []edge {
+	for event, a := range actions {
+		if _, ok := overriding[event]; ok {
+			continue
+		}
+		e := edge{from: from, event: event}
+		switch a.kind {
+		case kindNil:
+			e.to = from
+		case kindTarget:
+			e.to = a.target
+		case kindDispatch:
+			for branch, target := range a.dispatch {
+				e.branch, e.to = branch, target
+				edges = append(edges, e)
+			}
+			continue
+		default:
+			e.dynamic = true
+		}
+		edges = append(edges, e)
+	}
+	return edges
+}
+
+// reachable returns the set of states reachable from the given one over the
+// static edges of the description, including the given state itself.
+func (d description) reachable(from string) map[string]bool {
+	adjacency := make(map[string][]string)
+	exists := make(map[string]bool, len(d.states))
+	for _, name := range d.states {
+		exists[name] = true
+	}
+	for _, e := range d.edges {
+		if !e.dynamic && exists[e.to] {
+			adjacency[e.from] = append(adjacency[e.from], e.to)
+		}
+	}
+
+	visited := make(map[string]bool)
+	if !exists[from] {
+		return visited
+	}
+	queue := []string{from}
+	visited[from] = true
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, next := range adjacency[name] {
+			if !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return visited
+}
+
+// restrict returns a description containing only the given states, and the
+// edges leaving them.
+func (d description) restrict(keep map[string]bool) description {
+	r := description{initial: d.initial, current: d.current}
+	for _, name := range d.states {
+		if keep[name] {
+			r.states = append(r.states, name)
+		}
+	}
+	for _, e := range d.edges {
+		if keep[e.from] {
+			r.edges = append(r.edges, e)
+		}
+	}
+	return r
+}
+
+// ExportDOT returns a description of the FSM in the DOT language, which can be
+// rendered with Graphviz. Every state is a node, and the current one is
+// filled. Every transition is an edge labeled with its event: actions that do
+// not change the state are loops, while function actions, whose target is not
+// known statically, are dashed edges towards a node labeled "?".
+func (m *FSM) ExportDOT() string {
+	return m.describe().dot()
+}
+
+// ExportDOTReachable behaves like ExportDOT, but it only includes the current
+// state and the states reachable from it, as returned by ReachableFrom.
+//
+// Note: since the targets of function actions are not known statically, some
+// states that are actually reachable through them may be omitted.
+func (m *FSM) ExportDOTReachable() string {
+	d := m.describe()
+	return d.restrict(d.reachable(d.current)).dot()
+}
+
+// ExportMermaid returns a Mermaid state diagram of the FSM, which can be
+// embedded in Markdown documents, for example on GitHub. Every state is
+// declared, the initial one is marked as such, and every transition is
+// labeled with its event, and with its key for Dispatch actions. Function
+// actions, whose target is not known statically, are dynamic transitions
+// leading to a state labeled "?".
+func (m *FSM) ExportMermaid() string {
+	return m.describe().mermaid()
+}
+
+// ExportMermaidReachable behaves like ExportMermaid, but it only includes the
+// current state and the states reachable from it, as returned by
+// ReachableFrom.
+//
+// Note: since the targets of function actions are not known statically, some
+// states that are actually reachable through them may be omitted.
+func (m *FSM) ExportMermaidReachable() string {
+	d := m.describe()
+	return d.restrict(d.reachable(d.current)).mermaid()
+}
+
+// dynamic reports whether the description has any dynamic edge.
+func (d description) dynamic() bool {
+	for _, e := range d.edges {
+		if e.dynamic {
+			return true
+		}
+	}
+	return false
+}
+
+// dynamicNode is the identifier of the node standing for the unknown targets
+// of function actions.
+const dynamicNode = "__dynamic__"
+
+func (d description) dot() string {
+	var b strings.Builder
+
+	b.WriteString("digraph fsm {\n")
+	for _, name := range d.states {
+		if name == d.current {
+			fmt.Fprintf(&b, "\t%s [style=filled];\n", dotQuote(name))
+		} else {
+			fmt.Fprintf(&b, "\t%s;\n", dotQuote(name))
+		}
+	}
+	if d.dynamic() {
+		fmt.Fprintf(&b, "\t%s [label=\"?\", shape=none];\n", dotQuote(dynamicNode))
+	}
+	for _, e := range d.edges {
+		if e.dynamic {
+			fmt.Fprintf(
+				&b, "\t%s -> %s [label=%s, style=dashed];\n",
+				dotQuote(e.from), dotQuote(dynamicNode), dotQuote(e.label()),
+			)
+			continue
+		}
+		fmt.Fprintf(
+			&b, "\t%s -> %s [label=%s];\n",
+			dotQuote(e.from), dotQuote(e.to), dotQuote(e.label()),
+		)
+	}
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+func (d description) mermaid() string {
+	var b strings.Builder
+
+	// States are declared with an identifier and a label, so that any name
+	// can be used.
+	ids := make(map[string]string, len(d.states))
+	b.WriteString("stateDiagram-v2\n")
+	for i, name := range d.states {
+		ids[name] = fmt.Sprintf("s%d", i)
+		fmt.Fprintf(&b, "\tstate %s as %s\n", mermaidQuote(name), ids[name])
+	}
+	if d.dynamic() {
+		fmt.Fprintf(&b, "\tstate \"?\" as %s\n", dynamicNode)
+	}
+	if id, ok := ids[d.initial]; ok {
+		fmt.Fprintf(&b, "\t[*] --> %s\n", id)
+	}
+	for _, e := range d.edges {
+		to, ok := ids[e.to]
+		if e.dynamic {
+			to = dynamicNode
+		} else if !ok {
+			// Skip the edges towards states that do not exist.
+			continue
+		}
+		fmt.Fprintf(&b, "\t%s --> %s: %s\n", ids[e.from], to, e.label())
+	}
+
+	return b.String()
+}
+
+// dotQuote returns the given string as a DOT quoted identifier.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// mermaidQuote returns the given string as a Mermaid state description.
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
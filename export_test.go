@@ -0,0 +1,118 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func newExportMachine() *fine.FSM {
+	return fine.Machine("locked", fine.States{
+		"locked": {
+			"pay":  "unlocked",
+			"push": nil,
+		},
+		"unlocked": {
+			"pay":   nil,
+			"push":  "locked",
+			"break": func() string { return "broken" },
+		},
+		"broken": {
+			"fix": "locked",
+		},
+		"storage": {
+			"deploy": fine.Dispatch{"fast": "unlocked", fine.DispatchDefault: "locked"},
+		},
+	})
+}
+
+func TestExportDOT(t *testing.T) {
+	machine := newExportMachine()
+
+	want := `digraph fsm {
+	"broken";
+	"locked" [style=filled];
+	"storage";
+	"unlocked";
+	"__dynamic__" [label="?", shape=none];
+	"broken" -> "locked" [label="fix"];
+	"locked" -> "unlocked" [label="pay"];
+	"locked" -> "locked" [label="push"];
+	"storage" -> "locked" [label="deploy [@default]"];
+	"storage" -> "unlocked" [label="deploy [fast]"];
+	"unlocked" -> "__dynamic__" [label="break", style=dashed];
+	"unlocked" -> "unlocked" [label="pay"];
+	"unlocked" -> "locked" [label="push"];
+}
+`
+	if got := machine.ExportDOT(); got != want {
+		t.Fatalf("wrong DOT:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExportDOTReachable(t *testing.T) {
+	machine := newExportMachine()
+
+	// The "broken" state is only reachable through a function action, and
+	// the "storage" state is not reachable at all.
+	want := `digraph fsm {
+	"locked" [style=filled];
+	"unlocked";
+	"__dynamic__" [label="?", shape=none];
+	"locked" -> "unlocked" [label="pay"];
+	"locked" -> "locked" [label="push"];
+	"unlocked" -> "__dynamic__" [label="break", style=dashed];
+	"unlocked" -> "unlocked" [label="pay"];
+	"unlocked" -> "locked" [label="push"];
+}
+`
+	if got := machine.ExportDOTReachable(); got != want {
+		t.Fatalf("wrong DOT:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExportMermaid(t *testing.T) {
+	machine := newExportMachine()
+
+	want := `stateDiagram-v2
+	state "broken" as s0
+	state "locked" as s1
+	state "storage" as s2
+	state "unlocked" as s3
+	state "?" as __dynamic__
+	[*] --> s1
+	s0 --> s1: fix
+	s1 --> s3: pay
+	s1 --> s1: push
+	s2 --> s1: deploy [@default]
+	s2 --> s3: deploy [fast]
+	s3 --> __dynamic__: break
+	s3 --> s3: pay
+	s3 --> s1: push
+`
+	if got := machine.ExportMermaid(); got != want {
+		t.Fatalf("wrong Mermaid:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExportMermaidReachable(t *testing.T) {
+	machine := newExportMachine()
+	machine.Do("pay")
+	machine.AddOrMerge("unlocked", fine.Transitions{"break": "broken"})
+
+	want := `stateDiagram-v2
+	state "broken" as s0
+	state "locked" as s1
+	state "unlocked" as s2
+	[*] --> s1
+	s0 --> s1: fix
+	s1 --> s2: pay
+	s1 --> s1: push
+	s2 --> s0: break
+	s2 --> s2: pay
+	s2 --> s1: push
+`
+	if got := machine.ExportMermaidReachable(); got != want {
+		t.Fatalf("wrong Mermaid:\n%s\nwant:\n%s", got, want)
+	}
+}
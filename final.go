@@ -0,0 +1,23 @@
+package fine
+
+// Final is the key marking a state as final, with a true value, as in the
+// following example. A final state is where the FSM completes its work, which
+// is meaningful for workflow-style machines: entering it, after the @enter
+// lifecycle action, calls the hooks registered with OnCompletion, and delivers
+// the result of the FSM on the channel returned by Done.
+//
+//	"shipped": {fine.Final: true}
+//
+// The FSM can still leave a final state, if the state has transitions.
+const Final = "@final"
+
+// OnCompletion registers a hook that is called whenever the FSM enters a final
+// state, with the metadata of the transition. Final states are the ones marked
+// with Final, and the ones having a result: see SetResult. Multiple hooks can
+// be registered, and they run in registration order, without holding any
+// lock.
+func (m *FSM) OnCompletion(hook func(metadata Metadata)) {
+	m.mu.Lock()
+	m.completionHooks = append(m.completionHooks, hook)
+	m.mu.Unlock()
+}
@@ -0,0 +1,48 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestFinal(t *testing.T) {
+	machine := fine.Machine("ordered", fine.States{
+		"ordered":  {"ship": "shipped", "cancel": "canceled"},
+		"shipped":  {fine.Final: true, "return": "ordered"},
+		"canceled": {fine.Final: true},
+	})
+	var completed []fine.Metadata
+	machine.OnCompletion(func(md fine.Metadata) {
+		completed = append(completed, md)
+	})
+
+	// Test that the final key cannot be done.
+	if _, err := machine.Do(fine.Final); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+
+	// Test that entering a final state completes the FSM.
+	select {
+	case <-machine.Done():
+		t.Fatal("the FSM should not be done yet")
+	default:
+	}
+	machine.Do("ship")
+	if len(completed) != 1 || completed[0].From != "ordered" || completed[0].To != "shipped" {
+		t.Fatalf("wrong completions: got %+v", completed)
+	}
+	if result, ok := <-machine.Done(); !ok || result != nil {
+		t.Fatalf("wrong result: got %v (%v), want <nil>", result, ok)
+	}
+
+	// Test that the hooks run every time a final state is entered.
+	machine.Do("return")
+	machine.Do("cancel")
+	if len(completed) != 2 || completed[1].To != "canceled" {
+		t.Fatalf("wrong completions: got %+v", completed)
+	}
+	if _, ok := <-machine.Done(); ok {
+		t.Fatal("closed channel expected")
+	}
+}
@@ -1,23 +1,48 @@
 package fine
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"reflect"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Transitions is a mapping between events (or names of actions) and actions.
 //
 // An action can have one of the following types, or nil.
 //
-//     string
-//     func() string
-//     func(args ...interface{}) string
-//     func()
-//     func(args ...interface{})
+//	string
+//	func() string
+//	func(args ...interface{}) string
+//	func() (string, error)
+//	func(args ...interface{}) (string, error)
+//	func()
+//	func(args ...interface{})
+//	fine.Dispatch
+//	fine.History
+//	fine.DeepHistory
+//	fine.Internal
+//	fine.Reenter
+//	fine.Transition
+//	fine.Timeout
+//	fine.Handler
 //
-// Trying to call an action that has a different type will panic.
+// Function actions can also take a context.Context as first parameter, such as
+// func(ctx context.Context, args ...interface{}) string: they receive the
+// context passed to DoContext, or context.Background() for Do, so that
+// long-running actions can respect cancellation and deadlines.
+//
+// When a function action returns a non-nil error, the transition is aborted:
+// the state does not change, and the error is returned by Do and passed to the
+// hooks registered with OnActionError.
+//
+// Trying to call an action that has a different type will panic, unless the
+// FSM uses WithSafeDispatch.
 //
 // There are two special lifecycle functions, named "@enter" and "@exit",
 // executed on entering and exiting a state, respectively. It is not possible
@@ -25,10 +50,30 @@ import (
 // Metadata object and an optional pointer to the FSM itself. Thus, the
 // possible types for lifecycle actions are the following, or nil.
 //
-//     func()
-//     func(this *fine.FSM)
-//     func(metadata fine.Metadata)
-//     func(this *fine.FSM, metadata fine.Metadata)
+//	func()
+//	func(this *fine.FSM)
+//	func(metadata fine.Metadata)
+//	func(this *fine.FSM, metadata fine.Metadata)
+//
+// Each of them can also return a value of type interface{}, which is made
+// available to the caller of DoWithLifecycleResult for the "@enter" lifecycle
+// action. Moreover, lifecycle actions of type func(ctx context.Context) and
+// func(ctx context.Context, this *fine.FSM, metadata fine.Metadata), with or
+// without the return value, receive the context of the transition, as for
+// function actions.
+//
+// Similarly, the special keys "@before:event" and "@after:event" define hooks
+// scoped to the action named "event" of the state, with the same possible
+// types as lifecycle actions. The @before hook is executed right before the
+// action, with a Metadata whose To field is empty, since the new state is not
+// known yet. The @after hook is executed once the action succeeded, after the
+// @enter lifecycle action of the new state, if any. Thus, the order is:
+// @before, the action, @exit, the state change, @enter, and @after.
+//
+// Lifecycle actions are executed without holding any lock but the transition
+// lock, which is lent to the @enter lifecycle action, so they can freely use
+// the FSM they receive, for example to add states, and the @enter lifecycle
+// action can also do actions. See Do.
 type Transitions map[string]interface{}
 
 // States are mappings from states to Transitions.
@@ -50,44 +95,238 @@ type Metadata struct {
 
 	// The arguments that were passed to the action.
 	Args []interface{}
+
+	// The context passed to DoContext, or nil if the transition was not
+	// caused by DoContext. If the FSM uses WithTracer, it is the context of
+	// the span of the transition instead, derived from the one passed to
+	// DoContext, if any, so it is never nil.
+	Context context.Context
+
+	// How to resume any machine embedded in the new state.
+	history historyMode
+
+	// The action attached to the transition, if any.
+	effect func(Metadata)
+}
+
+// context returns the context of the transition, or context.Background() if
+// there is none.
+func (metadata Metadata) context() context.Context {
+	if metadata.Context == nil {
+		return context.Background()
+	}
+	return metadata.Context
 }
 
+// Value returns the value associated with the given key in the context of the
+// transition, or nil if there is no such value or no context at all.
+func (metadata Metadata) Value(key interface{}) interface{} {
+	if metadata.Context == nil {
+		return nil
+	}
+	return metadata.Context.Value(key)
+}
+
+// ErrBadActionType is returned, when the FSM uses safe dispatch, in place of
+// panicking because of an action with an invalid type. It is also wrapped by
+// the errors of Add, and by the panics of Machine, AddOrReplace and
+// AddOrMerge, for the actions with an invalid type.
+var ErrBadActionType = errors.New("invalid action type")
+
 // FSM is a finite-state machine that can be instantiated using the Machine
 // function.
 type FSM struct {
+	id      uint64
+	initial string
 	current string
-	states  States
+	states  atomic.Pointer[stateTable]
+	global  atomic.Pointer[state]
+
+	// The mutex mu guards every field, including the states unless the FSM
+	// is copy-on-write. In that case, changes to the states are serialized
+	// by smu instead.
+	mu  sync.RWMutex
+	smu sync.Mutex
+	cow bool
+
+	// Whether the states table is shared with other instances of the same
+	// Definition, so that it must be copied before changing it.
+	shared bool
+
+	// The lock tmu is held by Do for the whole transition, and lent to the
+	// actions done from within it.
+	tmu transitionLock
+
+	lastSubKey     int32
+	subscribers    []*subscriber
+	unsubscribed   atomic.Int32
+	enterCallbacks map[string]map[int32]func(Metadata)
+	eventCallbacks map[string]map[int32]func(Metadata)
+
+	transitionCallbacks map[int32]func(Metadata)
+
+	// The notifications queued for the subscribers, if asynchronous.
+	asyncSubscribers bool
+	mailbox          mailbox
+
+	// The events queued for the owner goroutine, if the FSM has a mailbox.
+	inbox *inbox
 
-	mu sync.RWMutex
+	embedded map[string]*embedding
 
-	lastSubKey  int32
-	subscribers map[int32]func(string)
+	safeDispatch     bool
+	recoverHandler   func(interface{}, Metadata)
+	errorHooks       []func(error)
+	actionErrorHooks []func(string, []interface{}, error)
+	lifecycleHooks   []lifecycleHook
+
+	schemas map[string][]reflect.Type
+
+	clock     Clock
+	epoch     uint64
+	scheduled map[string]*scheduled
+
+	rateLimits map[string]time.Duration
+	lastFired  map[string]time.Time
+
+	closed     bool
+	closeHooks []func()
+
+	unhandledHooks []func(Metadata)
+
+	forbidden      map[string]bool
+	strictForbid   bool
+	violationHooks []func(Metadata)
+
+	invariants     []invariant
+	invariantHooks []func(*InvariantError, Metadata)
+
+	suspended bool
+	missed    atomic.Bool
+
+	order atomic.Pointer[[]string]
+
+	results         map[string]func() interface{}
+	done            chan interface{}
+	finished        bool
+	completionHooks []func(Metadata)
+
+	undoDepth int
+	journal   []string
+
+	historyDepth int
+	records      []Record
+	nextRecord   int
+
+	eventLog EventLog
+	coverage *coverage
+	logger   logger
+	tracer   Tracer
+
+	// Whether any hook is registered with OnDone.
+	observed  atomic.Bool
+	doneHooks []func(Metadata, time.Duration, error)
+
+	version   int
+	migration func(oldVersion int, oldState string) string
+
+	// The mutex walMu serializes the writes to the write-ahead log.
+	walMu sync.Mutex
+	wal   io.Writer
+
+	deferrals map[string]map[string]bool
+	deferred  []pendingEvent
+	queued    atomic.Int32
+
+	// The mutex qmu protects the run-to-completion queue.
+	qmu             sync.Mutex
+	runToCompletion bool
+	busy            bool
+	queue           []pendingEvent
+}
+
+// Option configures an FSM at its creation.
+type Option func(*FSM)
+
+// WithSafeDispatch makes the FSM never panic because of an action with an
+// invalid type. Instead, Do returns an error wrapping ErrBadActionType, and
+// lifecycle actions with an invalid type are skipped, reporting the error to
+// the hooks registered with OnError. The actions are not checked when the
+// states are given, either, so that the valid ones can still be used.
+//
+// This is useful when the FSM definition comes from untrusted input or from
+// configuration.
+func WithSafeDispatch() Option {
+	return func(m *FSM) {
+		m.safeDispatch = true
+	}
 }
 
 // Machine instatiate a new FSM with the given initial state and the given set
-// of possible states.
+// of possible states. The FSM can be further configured with options.
 //
-// Note: the given initial state must be within the given possible states.
-func Machine(initialState string, states States) *FSM {
+// Note: the given initial state must be within the given possible states, and
+// every action must have a valid type, unless the FSM uses safe dispatch.
+// Otherwise, Machine panics with an error describing the offending state and
+// event, wrapping ErrBadActionType. Use Define to get an error instead.
+func Machine(initialState string, states States, opts ...Option) *FSM {
 	// Check for the initial state being present.
 	if _, ok := states[initialState]; !ok {
 		panic("the initial state must exist")
 	}
 
-	// Instantiate the FSM object.
-	m := &FSM{
-		current:     initialState,
-		states:      states,
-		subscribers: make(map[int32]func(string)),
+	// Instantiate the FSM object, precompiling all the given states.
+	m := newFSM(initialState)
+	compiled := make(stateTable, len(states))
+	for name, transitions := range states {
+		compiled[name] = compileState(name, transitions)
+	}
+	m.states.Store(&compiled)
+
+	// Apply the options before running anything.
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	// Check the types of all the actions, unless they are handled when
+	// dispatched, in a deterministic order.
+	if !m.safeDispatch {
+		for _, name := range sortedKeys(states) {
+			if err := checkActions(name, states[name]); err != nil {
+				panic(err)
+			}
+		}
 	}
 
 	// Initialize the last subscriber key to zero.
 	atomic.StoreInt32(&m.lastSubKey, 0)
 
+	m.start()
+	return m
+}
+
+// newFSM returns a new FSM in the given initial state, with no states.
+func newFSM(initialState string) *FSM {
+	return &FSM{
+		id:        nextID(),
+		initial:   initialState,
+		current:   initialState,
+		embedded:  make(map[string]*embedding),
+		clock:     realClock{},
+		scheduled: make(map[string]*scheduled),
+		done:      make(chan interface{}, 1),
+	}
+}
+
+// start starts the life of the FSM in its initial state.
+func (m *FSM) start() {
+	// Start the timers of the initial state.
+	m.mu.Lock()
+	m.scheduleTimeouts()
+	m.mu.Unlock()
+
 	// Execute the first @enter lifecycle action on the initial state.
 	m.doLifecycle("@enter", Metadata{To: m.current})
-
-	return m
 }
 
 // State returns the current state of the FSM.
@@ -100,69 +339,215 @@ func (m *FSM) State() string {
 
 // States returns a slice with all the possible states of the FSM.
 //
-// Note: the order is not guaranteed.
+// Note: the order is not guaranteed, unless the FSM was instantiated with
+// MachineOrdered.
 func (m *FSM) States() []string {
 	var states []string
 
-	m.mu.RLock()
-	for state := range m.states {
-		states = append(states, state)
+	m.readStates(func(table stateTable) {
+		for state := range table {
+			states = append(states, state)
+		}
+	})
+	if m.order.Load() != nil {
+		m.sortStates(states)
 	}
-	m.mu.RUnlock()
 
 	return states
 }
 
 // Add allows to add a new state with its associated transitions. If a state
-// with the same name is already present in the FSM a non-nil error is
+// with the same name is already present in the FSM, or, unless the FSM uses
+// safe dispatch, if any action has an invalid type, a non-nil error is
 // returned.
 func (m *FSM) Add(state string, transitions Transitions) error {
-	if m.Exists(state) {
-		return fmt.Errorf("a state with name %q already exists", state)
+	if err := m.checkActions(state, transitions); err != nil {
+		return err
 	}
+	compiled := compileState(state, transitions)
 
-	m.mu.Lock()
-	m.states[state] = transitions
-	m.mu.Unlock()
+	var err error
+	m.writeStates(func(states stateTable) {
+		if _, ok := states[state]; ok {
+			err = fmt.Errorf("a state with name %q already exists", state)
+			return
+		}
+		states[state] = compiled
+	})
 
-	return nil
+	return err
 }
 
 // AddOrReplace allows to add a new state with its associated transitions. If a
 // state with the same name is already present in the FSM, its transitions will
 // be completely overwritten.
+//
+// Note: as for Machine, every action must have a valid type, unless the FSM
+// uses safe dispatch.
 func (m *FSM) AddOrReplace(state string, transitions Transitions) {
-	m.mu.Lock()
-	m.states[state] = transitions
-	m.mu.Unlock()
+	if err := m.checkActions(state, transitions); err != nil {
+		panic(err)
+	}
+	compiled := compileState(state, transitions)
+
+	m.writeStates(func(states stateTable) {
+		states[state] = compiled
+	})
 }
 
 // AddOrMerge allows to add a new state with its associated transitions. If a
 // state with the same name is already present in the FSM, its transitions will
 // be merged, keeping the newer ones in case of collisions.
+//
+// Note: as for Machine, every action must have a valid type, unless the FSM
+// uses safe dispatch.
 func (m *FSM) AddOrMerge(state string, transitions Transitions) {
-	if m.Exists(state) {
-		m.mu.Lock()
-		for k, v := range transitions {
-			m.states[state][k] = v
+	if err := m.checkActions(state, transitions); err != nil {
+		panic(err)
+	}
+	m.writeStates(func(states stateTable) {
+		states[state] = merge(state, states[state], transitions)
+	})
+}
+
+// AddOrMergeChecked behaves like AddOrMerge, but it also returns the events
+// whose action changed type because of the merge, sorted alphabetically. For
+// example, an event whose action was a string and is now a func() string is
+// reported, since its behavior may be completely different. Events that were
+// not present before the merge are not reported.
+//
+// The merge is always performed, and the returned list is only advisory. A
+// non-nil error is returned, and nothing is merged, if any of the given
+// transitions has an invalid type, unless the FSM was created with
+// WithSafeDispatch, as for AddOrMerge.
+func (m *FSM) AddOrMergeChecked(state string, transitions Transitions) ([]string, error) {
+	// Check for the validity of all the given actions before merging.
+	if err := m.checkActions(state, transitions); err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	m.writeStates(func(states stateTable) {
+		old, ok := states[state]
+		states[state] = merge(state, old, transitions)
+		if !ok {
+			return
 		}
-		m.mu.Unlock()
-	} else {
-		m.mu.Lock()
-		m.states[state] = transitions
-		m.mu.Unlock()
+
+		for event, action := range transitions {
+			prev, ok := old.transitions[event]
+			if ok && reflect.TypeOf(prev) != reflect.TypeOf(action) {
+				changed = append(changed, event)
+			}
+		}
+	})
+	sort.Strings(changed)
+
+	return changed, nil
+}
+
+// DeepMerge behaves like AddOrMerge, but the structured actions of the same
+// event are merged too, instead of being replaced. The merge rules are:
+//
+//   - two Dispatch actions are merged into their union, keeping the newer
+//     targets in case of colliding keys;
+//   - in every other case, including when the type of the action changes, the
+//     newer action replaces the older one.
+//
+// A non-nil error is returned, and nothing is merged, if any of the given
+// transitions has an invalid type, unless the FSM was created with
+// WithSafeDispatch, as for AddOrMerge.
+func (m *FSM) DeepMerge(state string, transitions Transitions) error {
+	// Check for the validity of all the given actions before merging.
+	if err := m.checkActions(state, transitions); err != nil {
+		return err
+	}
+
+	m.writeStates(func(states stateTable) {
+		old, ok := states[state]
+		if !ok {
+			states[state] = compileState(state, transitions)
+			return
+		}
+		deep := make(Transitions, len(transitions))
+		for event, action := range transitions {
+			deep[event] = mergeValue(old.transitions[event], action)
+		}
+		states[state] = merge(state, old, deep)
+	})
+
+	return nil
+}
+
+// mergeValue returns the deep merge of the given transition values.
+func mergeValue(old, value interface{}) interface{} {
+	switch v := value.(type) {
+	case Dispatch:
+		prev, ok := old.(Dispatch)
+		if !ok {
+			return v
+		}
+		merged := make(Dispatch, len(prev)+len(v))
+		for key, target := range prev {
+			merged[key] = target
+		}
+		for key, target := range v {
+			merged[key] = target
+		}
+		return merged
+	}
+	return value
+}
+
+// merge returns the precompiled state obtained by merging the given
+// transitions over the old state, which may be nil.
+func merge(name string, old *state, transitions Transitions) *state {
+	if old == nil {
+		return compileState(name, transitions)
+	}
+	merged := make(Transitions, len(old.transitions)+len(transitions))
+	for event, action := range old.transitions {
+		merged[event] = action
 	}
+	for event, action := range transitions {
+		merged[event] = action
+	}
+	return compileState(name, merged)
 }
 
 // Exists returns whether the specified state is a possible state for the FSM.
 func (m *FSM) Exists(state string) bool {
-	m.mu.RLock()
-	_, ok := m.states[state]
-	m.mu.RUnlock()
+	var ok bool
+	m.readStates(func(states stateTable) {
+		_, ok = states[state]
+	})
 
 	return ok
 }
 
+// StatesMissing returns, sorted alphabetically, all the states that do not
+// handle the given event. It helps making sure that an important event, such
+// as a cancellation, is handled everywhere. An event with a global transition
+// is handled by all the states, while fallback actions are not considered,
+// since they do not handle the event specifically.
+func (m *FSM) StatesMissing(event string) []string {
+	var missing []string
+
+	m.readStates(func(states stateTable) {
+		if _, ok := lookup(nil, m.global.Load(), event); ok {
+			return
+		}
+		for name, s := range states {
+			if _, ok := s.transitions[event]; !ok {
+				missing = append(missing, name)
+			}
+		}
+	})
+
+	sort.Strings(missing)
+	return missing
+}
+
 // Do executes the specified action on the FSM from the current state.
 //
 // The action parameter specifies the event, that is, the action name.
@@ -170,159 +555,841 @@ func (m *FSM) Exists(state string) bool {
 // It is possible to pass arguments to the action. If the action isn't a
 // function or does not accept any parameter, the arguments will be ignored.
 //
+// Every Do holds the transition lock of the FSM from the lookup of the action
+// to the end of the transition, that is the @exit lifecycle action, the state
+// change, the notification of the subscribers, and the @enter lifecycle
+// action, so that the action is always executed from the state it is
+// transitioning from, and concurrent calls to Do queue up. Once the state
+// changed, or the action failed, the lock is lent to the actions done until
+// the transition ends, such as by a subscriber or the @enter lifecycle
+// action, which run right away, nested, whichever goroutine does them.
+//
+// Note: doing an action synchronously from within the action itself, its
+// @before hook or the @exit lifecycle action deadlocks, as the lock is not
+// lent yet.
+//
 // Note: lifecycle actions cannot be manually executed.
 func (m *FSM) Do(action string, args ...interface{}) (string, error) {
-	// Prohibit the execution of lifecycle actions.
-	if action == "@enter" || action == "@exit" {
-		return "", errors.New("calling a lifecycle action manually is illegal")
+	state, _, err := m.do(nil, action, args)
+	return state, err
+}
+
+// DoContext behaves like Do, but it also passes the given context to the
+// actions and lifecycle actions that accept one, and makes it available
+// through the Metadata of the transition. If the context is already done, the
+// action is not executed and the context error is returned.
+func (m *FSM) DoContext(ctx context.Context, action string, args ...interface{}) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	state, _, err := m.do(ctx, action, args)
+	return state, err
+}
+
+// DoSync behaves like Do, but it returns only after all the subscribers have
+// been notified of the state change, so that the new state is fully
+// propagated when it returns. By default, subscribers are notified
+// synchronously, so DoSync is the same as Do, while with WithAsyncSubscribers
+// it waits for every queued notification to be delivered.
+//
+// Note: with WithAsyncSubscribers, calling DoSync from within a subscriber
+// deadlocks, as it waits for the subscriber itself to return.
+func (m *FSM) DoSync(action string, args ...interface{}) (string, error) {
+	state, _, err := m.do(nil, action, args)
+	if m.asyncSubscribers {
+		m.flush()
+	}
+	return state, err
+}
+
+// DoWithLifecycleResult behaves like Do, but it also returns the value
+// returned by the @enter lifecycle action of the new state, if the action
+// caused a state change and that lifecycle action returns something.
+// Otherwise, the returned lifecycle result is nil.
+func (m *FSM) DoWithLifecycleResult(action string, args ...interface{}) (state string, lifecycleResult interface{}, err error) {
+	return m.do(nil, action, args)
+}
+
+// do executes the given action, with the given context, as dispatch.
+func (m *FSM) do(ctx context.Context, action string, args []interface{}) (string, interface{}, error) {
+	return m.dispatch(pendingEvent{ctx: ctx, action: action, args: args})
+}
+
+// dispatch executes the given event, handing it to the owner goroutine if the
+// FSM has a mailbox, or directly otherwise, as process.
+func (m *FSM) dispatch(e pendingEvent) (string, interface{}, error) {
+	if m.inbox != nil {
+		return m.mail(e)
+	}
+	return m.process(e)
+}
+
+// process executes the given event, or queues it if the FSM runs to
+// completion and a transition is in progress.
+func (m *FSM) process(e pendingEvent) (string, interface{}, error) {
+	if m.runToCompletion {
+		state, queued, err := m.enqueue(e)
+		if queued || err != nil {
+			return state, nil, err
+		}
+		defer m.drain()
+	}
+	return m.run(e)
+}
+
+// run executes the given event, or batch, and then, if it succeeded, replays
+// the deferred events that the FSM can now handle.
+func (m *FSM) run(e pendingEvent) (string, interface{}, error) {
+	if e.batch != nil {
+		return m.runBatch(e.batch)
+	}
+	state, result, err := m.step(e)
+	if err == nil {
+		m.replayDeferred(e.held)
+	}
+	return state, result, err
+}
+
+// step executes the given event, moving the FSM to the resulting state, or
+// defers it if the current state says so. If the event expects a state, and
+// the current one differs, nothing happens and a *StateConflictError is
+// returned.
+func (m *FSM) step(e pendingEvent) (state string, result interface{}, err error) {
+	ctx, action, args := e.ctx, e.action, e.args
+
+	// Serialize the whole transition, unless the caller holds the transition
+	// lock already. The lock is lent once nothing can change the outcome of
+	// the transition anymore, so that the actions done from within the hooks,
+	// the subscribers and the @enter lifecycle action run nested.
+	var lent *level
+	if e.held == nil {
+		if e.try {
+			lent = m.tmu.tryLock()
+		} else {
+			lent = m.tmu.lock()
+		}
+		if lent == nil {
+			return m.State(), nil, errBusy
+		}
+		defer m.tmu.unlock(lent)
+	}
+	if e.scheduled != nil && !m.unschedule(e.scheduled) {
+		return m.State(), nil, errUnscheduled
+	}
+
+	// Trace the action, if requested.
+	if m.tracer != nil {
+		var span Span
+		ctx, span = startSpan(m.tracer, ctx, "fine.Do",
+			Attribute{"fine.event", action},
+			Attribute{"fine.from", m.State()},
+			Attribute{"fine.args", len(args)},
+		)
+		defer func() {
+			span.SetAttributes(Attribute{"fine.to", state})
+			span.End(err)
+		}()
+	}
+
+	// Log and report the outcome of the action, if requested.
+	if m.logger != nil || m.observed.Load() {
+		from, start := m.State(), m.clock.Now()
+		defer func() {
+			m.stepDone(Metadata{
+				From:    from,
+				To:      state,
+				Event:   action,
+				Args:    args,
+				Context: ctx,
+			}, m.clock.Now().Sub(start), err)
+		}()
 	}
 
-	// Check for the existence of the requested action.
+	// Lend the lock to the hooks reporting the outcome, once done.
+	defer m.tmu.lend(lent)
+
+	// Prohibit the execution of lifecycle actions, and of the fallback one.
+	if action == "@enter" || action == "@exit" || action == Final {
+		return "", nil, errors.New("calling a lifecycle action manually is illegal")
+	}
+	if action == UnknownEvent {
+		return "", nil, errors.New("calling the fallback action manually is illegal")
+	}
+
+	// Look up the precompiled action, checking for its existence, and
+	// validate the arguments.
 	m.mu.RLock()
-	if _, ok := m.states[m.current][action]; !ok {
-		defer m.mu.RUnlock()
-		return "", fmt.Errorf(
+	closed := m.closed
+	current := m.current
+	next, ok := resolve(m.table()[current], m.global.Load(), action)
+	argsErr := m.checkArgs(action, args)
+	_, limited := m.rateLimits[action]
+	deferred := m.deferrals[current][action]
+	m.mu.RUnlock()
+	if closed {
+		return "", nil, ErrClosed
+	}
+	if e.expected != "" && current != e.expected {
+		return current, nil, &StateConflictError{Expected: e.expected, Actual: current}
+	}
+	if deferred && argsErr == nil {
+		m.enqueueDeferred(pendingEvent{ctx: ctx, action: action, args: args})
+		return current, nil, nil
+	}
+	if !ok {
+		m.tmu.lend(lent)
+		m.unhandled(Metadata{
+			From:    current,
+			Event:   action,
+			Args:    args,
+			Context: ctx,
+		})
+		return "", nil, fmt.Errorf(
 			"%q is not a valid action for the current state %q",
-			action, m.current,
+			action, current,
 		)
 	}
-	m.mu.RUnlock()
+	if argsErr != nil {
+		return "", nil, argsErr
+	}
+	if next.kind == kindInvalid && m.safeDispatch {
+		err := badActionType(action, current)
+		m.tmu.lend(lent)
+		m.actionFailed(action, args, err)
+		return "", nil, err
+	}
+	var checked time.Time
+	if limited {
+		if checked, err = m.rateLimit(action); err != nil {
+			return "", nil, err
+		}
+	}
 
-	// Execute the action, and evaluate what the new state will be.
-	newState := m.do(action, args...)
+	// Execute the @before hook of the action, if any.
+	if next.before != nil {
+		m.doScopedHook(beforePrefix+action, current, next.before, Metadata{
+			From:    current,
+			Event:   action,
+			Args:    args,
+			Context: ctx,
+		})
+	}
 
-	// Evaluate if the action changed the state.
-	var stateChanged bool
-	m.mu.RLock()
-	if newState != m.current {
-		stateChanged = true
+	// Execute the action, evaluate what the new state will be, and move
+	// there, unless the action failed.
+	var newState string
+	if r, panicked := m.protect(Metadata{
+		From:    current,
+		Event:   action,
+		Args:    args,
+		Context: ctx,
+	}, func() {
+		newState, err = next.exec(ctx, current, args)
+	}); panicked {
+		err = panicError(action, r)
 	}
-	m.mu.RUnlock()
+	if err != nil {
+		m.tmu.lend(lent)
+		m.actionFailed(action, args, err)
+		return current, nil, err
+	}
+	state, result, err = m.advance(ctx, action, args, newState, next, lent)
+	if err == nil {
+		m.cover(current, action)
+		if limited {
+			m.fired(action, checked)
+		}
+	}
+
+	// Execute the @after hook of the action, if any, only if the action
+	// succeeded.
+	if next.after != nil && err == nil {
+		m.doScopedHook(afterPrefix+action, current, next.after, Metadata{
+			From:    current,
+			To:      state,
+			Event:   action,
+			Args:    args,
+			Context: ctx,
+		})
+	}
+	return state, result, err
+}
 
-	// If the state changed, execute the state transition.
-	if stateChanged {
-		m.mu.RLock()
+// advance moves the FSM to the given new state, as the outcome of the given
+// action, unless it is the current state already and the action is not a
+// Reenter one. The precompiled action tells how the transition must happen,
+// and the level of the transition lock is the one to lend, if not nil, as
+// transition does.
+func (m *FSM) advance(ctx context.Context, action string, args []interface{}, newState string, next action, held *level) (string, interface{}, error) {
+	// Evaluate if the action changed the state. When nothing observes the
+	// state change, or the transition is internal, commit it right away,
+	// without building any metadata, unless there is a write-ahead log, which
+	// is not written while holding m.mu.
+	m.mu.Lock()
+	current := m.current
+	forbidden := m.forbidden[newState]
+	switch {
+	case newState == current && !next.reenter && next.effect == nil:
+		m.mu.Unlock()
+		return current, nil, nil
+	case !forbidden && next.effect == nil && m.wal == nil && (next.internal || m.unobserved(current, newState)):
 		metadata := Metadata{
-			From:  m.current,
-			To:    newState,
-			Event: action,
-			Args:  args,
+			From:    current,
+			To:      newState,
+			Event:   action,
+			Args:    args,
+			Context: ctx,
 		}
-		m.mu.RUnlock()
-
-		// Execute the @exit lifecycle action.
-		m.doLifecycle("@exit", metadata)
+		m.commit(metadata)
+		checked := len(m.invariants) > 0
+		m.mu.Unlock()
+		if checked {
+			m.checkInvariants(metadata)
+		}
+		return newState, nil, nil
+	}
+	m.mu.Unlock()
 
-		// Update the current state.
+	// Otherwise, execute the full state transition, unless it is prevented
+	// because of a forbidden destination.
+	metadata := Metadata{
+		From:    current,
+		To:      newState,
+		Event:   action,
+		Args:    args,
+		Context: ctx,
+		history: next.history,
+		effect:  next.effect,
+	}
+	if newState == current && !next.reenter {
+		// A self-transition only executes the action attached to it.
+		m.protect(metadata, func() { next.effect(metadata) })
+		return current, nil, nil
+	}
+	if forbidden {
+		if err := m.violate(metadata); err != nil {
+			return current, nil, err
+		}
+	}
+	if err := m.writeAhead(metadata); err != nil {
+		return current, nil, err
+	}
+	if next.internal {
+		if next.effect != nil {
+			m.protect(metadata, func() { next.effect(metadata) })
+		}
 		m.mu.Lock()
-		m.current = newState
+		m.commit(metadata)
 		m.mu.Unlock()
+		m.reportWAL(m.writeDone(metadata))
+		m.checkInvariants(metadata)
+		return newState, nil, nil
+	}
+	result := m.transition(metadata, held)
+	m.reportWAL(m.writeDone(metadata))
 
-		// Notify the state change to all subscribers.
-		m.mu.RLock()
-		for _, callback := range m.subscribers {
-			callback(newState)
-		}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.current, result, nil
+}
+
+// unobserved reports whether a state change between the given states can be
+// committed without executing anything else: no lifecycle action, embedded
+// machine, or subscriber is involved. The caller must hold m.mu.
+func (m *FSM) unobserved(from, to string) bool {
+	if len(m.subscribers) > 0 || len(m.lifecycleHooks) > 0 || len(m.invariants) > 0 {
+		return false
+	}
+	if len(m.eventCallbacks) > 0 || len(m.transitionCallbacks) > 0 {
+		return false
+	}
+	if len(m.embedded) > 0 && (m.embedded[from] != nil || m.embedded[to] != nil) {
+		return false
+	}
+	if len(m.enterCallbacks[to]) > 0 || m.results[to] != nil {
+		return false
+	}
+	states := m.table()
+	if s := states[from]; s != nil && s.exit != nil {
+		return false
+	}
+	if s := states[to]; s != nil && (s.enter != nil || s.final) {
+		return false
+	}
+	return true
+}
+
+// commit updates the current state as described by the given metadata,
+// recording and logging the transition, journaling the previous state, and
+// cancelling everything that was scheduled while in it. The caller must hold
+// m.mu for writing.
+func (m *FSM) commit(metadata Metadata) {
+	m.record(metadata)
+	m.appendLog(metadata)
+	m.journalize(metadata.Event, metadata.To)
+	m.current = metadata.To
+	m.epoch++
+	m.cancelScheduled()
+	m.scheduleTimeouts()
+}
+
+// transition moves the FSM to the state described by the given metadata,
+// executing the lifecycle actions and notifying the subscribers. It returns
+// the result of the @enter lifecycle action. Once the state changed, it lends
+// the given level of the transition lock, if not nil, so that the actions done
+// meanwhile run nested.
+func (m *FSM) transition(metadata Metadata, held *level) interface{} {
+	// Execute the @exit lifecycle action, and stop any embedded machine.
+	m.doLifecycle("@exit", metadata)
+	m.stopEmbedded(metadata.From)
+
+	// Execute the action attached to the transition, if any.
+	if metadata.effect != nil {
+		m.protect(metadata, func() { metadata.effect(metadata) })
+	}
+
+	// Update the current state, cancelling everything that was scheduled
+	// while in the previous one.
+	m.mu.Lock()
+	m.commit(metadata)
+	m.mu.Unlock()
+	m.tmu.lend(held)
+
+	// Notify the state change to all subscribers.
+	m.notify(metadata)
+	m.notifyEnter(metadata)
+	m.notifyEvent(metadata)
+
+	// And finally, start any embedded machine, and execute the @enter
+	// lifecycle action.
+	m.startEmbedded(metadata.To, metadata.history)
+	result := m.doLifecycle("@enter", metadata)
+
+	// Check that the invariants hold in the new state.
+	m.checkInvariants(metadata)
+
+	// Deliver the result of the FSM, if the new state is a final one.
+	m.finish(metadata)
+	return result
+}
+
+// notify calls all the subscribers with the given metadata.
+func (m *FSM) notify(metadata Metadata) {
+	m.mu.RLock()
+	if m.tracer != nil && !m.suspended && len(m.subscribers) > 0 {
+		var span Span
+		metadata.Context, span = startSpan(m.tracer, metadata.Context, "fine.notify",
+			Attribute{"fine.subscribers", len(m.subscribers)},
+		)
+		defer span.End(nil)
+	}
+	if m.suspended {
+		m.missed.Store(true)
 		m.mu.RUnlock()
+		return
+	}
 
-		// And finally, execute the @enter lifecycle action.
-		m.doLifecycle("@enter", metadata)
+	// Take a snapshot of the subscribers, which is safe to iterate without
+	// holding the lock, since the slice is only ever appended to or
+	// replaced, so that the callbacks can use the FSM freely.
+	subscribers := m.subscribers
+	m.mu.RUnlock()
+
+	if m.asyncSubscribers {
+		m.post(notification{metadata, subscribers})
+		return
 	}
+	var errs []error
+	for _, s := range subscribers {
+		if m.subscribed(s) && !s.hold(metadata) {
+			if err := m.call(s, metadata); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	// Report the panics of the callbacks.
+	for _, err := range errs {
+		m.report(err)
+	}
+}
 
+func (m *FSM) doLifecycle(action string, metadata Metadata) interface{} {
+	// Look up the precompiled lifecycle action of the current state.
+	var lifecycle hook
 	m.mu.RLock()
-	defer m.mu.RUnlock()
+	current := m.current
+	if s := m.table()[current]; s != nil {
+		if action == "@enter" {
+			lifecycle = s.enter
+		} else {
+			lifecycle = s.exit
+		}
+	}
+	traces := m.lifecycleHooks
+	m.mu.RUnlock()
 
-	return m.current, nil
+	return m.runLifecycle(action, current, lifecycle, traces, metadata)
 }
 
-func (m *FSM) do(action string, args ...interface{}) string {
-	// Execute the action based on the action type.
+// doScopedHook executes the given transition-scoped hook, belonging to the
+// given state.
+func (m *FSM) doScopedHook(kind, state string, lifecycle hook, metadata Metadata) {
 	m.mu.RLock()
-	switch next := m.states[m.current][action].(type) {
-	case nil:
-		defer m.mu.RUnlock()
-		return m.current
+	traces := m.lifecycleHooks
+	m.mu.RUnlock()
 
-	case string:
-		m.mu.RUnlock()
-		return next
+	m.runLifecycle(kind, state, lifecycle, traces, metadata)
+}
 
-	case func():
-		m.mu.RUnlock()
-		next()
+// runLifecycle executes the given lifecycle action, which may be nil, of the
+// given kind and state, reporting it to the given tracing hooks.
+func (m *FSM) runLifecycle(kind, state string, lifecycle hook, traces []lifecycleHook, metadata Metadata) interface{} {
+	// Without tracing hooks, a logger, nor a tracer, just execute the
+	// lifecycle action.
+	if len(traces) == 0 && m.logger == nil && m.tracer == nil {
+		if lifecycle == nil {
+			return nil
+		}
+		return m.runHook(lifecycle, metadata)
+	}
 
-	case func(...interface{}):
-		m.mu.RUnlock()
-		next(args...)
+	// Otherwise, time the lifecycle action and report it.
+	var result interface{}
+	var duration time.Duration
+	if lifecycle != nil {
+		var span Span
+		metadata.Context, span = startSpan(m.tracer, metadata.Context, "fine.lifecycle",
+			Attribute{"fine.action", kind},
+			Attribute{"fine.state", state},
+		)
+		start := m.clock.Now()
+		result = m.runHook(lifecycle, metadata)
+		duration = m.clock.Now().Sub(start)
+		span.End(nil)
+		if m.logger != nil {
+			m.logger.logLifecycle(kind, state, metadata, duration)
+		}
+	}
+	for _, trace := range traces {
+		trace.hook(kind, state, metadata, duration)
+	}
+	return result
+}
 
-	case func() string:
-		m.mu.RUnlock()
-		return next()
+// runHook executes the given lifecycle action, recovering any panic if the FSM
+// uses WithRecover, in which case the result is nil.
+func (m *FSM) runHook(lifecycle hook, metadata Metadata) (result interface{}) {
+	m.protect(metadata, func() { result = lifecycle(m, metadata) })
+	return result
+}
 
-	case func(...interface{}) string:
-		m.mu.RUnlock()
-		return next(args...)
+// OnLifecycle registers a hook that is called after every lifecycle dispatch,
+// for tracing purposes. The hook receives the kind of lifecycle action, either
+// "@enter", "@exit", or the key of a transition-scoped hook such as
+// "@before:event", the state it belongs to, the metadata it received, and how
+// long it ran, measured with the Clock of the FSM. Multiple hooks can be
+// registered, and they run in registration order.
+//
+// The hook is called even for states that do not define the @enter or @exit
+// lifecycle action, reporting a zero duration, so that it observes every state
+// entry and exit. Transition-scoped hooks are reported only when defined.
+// It is not called for the @enter lifecycle action of the initial state, which
+// runs before any hook can be registered.
+//
+// A function to remove the hook is returned.
+func (m *FSM) OnLifecycle(hook func(kind string, state string, metadata Metadata, duration time.Duration)) func() {
+	key := atomic.AddInt32(&m.lastSubKey, 1)
 
-	default:
-		panic(fmt.Sprintf(
-			"invalid type for action %q on state %q", action, m.current,
-		))
+	m.mu.Lock()
+	m.lifecycleHooks = append(m.lifecycleHooks, lifecycleHook{key, hook})
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		// Copy the hooks, since the running lifecycle actions may be
+		// reporting to the current ones.
+		hooks := make([]lifecycleHook, 0, len(m.lifecycleHooks))
+		for _, h := range m.lifecycleHooks {
+			if h.key != key {
+				hooks = append(hooks, h)
+			}
+		}
+		if len(hooks) == 0 {
+			hooks = nil
+		}
+		m.lifecycleHooks = hooks
 	}
+}
+
+// lifecycleHook is a hook registered with OnLifecycle.
+type lifecycleHook struct {
+	key  int32
+	hook func(kind string, state string, metadata Metadata, duration time.Duration)
+}
+
+// OnError registers a hook that receives the errors that cannot be returned
+// to any caller, such as the ones of lifecycle actions under safe dispatch.
+// Multiple hooks can be registered, and they run in registration order.
+func (m *FSM) OnError(hook func(err error)) {
+	m.mu.Lock()
+	m.errorHooks = append(m.errorHooks, hook)
+	m.mu.Unlock()
+}
 
+// report passes the given error to all the hooks registered with OnError.
+func (m *FSM) report(err error) {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
+	hooks := m.errorHooks
+	m.mu.RUnlock()
 
-	return m.current
+	for _, hook := range hooks {
+		hook(err)
+	}
+}
+
+// OnActionError registers a hook that is called whenever the execution of an
+// action fails, and thus the transition is aborted, such as for an action
+// returning an error, or with an invalid type under safe dispatch. The hook receives the action name, its
+// arguments and the error, which is also returned by Do. Multiple hooks can be
+// registered, and they run in registration order.
+//
+// The hooks run after the FSM has been left in the state it had before the
+// failed transition, without holding any lock, so they can use the FSM.
+func (m *FSM) OnActionError(hook func(action string, args []interface{}, err error)) {
+	m.mu.Lock()
+	m.actionErrorHooks = append(m.actionErrorHooks, hook)
+	m.mu.Unlock()
 }
 
-func (m *FSM) doLifecycle(action string, metadata Metadata) {
-	// Execute the action based on the action type.
+// actionFailed passes the given action failure to all the hooks registered
+// with OnActionError.
+func (m *FSM) actionFailed(action string, args []interface{}, err error) {
 	m.mu.RLock()
-	switch lifecycle := m.states[m.current][action].(type) {
-	case nil:
-		m.mu.RUnlock()
-		return
+	hooks := m.actionErrorHooks
+	m.mu.RUnlock()
 
-	case func():
-		m.mu.RUnlock()
-		lifecycle()
+	for _, hook := range hooks {
+		hook(action, args, err)
+	}
+}
 
-	case func(*FSM):
-		m.mu.RUnlock()
-		lifecycle(m)
+// checkActions returns an error wrapping ErrBadActionType if any of the given
+// transitions of the named state has an invalid type, unless the FSM uses
+// safe dispatch.
+func (m *FSM) checkActions(state string, transitions Transitions) error {
+	if m.safeDispatch {
+		return nil
+	}
+	return checkActions(state, transitions)
+}
 
-	case func(Metadata):
-		m.mu.RUnlock()
-		lifecycle(metadata)
+// checkActions returns an error wrapping ErrBadActionType for the first of the
+// given transitions of the named state, in alphabetical order, that has an
+// invalid type.
+func checkActions(state string, transitions Transitions) error {
+	for _, event := range sortedKeys(transitions) {
+		if !validAction(event, transitions[event]) {
+			return badActionType(event, state)
+		}
+	}
+	return nil
+}
 
-	case func(*FSM, Metadata):
-		m.mu.RUnlock()
-		lifecycle(m, metadata)
+// badActionType returns the error for an action with an invalid type.
+func badActionType(action, state string) error {
+	return fmt.Errorf("%w for action %q on state %q", ErrBadActionType, action, state)
+}
+
+// subscriber is a callback registered with Subscribe.
+type subscriber struct {
+	key      int32
+	callback func(metadata Metadata)
+	removed  atomic.Bool
 
-	default:
-		panic(fmt.Sprintf(
-			"invalid type for action %q on state %q", action, m.current,
-		))
+	// The notifications held while the first call is in progress.
+	mu          sync.Mutex
+	subscribing atomic.Bool
+	held        []Metadata
+}
+
+// hold queues the given notification, reporting whether it did, if the first
+// call of the subscriber is still in progress, so that the notification is
+// delivered right after it.
+func (s *subscriber) hold(metadata Metadata) bool {
+	if !s.subscribing.Load() {
+		return false
 	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.subscribing.Load() {
+		return false
+	}
+	s.held = append(s.held, metadata)
+	return true
 }
 
 // Subscribe allows subscribing to state changes with a callback function. The
 // callback function will be executed every time the state changes and receives
 // the new state as a parameter. The callback function also runs when
-// subscribing and will receive the current state.
+// subscribing and will receive the current state. The subscribers are always
+// notified in the order they subscribed.
+//
+// The callback function is called without holding any lock, so it can call
+// any method of the FSM, such as State, Do and Subscribe. An action done from
+// within it runs right away, nested, and its state change is notified to all
+// the subscribers before the remaining ones are notified of the current one.
+// The state changes happening while the callback function receives the
+// current state, when subscribing, are delivered to it right after, in order.
 //
-// An unsubscribe function is returned.
+// An unsubscribe function is returned. It is safe to call it from within the
+// callback function itself, for example to react only once: the callback
+// function is not called anymore after that.
 func (m *FSM) Subscribe(callback func(state string)) func() {
-	key := atomic.AddInt32(&m.lastSubKey, 1)
+	return m.SubscribeMeta(func(metadata Metadata) {
+		callback(metadata.To)
+	})
+}
+
+// SubscribeMeta is like Subscribe, but the callback function receives the
+// metadata of the transition, with the previous state, the event and its
+// arguments, instead of the new state only. When subscribing, and whenever the
+// notification does not come from a single transition, such as when resuming
+// the notifications, only the To field of the metadata is set.
+func (m *FSM) SubscribeMeta(callback func(metadata Metadata)) func() {
+	s := &subscriber{
+		key:      atomic.AddInt32(&m.lastSubKey, 1),
+		callback: callback,
+	}
+
+	s.subscribing.Store(true)
 
 	m.mu.Lock()
-	m.subscribers[key] = callback
-	callback(m.current)
+	m.subscribers = append(m.subscribers, s)
+	current := m.current
 	m.mu.Unlock()
+	m.greet(s, Metadata{To: current})
 
 	return func() {
+		s.removed.Store(true)
+
 		m.mu.Lock()
-		delete(m.subscribers, key)
+		m.removeSubscribers()
 		m.mu.Unlock()
 	}
 }
+
+// greet makes the first call of the given subscriber with the given metadata,
+// and then delivers the notifications held meanwhile, in order, reporting the
+// panics.
+func (m *FSM) greet(s *subscriber, metadata Metadata) {
+	for {
+		if err := m.call(s, metadata); err != nil {
+			m.report(err)
+		}
+
+		s.mu.Lock()
+		if len(s.held) == 0 || !m.subscribed(s) {
+			s.held = nil
+			s.subscribing.Store(false)
+			s.mu.Unlock()
+			return
+		}
+		metadata = s.held[0]
+		s.held = s.held[1:]
+		s.mu.Unlock()
+	}
+}
+
+// SubscribeContext is like Subscribe, but the callback function is
+// unsubscribed automatically as soon as the given context is done. If it is
+// done already, nothing is subscribed. The returned function unsubscribes
+// before that, as for Subscribe.
+func (m *FSM) SubscribeContext(ctx context.Context, callback func(state string)) func() {
+	if ctx.Err() != nil {
+		return func() {}
+	}
+
+	unsubscribe := m.Subscribe(func(state string) {
+		if ctx.Err() == nil {
+			callback(state)
+		}
+	})
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+		unsubscribe()
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+		unsubscribe()
+	}
+}
+
+// SubscribeFunc is like SubscribeMeta, but the callback function only
+// receives the notifications for which the given filter returns true, such as
+// the transitions between specific states, or caused by specific events. The
+// filter also receives the notification made when subscribing, in which only
+// the To field of the metadata is set, and runs in the same way as the callback
+// function, so it must not block.
+func (m *FSM) SubscribeFunc(filter func(metadata Metadata) bool, callback func(metadata Metadata)) func() {
+	return m.SubscribeMeta(func(metadata Metadata) {
+		if filter(metadata) {
+			callback(metadata)
+		}
+	})
+}
+
+// UnsubscribeAll removes all the subscribers, as if each of them was
+// unsubscribed. Like the unsubscribe functions, it is safe to call it from
+// within a subscriber. The callbacks registered with OnEnter and OnEvent are
+// not affected, and neither are the channels returned by Changes, which are
+// not closed, but stop receiving the state changes.
+func (m *FSM) UnsubscribeAll() {
+	// Remove every subscriber registered so far.
+	m.unsubscribed.Store(atomic.LoadInt32(&m.lastSubKey))
+
+	m.mu.Lock()
+	m.removeSubscribers()
+	m.mu.Unlock()
+}
+
+// SubscriberCount returns the number of subscribers.
+func (m *FSM) SubscriberCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, s := range m.subscribers {
+		if m.subscribed(s) {
+			count++
+		}
+	}
+	return count
+}
+
+// removeSubscribers removes the subscribers marked as removed, keeping the
+// order of the other ones. The caller must hold m.mu for writing.
+func (m *FSM) removeSubscribers() {
+	subscribers := make([]*subscriber, 0, len(m.subscribers))
+	for _, s := range m.subscribers {
+		if m.subscribed(s) {
+			subscribers = append(subscribers, s)
+		}
+	}
+	m.subscribers = subscribers
+}
+
+// subscribed reports whether the given subscriber was not removed.
+func (m *FSM) subscribed(s *subscriber) bool {
+	return !s.removed.Load() && s.key > m.unsubscribed.Load()
+}
@@ -1,13 +1,18 @@
 package fine_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math/rand"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"interrato.dev/fine"
+	"interrato.dev/fine/finetest"
 )
 
 const concurrentRuns = 200
@@ -210,6 +215,140 @@ func TestAddOrMerge(t *testing.T) {
 	}
 }
 
+func TestAddOrMergeChecked(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"next": "b",
+			"stay": nil,
+			"back": "a",
+		},
+		"b": {
+			"next": "a",
+		},
+	})
+
+	// Test that only the events whose action changed type are reported.
+	changed, err := machine.AddOrMergeChecked("a", fine.Transitions{
+		"next": func() string { return "b" },
+		"stay": "b",
+		"back": "b",
+		"new":  "b",
+	})
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	want := []string{"next", "stay"}
+	if len(changed) != len(want) {
+		t.Fatalf("wrong changed events: got %v, want %v", changed, want)
+	}
+	for i := range want {
+		if changed[i] != want[i] {
+			t.Fatalf("wrong changed events: got %v, want %v", changed, want)
+		}
+	}
+
+	// Test that the merge was performed anyway.
+	if state, _ := machine.Do("back"); state != "b" {
+		t.Fatalf("wrong state: got %q, want %q", state, "b")
+	}
+
+	// Test that adding a new state reports nothing.
+	changed, err = machine.AddOrMergeChecked("c", fine.Transitions{"next": "a"})
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if len(changed) != 0 {
+		t.Fatalf("no changed events expected, got: %v", changed)
+	}
+
+	// Test that an invalid action type is rejected without merging.
+	_, err = machine.AddOrMergeChecked("b", fine.Transitions{
+		"next": "c",
+		"bad":  42,
+	})
+	if !errors.Is(err, fine.ErrBadActionType) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrBadActionType)
+	}
+	if state, _ := machine.Do("next"); state != "a" {
+		t.Fatalf("wrong state: got %q, want %q", state, "a")
+	}
+
+	// Test that with WithSafeDispatch invalid types are merged anyway.
+	machine = fine.Machine("a", fine.States{"a": {}}, fine.WithSafeDispatch())
+	if _, err := machine.AddOrMergeChecked("a", fine.Transitions{"bad": 42}); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if _, err := machine.Do("bad"); !errors.Is(err, fine.ErrBadActionType) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrBadActionType)
+	}
+}
+
+func TestDeepMerge(t *testing.T) {
+	machine := fine.Machine("idle", fine.States{
+		"idle": {
+			"signal": fine.Dispatch{"red": "stopped", "green": "running"},
+			"reset":  "idle",
+		},
+		"stopped": {"reset": "idle"},
+		"running": {"reset": "idle"},
+		"paused":  {"reset": "idle"},
+	})
+
+	// Test that dispatch tables are merged, with newer keys winning, while
+	// other actions are replaced.
+	err := machine.DeepMerge("idle", fine.Transitions{
+		"signal": fine.Dispatch{"yellow": "paused", "green": "paused"},
+		"reset":  "stopped",
+	})
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	tests := []struct {
+		event, arg, want string
+	}{
+		{"signal", "red", "stopped"},
+		{"signal", "yellow", "paused"},
+		{"signal", "green", "paused"},
+		{"reset", "", "stopped"},
+	}
+	for _, tt := range tests {
+		if state, _ := machine.Do(tt.event, tt.arg); state != tt.want {
+			t.Fatalf("wrong state: got %q, want %q", state, tt.want)
+		}
+		machine.Do("reset")
+	}
+
+	// Test that a change of type replaces the dispatch table.
+	err = machine.DeepMerge("idle", fine.Transitions{"signal": "running"})
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if state, _ := machine.Do("signal", "red"); state != "running" {
+		t.Fatalf("wrong state: got %q, want %q", state, "running")
+	}
+
+	// Test that an invalid action type is rejected without merging.
+	err = machine.DeepMerge("running", fine.Transitions{
+		"reset": "paused",
+		"bad":   42,
+	})
+	if !errors.Is(err, fine.ErrBadActionType) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrBadActionType)
+	}
+	if state, _ := machine.Do("reset"); state != "idle" {
+		t.Fatalf("wrong state: got %q, want %q", state, "idle")
+	}
+
+	// Test that with WithSafeDispatch invalid types are merged anyway.
+	machine = fine.Machine("idle", fine.States{"idle": {}}, fine.WithSafeDispatch())
+	if err := machine.DeepMerge("idle", fine.Transitions{"bad": 42}); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if _, err := machine.Do("bad"); !errors.Is(err, fine.ErrBadActionType) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrBadActionType)
+	}
+}
+
 func TestExists(t *testing.T) {
 	machine := fine.Machine("a", fine.States{
 		"a": {
@@ -254,6 +393,31 @@ func TestExists(t *testing.T) {
 	}
 }
 
+func TestStatesMissing(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b", "cancel": "a"},
+		"b": {"next": "c"},
+		"c": {"next": "d", "cancel": nil},
+		"d": {},
+	})
+
+	// Test that all and only the states missing the event are returned, in
+	// alphabetical order.
+	want := []string{"b", "d"}
+	got := machine.StatesMissing("cancel")
+	if len(got) != len(want) {
+		t.Fatalf("wrong states: got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("wrong states: got %v, want %v", got, want)
+		}
+	}
+	if got := machine.StatesMissing("next"); len(got) != 1 || got[0] != "d" {
+		t.Fatalf("wrong states: got %v, want [d]", got)
+	}
+}
+
 func TestDo(t *testing.T) {
 	machine := fine.Machine("a", fine.States{
 		"a": {
@@ -299,6 +463,511 @@ func TestDo(t *testing.T) {
 	}
 }
 
+func TestDoSync(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"next": "a"},
+	})
+	var notified []string
+	machine.Subscribe(func(state string) {
+		notified = append(notified, state)
+	})
+
+	// Test that the subscribers have been notified when DoSync returns.
+	state, err := machine.DoSync("next")
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if len(notified) != 2 || notified[1] != state {
+		t.Fatalf("wrong notifications: got %v, want %v", notified, []string{"a", state})
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	machine := fine.Machine("running", fine.States{
+		"running": {
+			"signal": fine.Dispatch{"red": "stopped", "green": "running"},
+		},
+		"stopped": {
+			"signal": fine.Dispatch{
+				"green":              "running",
+				fine.DispatchDefault: "broken",
+			},
+		},
+		"broken": {},
+	})
+
+	for _, tc := range []struct {
+		args []interface{}
+		want string
+	}{
+		{[]interface{}{"green"}, "running"},
+		{[]interface{}{"yellow"}, "running"},
+		{nil, "running"},
+		{[]interface{}{"red"}, "stopped"},
+		{[]interface{}{"green", "ignored"}, "running"},
+		{[]interface{}{"red"}, "stopped"},
+		{nil, "broken"},
+	} {
+		state, err := machine.Do("signal", tc.args...)
+		if err != nil {
+			t.Fatalf("no error expected, got: %v", err)
+		}
+		if state != tc.want {
+			t.Fatalf("wrong state for %v: got %q, want %q", tc.args, state, tc.want)
+		}
+	}
+}
+
+func TestDoWithLifecycleResult(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"next": "b",
+		},
+		"b": {
+			"@enter": func(metadata fine.Metadata) interface{} {
+				return "entered from " + metadata.From
+			},
+			"next": "c",
+			"stay": nil,
+		},
+		"c": {
+			"@enter": func() {},
+		},
+	})
+
+	// Test that the result of the @enter lifecycle action is returned.
+	state, result, err := machine.DoWithLifecycleResult("next")
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if state != "b" || result != "entered from a" {
+		t.Fatalf("wrong result: got (%q, %v), want (%q, %q)", state, result, "b", "entered from a")
+	}
+
+	// Test that no result is returned without a state change, or when the
+	// @enter lifecycle action returns nothing.
+	if _, result, _ := machine.DoWithLifecycleResult("stay"); result != nil {
+		t.Fatalf("no result expected, got: %v", result)
+	}
+	if _, result, _ := machine.DoWithLifecycleResult("next"); result != nil {
+		t.Fatalf("no result expected, got: %v", result)
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	type key struct{}
+	var values []interface{}
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"@exit": func(metadata fine.Metadata) {
+				values = append(values, metadata.Value(key{}))
+			},
+			"next": "b",
+		},
+		"b": {
+			"@enter": func(metadata fine.Metadata) {
+				values = append(values, metadata.Value(key{}))
+			},
+			"next": "a",
+		},
+	})
+
+	// Test that the context values reach the lifecycle actions.
+	ctx := context.WithValue(context.Background(), key{}, "trace")
+	if _, err := machine.DoContext(ctx, "next"); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if len(values) != 2 || values[0] != "trace" || values[1] != "trace" {
+		t.Fatalf("wrong values: got %v, want [trace trace]", values)
+	}
+
+	// Test that without a context there are no values.
+	values = nil
+	machine.Do("next")
+	machine.Do("next")
+	if len(values) != 2 || values[0] != nil || values[1] != nil {
+		t.Fatalf("wrong values: got %v, want [<nil> <nil>]", values)
+	}
+
+	// Test that a done context prevents the execution.
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := machine.DoContext(ctx, "next"); err != context.Canceled {
+		t.Fatalf("wrong error: got %v, want %v", err, context.Canceled)
+	}
+	if state := machine.State(); state != "b" {
+		t.Fatalf("wrong state: got %q, want %q", state, "b")
+	}
+}
+
+func TestContextActions(t *testing.T) {
+	type key struct{}
+	var values []interface{}
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"next": func(ctx context.Context, args ...interface{}) string {
+				values = append(values, ctx.Value(key{}))
+				return "b"
+			},
+		},
+		"b": {
+			"@enter": func(ctx context.Context) {
+				values = append(values, ctx.Value(key{}))
+			},
+			"next": func(ctx context.Context) string {
+				if ctx.Err() != nil {
+					return "b"
+				}
+				return "a"
+			},
+		},
+	})
+
+	// Test that the context reaches the actions and lifecycle actions.
+	ctx := context.WithValue(context.Background(), key{}, "trace")
+	if _, err := machine.DoContext(ctx, "next"); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if len(values) != 2 || values[0] != "trace" || values[1] != "trace" {
+		t.Fatalf("wrong values: got %v, want [trace trace]", values)
+	}
+
+	// Test that without a context the actions receive a non-nil one.
+	if state, _ := machine.Do("next"); state != "a" {
+		t.Fatalf("wrong state: got %q, want %q", state, "a")
+	}
+	values = nil
+	machine.Do("next")
+	if len(values) != 2 || values[0] != nil || values[1] != nil {
+		t.Fatalf("wrong values: got %v, want [<nil> <nil>]", values)
+	}
+}
+
+func TestErrorActions(t *testing.T) {
+	errDenied := errors.New("denied")
+	var entered, failed int
+	machine := fine.Machine("locked", fine.States{
+		"locked": {
+			"unlock": func(args ...interface{}) (string, error) {
+				if len(args) == 0 || args[0] != "secret" {
+					return "", errDenied
+				}
+				return "unlocked", nil
+			},
+		},
+		"unlocked": {
+			"@enter": func() { entered++ },
+			"lock":   func() (string, error) { return "locked", nil },
+		},
+	})
+	machine.OnActionError(func(string, []interface{}, error) { failed++ })
+
+	// Test that a failing action aborts the transition.
+	state, err := machine.Do("unlock", "wrong")
+	if !errors.Is(err, errDenied) {
+		t.Fatalf("wrong error: got %v, want %v", err, errDenied)
+	}
+	if state != "locked" || machine.State() != "locked" || entered != 0 || failed != 1 {
+		t.Fatalf("wrong state: got %q, want %q", machine.State(), "locked")
+	}
+
+	// Test that a succeeding action changes the state.
+	for _, tc := range []struct {
+		action, want string
+		args         []interface{}
+	}{
+		{"unlock", "unlocked", []interface{}{"secret"}},
+		{"lock", "locked", nil},
+	} {
+		if state, err := machine.Do(tc.action, tc.args...); err != nil || state != tc.want {
+			t.Fatalf("wrong state: got %q (%v), want %q", state, err, tc.want)
+		}
+	}
+	if entered != 1 || failed != 1 {
+		t.Fatalf("wrong counts: got %d entries and %d failures, want 1 and 1", entered, failed)
+	}
+}
+
+func TestSafeDispatch(t *testing.T) {
+	states := fine.States{
+		"a": {
+			"@exit": 42,
+			"bad":   42,
+			"next":  "b",
+		},
+		"b": {},
+	}
+
+	// Test that without safe dispatch a malformed action panics, as soon as
+	// the FSM is created.
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic expected")
+			}
+		}()
+		fine.Machine("a", states).Do("bad")
+	}()
+
+	// Test that with safe dispatch a malformed action returns an error.
+	machine := fine.Machine("a", states, fine.WithSafeDispatch())
+	var reported []error
+	machine.OnError(func(err error) {
+		reported = append(reported, err)
+	})
+	_, err := machine.Do("bad")
+	if !errors.Is(err, fine.ErrBadActionType) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrBadActionType)
+	}
+	if state := machine.State(); state != "a" {
+		t.Fatalf("wrong state: got %q, want %q", state, "a")
+	}
+
+	// Test that a malformed lifecycle action is skipped and reported.
+	if state, err := machine.Do("next"); err != nil || state != "b" {
+		t.Fatalf("wrong result: got (%q, %v), want (%q, <nil>)", state, err, "b")
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], fine.ErrBadActionType) {
+		t.Fatalf("wrong reported errors: got %v", reported)
+	}
+}
+
+func TestActionTypeChecking(t *testing.T) {
+	states := fine.States{
+		"a": {"next": "b"},
+		"b": {"bad": 42, "worse": []string{}},
+	}
+
+	// Test that the FSM panics at its creation, describing the first
+	// malformed action.
+	func() {
+		defer func() {
+			err, _ := recover().(error)
+			if !errors.Is(err, fine.ErrBadActionType) {
+				t.Fatalf("wrong panic: got %v, want %v", err, fine.ErrBadActionType)
+			}
+			if want := `invalid action type for action "bad" on state "b"`; err.Error() != want {
+				t.Fatalf("wrong panic: got %q, want %q", err, want)
+			}
+		}()
+		fine.Machine("a", states)
+	}()
+
+	// Test that the states added later are checked too.
+	machine := fine.Machine("a", fine.States{"a": {}})
+	if err := machine.Add("b", states["b"]); !errors.Is(err, fine.ErrBadActionType) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrBadActionType)
+	}
+	for _, add := range []func(string, fine.Transitions){machine.AddOrReplace, machine.AddOrMerge} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("panic expected")
+				}
+			}()
+			add("b", states["b"])
+		}()
+	}
+	if states := machine.States(); len(states) != 1 {
+		t.Fatalf("wrong states: got %v, want [a]", states)
+	}
+
+	// Test that safe dispatch disables the checks.
+	machine = fine.Machine("a", states, fine.WithSafeDispatch())
+	if err := machine.Add("c", states["b"]); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+}
+
+func TestOnActionError(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"bad":  42,
+			"next": "b",
+		},
+		"b": {},
+	}, fine.WithSafeDispatch())
+
+	type failure struct {
+		action string
+		args   []interface{}
+		err    error
+		state  string
+	}
+	var failures []failure
+	machine.OnActionError(func(action string, args []interface{}, err error) {
+		// The FSM must be usable from within the hook.
+		failures = append(failures, failure{action, args, err, machine.State()})
+	})
+
+	// Test that the hook is called for failed actions only.
+	machine.Do("bad", "arg")
+	machine.Do("next")
+	if len(failures) != 1 {
+		t.Fatalf("wrong number of failures: got %v, want 1", len(failures))
+	}
+	f := failures[0]
+	if f.action != "bad" || len(f.args) != 1 || f.args[0] != "arg" || f.state != "a" {
+		t.Fatalf("wrong failure: got %+v", f)
+	}
+	if !errors.Is(f.err, fine.ErrBadActionType) {
+		t.Fatalf("wrong error: got %v, want %v", f.err, fine.ErrBadActionType)
+	}
+}
+
+func TestOnLifecycle(t *testing.T) {
+	clock := finetest.NewClock(time.Unix(0, 0))
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"@exit": func() {
+				clock.Advance(time.Second)
+			},
+			"next": "b",
+		},
+		"b": {
+			"next": "a",
+		},
+	}, fine.WithClock(clock))
+
+	var traces []string
+	remove := machine.OnLifecycle(func(kind, state string, metadata fine.Metadata, duration time.Duration) {
+		traces = append(traces, fmt.Sprintf(
+			"%s %s (%s -> %s) %v", kind, state, metadata.From, metadata.To, duration,
+		))
+	})
+
+	// Test that every lifecycle dispatch is traced, including the ones of
+	// lifecycle actions that are not defined.
+	machine.Do("next")
+	machine.Do("next")
+	want := []string{
+		"@exit a (a -> b) 1s",
+		"@enter b (a -> b) 0s",
+		"@exit b (b -> a) 0s",
+		"@enter a (b -> a) 0s",
+	}
+	if len(traces) != len(want) {
+		t.Fatalf("wrong traces: got %v, want %v", traces, want)
+	}
+	for i := range want {
+		if traces[i] != want[i] {
+			t.Fatalf("wrong traces: got %v, want %v", traces, want)
+		}
+	}
+
+	// Test that a removed hook is not called anymore.
+	remove()
+	machine.Do("next")
+	if len(traces) != len(want) {
+		t.Fatalf("wrong traces: got %v, want %v", traces, want)
+	}
+}
+
+func TestScopedHooks(t *testing.T) {
+	var calls []string
+	record := func(name string) func(fine.Metadata) {
+		return func(metadata fine.Metadata) {
+			calls = append(calls, fmt.Sprintf(
+				"%s %s->%s", name, metadata.From, metadata.To,
+			))
+		}
+	}
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"@exit":        record("@exit"),
+			"@before:next": record("@before"),
+			"@after:next":  record("@after"),
+			"next": func() string {
+				calls = append(calls, "next")
+				return "b"
+			},
+			"@before:stay": record("@before"),
+			"@after:stay":  record("@after"),
+			"stay":         nil,
+			"@after:other": record("@after"),
+		},
+		"b": {
+			"@enter": record("@enter"),
+		},
+	})
+
+	// Test that the hooks are called around the action of the same event,
+	// even when the state does not change.
+	machine.Do("stay")
+	want := []string{"@before a->", "@after a->a"}
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Fatalf("wrong calls: got %v, want %v", calls, want)
+	}
+
+	// Test that the hooks are called in the right order with respect to the
+	// lifecycle actions.
+	calls = nil
+	machine.Do("next")
+	want = []string{
+		"@before a->",
+		"next",
+		"@exit a->b",
+		"@enter a->b",
+		"@after a->b",
+	}
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Fatalf("wrong calls: got %v, want %v", calls, want)
+	}
+
+	// Test that the hooks cannot be done as actions.
+	if _, err := machine.Do("@before:next"); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+}
+
+func TestLifecycleMutations(t *testing.T) {
+	for _, opts := range [][]fine.Option{nil, {fine.WithCopyOnWrite()}} {
+		machine := fine.Machine("a", fine.States{
+			"a": {
+				"next": "b",
+				"@exit": func(this *fine.FSM) {
+					this.Add("c", fine.Transitions{"next": "a"})
+				},
+			},
+			"b": {
+				"@enter": func(this *fine.FSM) {
+					this.AddOrMerge("b", fine.Transitions{"next": "c"})
+					this.AddOrMerge("a", fine.Transitions{"skip": "c"})
+				},
+			},
+		}, opts...)
+
+		// Test that lifecycle actions can change the FSM without deadlocks.
+		done := make(chan string)
+		go func() {
+			state, _ := machine.Do("next")
+			done <- state
+		}()
+		select {
+		case state := <-done:
+			if state != "b" {
+				t.Fatalf("wrong state: got %q, want %q", state, "b")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("deadlock in lifecycle actions")
+		}
+
+		// Test that the changes are all applied.
+		for _, tc := range []struct {
+			action, want string
+		}{
+			{"next", "c"},
+			{"next", "a"},
+			{"skip", "c"},
+		} {
+			if state, err := machine.Do(tc.action); err != nil || state != tc.want {
+				t.Fatalf("wrong state: got %q (%v), want %q", state, err, tc.want)
+			}
+		}
+	}
+}
+
 func TestSubscribe(t *testing.T) {
 	machine := fine.Machine("a", fine.States{
 		"a": {
@@ -357,3 +1026,414 @@ func TestSubscribe(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestSubscribeMeta(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"next": "a"},
+	})
+
+	// Test that the subscribers receive the whole metadata of the transitions.
+	var got []fine.Metadata
+	unsubscribe := machine.SubscribeMeta(func(metadata fine.Metadata) {
+		got = append(got, metadata)
+	})
+	machine.Do("next", 42)
+	if len(got) != 2 {
+		t.Fatalf("wrong notifications: got %d, want 2", len(got))
+	}
+	if md := got[0]; md.To != "a" || md.From != "" || md.Event != "" {
+		t.Fatalf("wrong initial metadata: got %+v, want only To %q", md, "a")
+	}
+	md := got[1]
+	if md.From != "a" || md.To != "b" || md.Event != "next" || len(md.Args) != 1 || md.Args[0] != 42 {
+		t.Fatalf("wrong metadata: got %+v", md)
+	}
+
+	// Test that unsubscribing stops the notifications.
+	unsubscribe()
+	machine.Do("next")
+	if len(got) != 2 {
+		t.Fatalf("wrong notifications: got %d, want 2", len(got))
+	}
+
+	// Concurrency test (run with `-race`).
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unsubscribe := machine.SubscribeMeta(func(fine.Metadata) {})
+			machine.Do("next")
+			unsubscribe()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSubscribeContext(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"next": "a"},
+	})
+
+	// Test that the subscriber is removed once the context is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	var notified []string
+	machine.SubscribeContext(ctx, func(state string) {
+		notified = append(notified, state)
+	})
+	machine.Do("next")
+	cancel()
+	machine.Do("next")
+	want := []string{"a", "b"}
+	if fmt.Sprint(notified) != fmt.Sprint(want) {
+		t.Fatalf("wrong notifications: got %v, want %v", notified, want)
+	}
+	for machine.SubscriberCount() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Test that nothing is subscribed with a context done already.
+	machine.SubscribeContext(ctx, func(string) {
+		t.Fatal("unexpected notification")
+	})
+	machine.Do("next")
+
+	// Test that the returned function unsubscribes before the context is
+	// done.
+	unsubscribe := machine.SubscribeContext(context.Background(), func(string) {})
+	unsubscribe()
+	unsubscribe()
+	if count := machine.SubscriberCount(); count != 0 {
+		t.Fatalf("wrong subscriber count: got %d, want 0", count)
+	}
+}
+
+func TestSubscribeFunc(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b", "skip": "c"},
+		"b": {"next": "c"},
+		"c": {"next": "a"},
+	})
+
+	// Test that only the notifications matching the filter are received.
+	var got []string
+	unsubscribe := machine.SubscribeFunc(func(metadata fine.Metadata) bool {
+		return metadata.Event == "next" && metadata.From != "c"
+	}, func(metadata fine.Metadata) {
+		got = append(got, metadata.From+" -> "+metadata.To)
+	})
+	for _, action := range []string{"next", "next", "next", "skip", "next"} {
+		machine.Do(action)
+	}
+	want := []string{"a -> b", "b -> c"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("wrong notifications: got %v, want %v", got, want)
+	}
+
+	// Test that unsubscribing stops the notifications.
+	unsubscribe()
+	machine.Do("next")
+	if len(got) != 2 {
+		t.Fatalf("wrong notifications: got %v, want %v", got, want)
+	}
+}
+
+func TestSubscribeOrder(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"next": "a"},
+	})
+
+	// Test that the subscribers are notified in the order they subscribed,
+	// even after some of them unsubscribed.
+	var order []int
+	unsubscribes := make([]func(), 10)
+	for i := range unsubscribes {
+		i := i
+		unsubscribes[i] = machine.Subscribe(func(string) {
+			order = append(order, i)
+		})
+	}
+	unsubscribes[3]()
+	unsubscribes[7]()
+	order = nil
+	machine.Do("next")
+	want := []int{0, 1, 2, 4, 5, 6, 8, 9}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Fatalf("wrong order: got %v, want %v", order, want)
+	}
+}
+
+func TestSubscriberReentrancy(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"next": "c"},
+		"c": {},
+	})
+
+	// Test that a subscriber can use the FSM, doing an action whose state
+	// change is notified to everyone before the current one goes on.
+	var got []string
+	machine.Subscribe(func(state string) {
+		got = append(got, "first "+state+" "+machine.State())
+		if state == "b" {
+			machine.Do("next")
+		}
+	})
+	machine.Subscribe(func(state string) {
+		got = append(got, "second "+state)
+	})
+	got = nil
+	machine.Do("next")
+	want := []string{"first b b", "first c c", "second c", "second b"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("wrong notifications: got %q, want %q", got, want)
+	}
+
+	// Test that a subscriber can subscribe, and that the state changes
+	// happening during the first call are delivered right after it.
+	machine = fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"next": "c"},
+		"c": {},
+	})
+	got = nil
+	machine.Subscribe(func(state string) {
+		got = append(got, state)
+		if state == "a" {
+			machine.Subscribe(func(string) {})
+			machine.Do("next")
+			got = append(got, "subscribed")
+		}
+	})
+	want = []string{"a", "subscribed", "b"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("wrong notifications: got %q, want %q", got, want)
+	}
+}
+
+func TestUnsubscribeAll(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"next": "a"},
+	})
+
+	notified := 0
+	for i := 0; i < 3; i++ {
+		machine.Subscribe(func(string) { notified++ })
+	}
+	unsubscribe := machine.Subscribe(func(string) { notified++ })
+	unsubscribe()
+	if count := machine.SubscriberCount(); count != 3 {
+		t.Fatalf("wrong subscriber count: got %d, want 3", count)
+	}
+
+	// Test that all the subscribers are removed, even from within one of
+	// them, which is not called anymore after that.
+	subscribed := false
+	machine.Subscribe(func(string) {
+		if subscribed {
+			machine.UnsubscribeAll()
+		}
+		subscribed = true
+	})
+	machine.Subscribe(func(string) { notified++ })
+	notified = 0
+	machine.Do("next")
+	if notified != 3 {
+		t.Fatalf("wrong notifications: got %d, want 3", notified)
+	}
+	if count := machine.SubscriberCount(); count != 0 {
+		t.Fatalf("wrong subscriber count: got %d, want 0", count)
+	}
+	machine.Do("next")
+	if notified != 3 {
+		t.Fatalf("wrong notifications: got %d, want 3", notified)
+	}
+
+	// Test that new subscribers are not affected.
+	machine.Subscribe(func(string) { notified++ })
+	if count := machine.SubscriberCount(); count != 1 {
+		t.Fatalf("wrong subscriber count: got %d, want 1", count)
+	}
+
+	// Concurrency test (run with `-race`).
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			machine.Subscribe(func(string) {})
+			machine.Do("next")
+			machine.SubscriberCount()
+			machine.UnsubscribeAll()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSubscribeUnsubscribeItself(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"next": "a"},
+	})
+
+	// Test that a subscriber can unsubscribe itself from its callback.
+	var once, all []string
+	var unsubscribe func()
+	unsubscribe = machine.Subscribe(func(state string) {
+		if unsubscribe == nil {
+			return // Skip the initial notification.
+		}
+		once = append(once, state)
+		unsubscribe()
+	})
+	machine.Subscribe(func(state string) {
+		all = append(all, state)
+	})
+	machine.Do("next")
+	machine.Do("next")
+	machine.Do("next")
+	if len(once) != 1 || once[0] != "b" {
+		t.Fatalf("wrong notifications: got %v, want %v", once, []string{"b"})
+	}
+
+	// Test that the other subscribers and the FSM are unaffected.
+	want := []string{"a", "b", "a", "b"}
+	if fmt.Sprint(all) != fmt.Sprint(want) {
+		t.Fatalf("wrong notifications: got %v, want %v", all, want)
+	}
+	if state := machine.State(); state != "b" {
+		t.Fatalf("wrong state: got %q, want %q", state, "b")
+	}
+
+	// Concurrency test (run with `-race`).
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var unsubscribe func()
+			var mu sync.Mutex
+			mu.Lock()
+			unsubscribe = machine.Subscribe(func(string) {
+				if mu.TryLock() {
+					unsubscribe()
+				}
+			})
+			mu.Unlock()
+			machine.Do("next")
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkDoStringTarget(b *testing.B) {
+	machine := fine.Machine("off", fine.States{
+		"off": {"toggle": "on"},
+		"on":  {"toggle": "off"},
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		machine.Do("toggle")
+	}
+}
+
+func BenchmarkDoFuncTarget(b *testing.B) {
+	machine := fine.Machine("off", fine.States{
+		"off": {"toggle": func() string { return "on" }},
+		"on":  {"toggle": func(args ...interface{}) string { return "off" }},
+	})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		machine.Do("toggle")
+	}
+}
+
+func BenchmarkDoSubscribed(b *testing.B) {
+	machine := fine.Machine("off", fine.States{
+		"off": {"toggle": "on"},
+		"on":  {"toggle": "off"},
+	})
+	unsubscribe := machine.Subscribe(func(state string) {})
+	defer unsubscribe()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		machine.Do("toggle")
+	}
+}
+
+func BenchmarkDoLifecycle(b *testing.B) {
+	var enters, exits int
+	machine := fine.Machine("off", fine.States{
+		"off": {
+			"@enter": func() { enters++ },
+			"@exit":  func(this *fine.FSM) { exits++ },
+			"toggle": "on",
+		},
+		"on": {
+			"@enter": func(metadata fine.Metadata) { enters++ },
+			"@exit":  func(this *fine.FSM, metadata fine.Metadata) { exits++ },
+			"toggle": "off",
+		},
+	})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		machine.Do("toggle")
+	}
+}
+
+func TestSerializedTransitions(t *testing.T) {
+	// The number of transitions in progress, which must never be more than
+	// one while an action is running.
+	var inProgress int32
+	var violations int32
+	action := func(target string) func() string {
+		return func() string {
+			if atomic.AddInt32(&inProgress, 1) != 1 {
+				atomic.AddInt32(&violations, 1)
+			}
+			return target
+		}
+	}
+	done := func() { atomic.AddInt32(&inProgress, -1) }
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"next":        action("b"),
+			"@after:next": done,
+			"@exit":       func() { time.Sleep(10 * time.Microsecond) },
+		},
+		"b": {
+			"next":        action("a"),
+			"@after:next": done,
+			"@exit":       func() { time.Sleep(10 * time.Microsecond) },
+		},
+	})
+
+	// Concurrency test (run with `-race`): test that no action ever runs
+	// while another transition is in progress.
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			machine.Do("next")
+		}()
+	}
+	wg.Wait()
+
+	if violations != 0 {
+		t.Fatalf("wrong number of overlapping transitions: got %d, want 0", violations)
+	}
+	if state := machine.State(); state != "a" {
+		t.Fatalf("wrong state: got %q, want %q", state, "a")
+	}
+}
@@ -0,0 +1,251 @@
+// Package finemetrics collects uniform metrics of the fine finite-state
+// machines, and exposes them in the Prometheus text format, so that they can
+// be scraped by Prometheus without depending on its client library:
+//
+//	metrics := finemetrics.New("orders")
+//	machine := fine.Machine("created", states, metrics.Instrument("checkout"))
+//	http.Handle("/metrics", metrics)
+//
+// The following metrics are exposed, with the given namespace as prefix, and
+// the name given to Instrument as the machine label:
+//
+//   - fine_transitions_total, the counter of the events done, by machine, from,
+//     to and event;
+//   - fine_rejected_events_total, the counter of the rejected or failed events,
+//     by machine, from and event;
+//   - fine_transition_duration_seconds, the histogram of the durations of the
+//     events done, by machine and event;
+//   - fine_state_duration_seconds, the histogram of the time spent in each
+//     state before leaving it, by machine and state.
+package finemetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"interrato.dev/fine"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets of the
+// histograms, which are the default ones of Prometheus.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics collects the metrics of any number of machines. It is an
+// http.Handler serving them in the Prometheus text format.
+type Metrics struct {
+	namespace string
+
+	mu          sync.Mutex
+	transitions map[string]float64
+	rejected    map[string]float64
+	durations   map[string]*histogram
+	states      map[string]*histogram
+}
+
+// histogram is a Prometheus histogram with the default buckets.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// observe records the given value, in seconds.
+func (h *histogram) observe(seconds float64) {
+	for i, bound := range DefaultBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// New returns a Metrics whose metric names are prefixed with the given
+// namespace, if not empty.
+func New(namespace string) *Metrics {
+	return &Metrics{
+		namespace:   namespace,
+		transitions: make(map[string]float64),
+		rejected:    make(map[string]float64),
+		durations:   make(map[string]*histogram),
+		states:      make(map[string]*histogram),
+	}
+}
+
+// Instrument returns an option making an FSM report its metrics, with the
+// given name as machine label. The time spent in the initial state is measured
+// from the creation of the FSM.
+//
+// The metrics are collected from the events done, as reported by the OnDone
+// method of fine.FSM, so the state changes of Undo, Reset and of the rollbacks
+// of Atomic are not counted.
+func (r *Metrics) Instrument(machine string) fine.Option {
+	return func(m *fine.FSM) {
+		var mu sync.Mutex
+		entered := time.Now()
+		m.OnDone(func(metadata fine.Metadata, duration time.Duration, err error) {
+			if err != nil {
+				r.add(r.rejected, labels("machine", machine, "from", metadata.From, "event", metadata.Event))
+				return
+			}
+
+			var inState time.Duration
+			changed := metadata.From != metadata.To
+			if changed {
+				mu.Lock()
+				now := time.Now()
+				inState, entered = now.Sub(entered), now
+				mu.Unlock()
+			}
+
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			r.transitions[labels(
+				"machine", machine,
+				"from", metadata.From,
+				"to", metadata.To,
+				"event", metadata.Event,
+			)]++
+			r.histogram(r.durations, labels("machine", machine, "event", metadata.Event)).observe(duration.Seconds())
+			if changed {
+				r.histogram(r.states, labels("machine", machine, "state", metadata.From)).observe(inState.Seconds())
+			}
+		})
+	}
+}
+
+// add increments the counter with the given labels.
+func (r *Metrics) add(counters map[string]float64, labels string) {
+	r.mu.Lock()
+	counters[labels]++
+	r.mu.Unlock()
+}
+
+// histogram returns the histogram with the given labels, creating it if
+// needed. The caller must hold r.mu.
+func (r *Metrics) histogram(histograms map[string]*histogram, labels string) *histogram {
+	h, ok := histograms[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(DefaultBuckets))}
+		histograms[labels] = h
+	}
+	return h
+}
+
+// WriteTo writes all the metrics to w in the Prometheus text format, sorted by
+// name and labels.
+func (r *Metrics) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	r.writeCounter(cw, "fine_transitions_total",
+		"Events done by the state machines.", r.transitions)
+	r.writeCounter(cw, "fine_rejected_events_total",
+		"Events rejected by the state machines, or whose actions failed.", r.rejected)
+	r.writeHistogram(cw, "fine_transition_duration_seconds",
+		"Durations of the events done by the state machines.", r.durations)
+	r.writeHistogram(cw, "fine_state_duration_seconds",
+		"Time spent by the state machines in each state before leaving it.", r.states)
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP serves all the metrics in the Prometheus text format.
+func (r *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// name returns the full name of the given metric.
+func (r *Metrics) name(metric string) string {
+	if r.namespace == "" {
+		return metric
+	}
+	return r.namespace + "_" + metric
+}
+
+// writeCounter writes the given counters.
+func (r *Metrics) writeCounter(w *countingWriter, metric, help string, counters map[string]float64) {
+	name := r.name(metric)
+	w.printf("# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, labels := range sortedKeys(counters) {
+		w.printf("%s{%s} %s\n", name, labels, formatFloat(counters[labels]))
+	}
+}
+
+// writeHistogram writes the given histograms.
+func (r *Metrics) writeHistogram(w *countingWriter, metric, help string, histograms map[string]*histogram) {
+	name := r.name(metric)
+	w.printf("# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, labels := range sortedKeys(histograms) {
+		h := histograms[labels]
+		for i, bound := range DefaultBuckets {
+			w.printf("%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(bound), h.counts[i])
+		}
+		w.printf("%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+		w.printf("%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+		w.printf("%s_count{%s} %d\n", name, labels, h.count)
+	}
+}
+
+// labels returns the Prometheus form of the given label names and values.
+func labels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+// labelEscaper escapes the label values as the Prometheus text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatFloat formats a value as the Prometheus text format expects.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of the given map, sorted alphabetically.
+func sortedKeys[V interface{}](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// countingWriter is a writer counting the written bytes, and keeping the first
+// error, after which nothing is written.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+// printf writes the formatted string.
+func (w *countingWriter) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
@@ -0,0 +1,65 @@
+package finemetrics_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"interrato.dev/fine"
+	"interrato.dev/fine/finemetrics"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := finemetrics.New("shop")
+	machine := fine.Machine("off", fine.States{
+		"off": {"toggle": "on", "stay": "off"},
+		"on":  {"toggle": "off"},
+	}, metrics.Instrument(`door "1"`))
+
+	machine.Do("toggle")
+	machine.Do("toggle")
+	machine.Do("stay")
+	machine.Do("missing")
+
+	var b strings.Builder
+	if _, err := metrics.WriteTo(&b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := b.String()
+
+	// Test that the transitions and the rejected events are counted.
+	for _, line := range []string{
+		"# TYPE shop_fine_transitions_total counter\n",
+		`shop_fine_transitions_total{machine="door \"1\"",from="off",to="on",event="toggle"} 1` + "\n",
+		`shop_fine_transitions_total{machine="door \"1\"",from="on",to="off",event="toggle"} 1` + "\n",
+		`shop_fine_transitions_total{machine="door \"1\"",from="off",to="off",event="stay"} 1` + "\n",
+		`shop_fine_rejected_events_total{machine="door \"1\"",from="off",event="missing"} 1` + "\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Fatalf("missing line %q in:\n%s", line, out)
+		}
+	}
+
+	// Test that the durations are observed.
+	for _, line := range []string{
+		"# TYPE shop_fine_transition_duration_seconds histogram\n",
+		`shop_fine_transition_duration_seconds_bucket{machine="door \"1\"",event="toggle",le="+Inf"} 2` + "\n",
+		`shop_fine_transition_duration_seconds_count{machine="door \"1\"",event="stay"} 1` + "\n",
+		`shop_fine_state_duration_seconds_count{machine="door \"1\"",state="off"} 1` + "\n",
+		`shop_fine_state_duration_seconds_count{machine="door \"1\"",state="on"} 1` + "\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Fatalf("missing line %q in:\n%s", line, out)
+		}
+	}
+
+	// Test that the metrics are served over HTTP.
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if got := recorder.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Fatalf("wrong content type: got %q", got)
+	}
+	if recorder.Body.String() != out {
+		t.Fatalf("wrong body: got %q, want %q", recorder.Body.String(), out)
+	}
+}
@@ -0,0 +1,170 @@
+// Package fineredis provides a fine.Store on top of Redis, so that the state of
+// fleets of short-lived fine finite-state machines, such as the ones keyed by
+// session identifiers, is shared across processes, and expires by itself.
+//
+// Every machine is stored in a hash, with the current state, the snapshot as
+// JSON, and a version used for optimistic locking, which is checked and bumped
+// atomically by a Lua script:
+//
+//	store := fineredis.New(client, "session:", fineredis.WithTTL(30*time.Minute))
+//	fine.Persist(machine, store, sessionID, 0)
+//
+// The package does not depend on any Redis client: see Client.
+package fineredis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"interrato.dev/fine"
+)
+
+// Client runs Redis commands, as the Do methods of most Redis clients do,
+// returning the reply of the server, with nil for the nil replies.
+type Client interface {
+	Do(ctx context.Context, args ...interface{}) (interface{}, error)
+}
+
+// ClientFunc is a function implementing Client, for adapting Redis clients
+// whose Do method has a different signature, such as go-redis:
+//
+//	fineredis.ClientFunc(func(ctx context.Context, args ...interface{}) (interface{}, error) {
+//		reply, err := rdb.Do(ctx, args...).Result()
+//		if err == redis.Nil {
+//			return nil, nil
+//		}
+//		return reply, err
+//	})
+type ClientFunc func(ctx context.Context, args ...interface{}) (interface{}, error)
+
+// Do calls f.
+func (f ClientFunc) Do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	return f(ctx, args...)
+}
+
+// saveScript saves a snapshot if the stored version, which is zero for a
+// missing key, is the expected one, and sets the expiration, if any.
+const saveScript = `local version = tonumber(redis.call('HGET', KEYS[1], 'version') or '0')
+if version ~= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'state', ARGV[2], 'snapshot', ARGV[3], 'version', version + 1)
+if tonumber(ARGV[4]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+end
+return 1`
+
+// Store is a fine.Store saving the snapshots in Redis hashes.
+type Store struct {
+	client  Client
+	prefix  string
+	ttl     time.Duration
+	history bool
+}
+
+var _ fine.Store = (*Store)(nil)
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithTTL makes the saved machines expire after the given duration since
+// their last save, so that abandoned ones are deleted by Redis.
+func WithTTL(ttl time.Duration) Option {
+	return func(s *Store) {
+		s.ttl = ttl
+	}
+}
+
+// WithHistory makes the Store save the recorded transitions of the machines
+// too, which are otherwise left out of the snapshots. See fine.WithHistory.
+func WithHistory() Option {
+	return func(s *Store) {
+		s.history = true
+	}
+}
+
+// New returns a Store saving the snapshots with the given Redis client, in the
+// hashes whose key is the given prefix followed by the identifier.
+func New(client Client, prefix string, opts ...Option) *Store {
+	s := &Store{
+		client: client,
+		prefix: prefix,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Load returns the snapshot saved with the given identifier, and its version,
+// or an error wrapping fine.ErrNotFound if there is none, or if it expired.
+func (s *Store) Load(ctx context.Context, id string) (fine.Snapshot, int64, error) {
+	reply, err := s.client.Do(ctx, "HMGET", s.prefix+id, "snapshot", "version")
+	if err != nil {
+		return fine.Snapshot{}, 0, err
+	}
+	fields, ok := reply.([]interface{})
+	if !ok || len(fields) != 2 {
+		return fine.Snapshot{}, 0, fmt.Errorf("unexpected reply %v", reply)
+	}
+	if fields[0] == nil {
+		return fine.Snapshot{}, 0, fmt.Errorf("%w: %q", fine.ErrNotFound, id)
+	}
+
+	data, err := bulkString(fields[0])
+	if err != nil {
+		return fine.Snapshot{}, 0, err
+	}
+	v, err := bulkString(fields[1])
+	if err != nil {
+		return fine.Snapshot{}, 0, err
+	}
+	version, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return fine.Snapshot{}, 0, err
+	}
+	var snapshot fine.Snapshot
+	if err := json.Unmarshal([]byte(data), &snapshot); err != nil {
+		return fine.Snapshot{}, 0, err
+	}
+	return snapshot, version, nil
+}
+
+// Save saves the snapshot with the given identifier, replacing the one with
+// the given version, which is zero for a new identifier, and refreshes its
+// expiration. An error wrapping fine.ErrConflict is returned, and nothing is
+// saved, if the stored version differs.
+func (s *Store) Save(ctx context.Context, id string, snapshot fine.Snapshot, version int64) error {
+	if !s.history {
+		snapshot.History = nil
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	reply, err := s.client.Do(ctx, "EVAL", saveScript, 1, s.prefix+id,
+		version, snapshot.State, string(data), s.ttl.Milliseconds())
+	if err != nil {
+		return err
+	}
+	if saved, ok := reply.(int64); !ok || saved != 1 {
+		return fmt.Errorf("%w: %q is not at version %d", fine.ErrConflict, id, version)
+	}
+	return nil
+}
+
+// bulkString returns the string of a bulk string reply, which clients return
+// either as a string or as a byte slice.
+func bulkString(reply interface{}) (string, error) {
+	switch v := reply.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+	return "", fmt.Errorf("unexpected reply %v", reply)
+}
@@ -0,0 +1,155 @@
+package fineredis_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"interrato.dev/fine"
+	"interrato.dev/fine/fineredis"
+)
+
+// memoryClient is a fineredis.Client supporting only the commands of the
+// Store, on in-memory hashes, which replies with byte slices as redigo does.
+type memoryClient struct {
+	mu     sync.Mutex
+	hashes map[string]map[string]string
+	ttls   map[string]int64
+}
+
+func newMemoryClient() *memoryClient {
+	return &memoryClient{
+		hashes: make(map[string]map[string]string),
+		ttls:   make(map[string]int64),
+	}
+}
+
+func (c *memoryClient) Do(_ context.Context, args ...interface{}) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch args[0] {
+	case "HMGET":
+		hash := c.hashes[args[1].(string)]
+		reply := make([]interface{}, 0, len(args)-2)
+		for _, field := range args[2:] {
+			if value, ok := hash[field.(string)]; ok {
+				reply = append(reply, []byte(value))
+			} else {
+				reply = append(reply, nil)
+			}
+		}
+		return reply, nil
+	case "EVAL":
+		key := args[3].(string)
+		hash := c.hashes[key]
+		version, _ := strconv.ParseInt(hash["version"], 10, 64)
+		if version != args[4].(int64) {
+			return int64(0), nil
+		}
+		c.hashes[key] = map[string]string{
+			"state":    args[5].(string),
+			"snapshot": args[6].(string),
+			"version":  strconv.FormatInt(version+1, 10),
+		}
+		if ttl := args[7].(int64); ttl > 0 {
+			c.ttls[key] = ttl
+		}
+		return int64(1), nil
+	}
+	return nil, fmt.Errorf("unsupported command %v", args[0])
+}
+
+func TestStore(t *testing.T) {
+	client := newMemoryClient()
+	ctx := context.Background()
+	store := fineredis.New(client, "session:", fineredis.WithTTL(time.Minute))
+
+	// Test that a missing snapshot is not found.
+	if _, _, err := store.Load(ctx, "abc"); !errors.Is(err, fine.ErrNotFound) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrNotFound)
+	}
+
+	// Test that the snapshots are saved with increasing versions, and with
+	// the expiration.
+	snapshot := fine.Snapshot{
+		State:   "browsing",
+		History: []fine.SnapshotRecord{{From: "new", To: "browsing", Event: "open"}},
+	}
+	if err := store.Save(ctx, "abc", snapshot, 0); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	snapshot.State = "checkout"
+	if err := store.Save(ctx, "abc", snapshot, 1); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	loaded, version, err := store.Load(ctx, "abc")
+	if err != nil || loaded.State != "checkout" || version != 2 {
+		t.Fatalf("wrong snapshot: got (%+v, %d, %v)", loaded, version, err)
+	}
+	if state := client.hashes["session:abc"]["state"]; state != "checkout" {
+		t.Fatalf("wrong state field: got %q, want %q", state, "checkout")
+	}
+	if ttl := client.ttls["session:abc"]; ttl != time.Minute.Milliseconds() {
+		t.Fatalf("wrong TTL: got %d, want %d", ttl, time.Minute.Milliseconds())
+	}
+
+	// Test that the history is left out by default.
+	if len(loaded.History) != 0 {
+		t.Fatalf("no history expected, got: %v", loaded.History)
+	}
+
+	// Test that stale versions conflict, without changing anything.
+	for _, version := range []int64{0, 1, 3} {
+		err := store.Save(ctx, "abc", fine.Snapshot{State: "paid"}, version)
+		if !errors.Is(err, fine.ErrConflict) {
+			t.Fatalf("wrong error for version %d: got %v, want %v", version, err, fine.ErrConflict)
+		}
+	}
+	if loaded, _, _ := store.Load(ctx, "abc"); loaded.State != "checkout" {
+		t.Fatalf("wrong state: got %q, want %q", loaded.State, "checkout")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	d, err := fine.Define(fine.States{
+		"new":      {"open": "browsing"},
+		"browsing": {"pay": "checkout"},
+		"checkout": {},
+	}, fine.WithHistory(10))
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+
+	// Test that the history is saved when requested, through Persist and
+	// Resume.
+	store := fineredis.New(newMemoryClient(), "session:", fineredis.WithHistory())
+	m := d.NewInstance("new")
+	fine.Persist(m, store, "abc", 0)
+	m.Do("open")
+	m.Do("pay")
+	resumed, version, err := fine.Resume(ctx, store, d, "abc")
+	if err != nil || resumed.State() != "checkout" || version != 2 {
+		t.Fatalf("wrong resumed FSM: got (%v, %d, %v)", resumed, version, err)
+	}
+	if history := resumed.History(); len(history) != 2 || history[1].To != "checkout" {
+		t.Fatalf("wrong history: got %v", history)
+	}
+}
+
+func TestClientFunc(t *testing.T) {
+	// Test that ClientFunc adapts functions, and that string replies are
+	// supported as well.
+	client := fineredis.ClientFunc(func(_ context.Context, args ...interface{}) (interface{}, error) {
+		return []interface{}{`{"state":"browsing"}`, "7"}, nil
+	})
+	snapshot, version, err := fineredis.New(client, "").Load(context.Background(), "abc")
+	if err != nil || snapshot.State != "browsing" || version != 7 {
+		t.Fatalf("wrong snapshot: got (%+v, %d, %v)", snapshot, version, err)
+	}
+}
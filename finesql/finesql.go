@@ -0,0 +1,182 @@
+// Package finesql provides a fine.Store on top of database/sql, so that the
+// state of the fine finite-state machines survives process restarts.
+//
+// Snapshots are stored as JSON in a single table, with one row per machine,
+// whose version column is used for optimistic locking:
+//
+//	store := finesql.New(db, "machines")
+//	if err := store.CreateTable(ctx); err != nil {
+//		// ...
+//	}
+//	fine.Persist(machine, store, "order-42", 0)
+//
+// Any database/sql driver can be used, as long as the SQL of the table schema
+// is supported by the database: see Schema.
+package finesql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"interrato.dev/fine"
+)
+
+// Store is a fine.Store saving the snapshots in a table of a SQL database.
+type Store struct {
+	db          *sql.DB
+	table       string
+	placeholder func(n int) string
+}
+
+var _ fine.Store = (*Store)(nil)
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithDollarPlaceholders makes the Store use the $1, $2, ... placeholders of
+// PostgreSQL in its queries, instead of the ? ones of MySQL and SQLite.
+func WithDollarPlaceholders() Option {
+	return func(s *Store) {
+		s.placeholder = func(n int) string {
+			return fmt.Sprintf("$%d", n)
+		}
+	}
+}
+
+// New returns a Store saving the snapshots in the given table of the given
+// database. The table name is used verbatim in the queries, so it must be a
+// valid identifier, and must never come from untrusted input.
+func New(db *sql.DB, table string, opts ...Option) *Store {
+	s := &Store{
+		db:    db,
+		table: table,
+		placeholder: func(int) string {
+			return "?"
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Schema returns the statement creating the table of the Store, if it does
+// not exist. The table has the following columns:
+//
+//   - id, the identifier of the machine, which is the primary key;
+//   - state, the current state of the machine, for querying;
+//   - snapshot, the whole snapshot, as JSON;
+//   - version, the version of the snapshot.
+func (s *Store) Schema() string {
+	return "CREATE TABLE IF NOT EXISTS " + s.table + " (" +
+		"id VARCHAR(255) PRIMARY KEY, " +
+		"state VARCHAR(255) NOT NULL, " +
+		"snapshot TEXT NOT NULL, " +
+		"version BIGINT NOT NULL)"
+}
+
+// CreateTable creates the table of the Store, if it does not exist.
+func (s *Store) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, s.Schema())
+	return err
+}
+
+// Load returns the snapshot saved with the given identifier, and its version,
+// or an error wrapping fine.ErrNotFound if there is none.
+func (s *Store) Load(ctx context.Context, id string) (fine.Snapshot, int64, error) {
+	var data string
+	var version int64
+	err := s.db.QueryRowContext(ctx, s.query(
+		"SELECT snapshot, version FROM %s WHERE id = %s",
+	), id).Scan(&data, &version)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return fine.Snapshot{}, 0, fmt.Errorf("%w: %q", fine.ErrNotFound, id)
+	case err != nil:
+		return fine.Snapshot{}, 0, err
+	}
+
+	var snapshot fine.Snapshot
+	if err := json.Unmarshal([]byte(data), &snapshot); err != nil {
+		return fine.Snapshot{}, 0, err
+	}
+	return snapshot, version, nil
+}
+
+// Save saves the snapshot with the given identifier, replacing the one with
+// the given version, which is zero for a new identifier, within a transaction.
+// An error wrapping fine.ErrConflict is returned, and nothing is saved, if the
+// stored version differs.
+func (s *Store) Save(ctx context.Context, id string, snapshot fine.Snapshot, version int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.SaveTx(ctx, tx, id, snapshot, version); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// SaveTx is like Save, but it saves the snapshot within the given transaction,
+// so that it is committed, or rolled back, together with other changes, such
+// as the ones of the records the machine refers to.
+func (s *Store) SaveTx(ctx context.Context, tx *sql.Tx, id string, snapshot fine.Snapshot, version int64) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	var result sql.Result
+	if version == 0 {
+		var count int
+		err := tx.QueryRowContext(ctx, s.query(
+			"SELECT COUNT(*) FROM %s WHERE id = %s",
+		), id).Scan(&count)
+		switch {
+		case err != nil:
+			return err
+		case count > 0:
+			return fmt.Errorf("%w: %q already exists", fine.ErrConflict, id)
+		}
+		result, err = tx.ExecContext(ctx, s.query(
+			"INSERT INTO %s (id, state, snapshot, version) VALUES (%s, %s, %s, %s)",
+		), id, snapshot.State, string(data), 1)
+		if err != nil {
+			return err
+		}
+	} else {
+		result, err = tx.ExecContext(ctx, s.query(
+			"UPDATE %s SET state = %s, snapshot = %s, version = %s WHERE id = %s AND version = %s",
+		), snapshot.State, string(data), version+1, id, version)
+		if err != nil {
+			return err
+		}
+	}
+
+	rows, err := result.RowsAffected()
+	switch {
+	case err != nil:
+		return err
+	case rows == 0:
+		return fmt.Errorf("%w: %q is not at version %d", fine.ErrConflict, id, version)
+	}
+	return nil
+}
+
+// query returns the given query, formatting the table name as its first verb,
+// and the placeholders of the Store as the other ones.
+func (s *Store) query(format string) string {
+	n := strings.Count(format, "%s") - 1
+	args := make([]interface{}, 0, n+1)
+	args = append(args, s.table)
+	for i := 1; i <= n; i++ {
+		args = append(args, s.placeholder(i))
+	}
+	return fmt.Sprintf(format, args...)
+}
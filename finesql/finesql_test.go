@@ -0,0 +1,230 @@
+package finesql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"interrato.dev/fine"
+	"interrato.dev/fine/finesql"
+)
+
+// memoryDriver is a database/sql driver supporting only the queries of the
+// Store, on an in-memory table.
+type memoryDriver struct {
+	mu      sync.Mutex
+	rows    map[string][]driver.Value
+	queries []string
+}
+
+func (d *memoryDriver) Open(string) (driver.Conn, error) {
+	return &memoryConn{d}, nil
+}
+
+type memoryConn struct{ d *memoryDriver }
+
+func (c *memoryConn) Prepare(query string) (driver.Stmt, error) {
+	return &memoryStmt{c.d, query}, nil
+}
+
+func (c *memoryConn) Close() error { return nil }
+
+// Begin starts a transaction, which holds the driver lock until it ends, and
+// restores the table when rolled back.
+func (c *memoryConn) Begin() (driver.Tx, error) {
+	c.d.mu.Lock()
+	saved := make(map[string][]driver.Value, len(c.d.rows))
+	for id, row := range c.d.rows {
+		saved[id] = row
+	}
+	return &memoryTx{c.d, saved}, nil
+}
+
+type memoryTx struct {
+	d     *memoryDriver
+	saved map[string][]driver.Value
+}
+
+func (tx *memoryTx) Commit() error {
+	tx.d.mu.Unlock()
+	return nil
+}
+
+func (tx *memoryTx) Rollback() error {
+	tx.d.rows = tx.saved
+	tx.d.mu.Unlock()
+	return nil
+}
+
+type memoryStmt struct {
+	d     *memoryDriver
+	query string
+}
+
+func (s *memoryStmt) Close() error  { return nil }
+func (s *memoryStmt) NumInput() int { return -1 }
+
+func (s *memoryStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.queries = append(s.d.queries, s.query)
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE"):
+		return driver.RowsAffected(0), nil
+	case strings.HasPrefix(s.query, "INSERT"):
+		s.d.rows[args[0].(string)] = []driver.Value{args[1], args[2], args[3]}
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(s.query, "UPDATE"):
+		row, ok := s.d.rows[args[3].(string)]
+		if !ok || row[2] != args[4] {
+			return driver.RowsAffected(0), nil
+		}
+		s.d.rows[args[3].(string)] = []driver.Value{args[0], args[1], args[2]}
+		return driver.RowsAffected(1), nil
+	}
+	return nil, fmt.Errorf("unsupported query %q", s.query)
+}
+
+func (s *memoryStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.queries = append(s.d.queries, s.query)
+	row, ok := s.d.rows[args[0].(string)]
+	switch {
+	case strings.HasPrefix(s.query, "SELECT COUNT(*)"):
+		count := int64(0)
+		if ok {
+			count = 1
+		}
+		return &memoryRows{[]string{"count"}, [][]driver.Value{{count}}}, nil
+	case strings.HasPrefix(s.query, "SELECT snapshot"):
+		columns := []string{"snapshot", "version"}
+		if !ok {
+			return &memoryRows{columns, nil}, nil
+		}
+		return &memoryRows{columns, [][]driver.Value{{row[1], row[2]}}}, nil
+	}
+	return nil, fmt.Errorf("unsupported query %q", s.query)
+}
+
+type memoryRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *memoryRows) Columns() []string { return r.columns }
+func (r *memoryRows) Close() error      { return nil }
+
+func (r *memoryRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+var (
+	registerOnce sync.Once
+	testDriver   = &memoryDriver{}
+)
+
+func openDB(t *testing.T) (*sql.DB, *memoryDriver) {
+	registerOnce.Do(func() {
+		sql.Register("finesql-memory", testDriver)
+	})
+	testDriver.mu.Lock()
+	testDriver.rows = make(map[string][]driver.Value)
+	testDriver.queries = nil
+	testDriver.mu.Unlock()
+
+	db, err := sql.Open("finesql-memory", "")
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, testDriver
+}
+
+func TestStore(t *testing.T) {
+	db, driver := openDB(t)
+	ctx := context.Background()
+	store := finesql.New(db, "machines")
+	if err := store.CreateTable(ctx); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+
+	// Test that a missing snapshot is not found.
+	if _, _, err := store.Load(ctx, "order-1"); !errors.Is(err, fine.ErrNotFound) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrNotFound)
+	}
+
+	// Test that the snapshots are saved with increasing versions.
+	snapshot := fine.Snapshot{State: "created", Journal: []string{"draft"}}
+	if err := store.Save(ctx, "order-1", snapshot, 0); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	snapshot.State = "paid"
+	if err := store.Save(ctx, "order-1", snapshot, 1); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	loaded, version, err := store.Load(ctx, "order-1")
+	if err != nil || loaded.State != "paid" || len(loaded.Journal) != 1 || version != 2 {
+		t.Fatalf("wrong snapshot: got (%+v, %d, %v)", loaded, version, err)
+	}
+
+	// Test that stale versions conflict, without changing anything.
+	for _, version := range []int64{0, 1, 3} {
+		err := store.Save(ctx, "order-1", fine.Snapshot{State: "shipped"}, version)
+		if !errors.Is(err, fine.ErrConflict) {
+			t.Fatalf("wrong error for version %d: got %v, want %v", version, err, fine.ErrConflict)
+		}
+	}
+	if loaded, _, _ := store.Load(ctx, "order-1"); loaded.State != "paid" {
+		t.Fatalf("wrong state: got %q, want %q", loaded.State, "paid")
+	}
+
+	// Test that the table schema is the one created.
+	if driver.queries[0] != store.Schema() {
+		t.Fatalf("wrong schema query: got %q, want %q", driver.queries[0], store.Schema())
+	}
+}
+
+func TestPlaceholders(t *testing.T) {
+	db, driver := openDB(t)
+	ctx := context.Background()
+
+	// Test that the placeholders of PostgreSQL are used when requested.
+	store := finesql.New(db, "machines", finesql.WithDollarPlaceholders())
+	if err := store.Save(ctx, "order-1", fine.Snapshot{State: "created"}, 0); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	want := "INSERT INTO machines (id, state, snapshot, version) VALUES ($1, $2, $3, $4)"
+	if got := driver.queries[len(driver.queries)-1]; got != want {
+		t.Fatalf("wrong query: got %q, want %q", got, want)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	db, _ := openDB(t)
+	ctx := context.Background()
+	store := finesql.New(db, "machines")
+	d, err := fine.Define(fine.States{
+		"created": {"pay": "paid"},
+		"paid":    {},
+	})
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+
+	// Test that the Store works with Persist and Resume.
+	m := d.NewInstance("created")
+	fine.Persist(m, store, "order-1", 0)
+	m.Do("pay")
+	resumed, version, err := fine.Resume(ctx, store, d, "order-1")
+	if err != nil || resumed.State() != "paid" || version != 1 {
+		t.Fatalf("wrong resumed FSM: got (%v, %d, %v)", resumed, version, err)
+	}
+}
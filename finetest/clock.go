@@ -0,0 +1,91 @@
+package finetest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"interrato.dev/fine"
+)
+
+// Clock is a fine.Clock whose time only moves forward when advanced manually,
+// so that the time-based features of an FSM, such as timeouts, can be tested
+// without actually waiting. Use it with fine.WithClock.
+//
+// The timers fire synchronously, within Advance, in chronological order.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*timer
+}
+
+// timer is a call scheduled on a Clock.
+type timer struct {
+	clock   *Clock
+	when    time.Time
+	f       func()
+	stopped bool
+}
+
+// NewClock returns a Clock whose current time is the given one.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current time of the Clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// AfterFunc schedules f to be called once the Clock has been advanced by the
+// given duration.
+func (c *Clock) AfterFunc(d time.Duration, f func()) fine.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &timer{clock: c, when: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the time forward by the given duration, firing all the timers
+// that are due. The timers scheduled while firing are not fired, even if they
+// are due already, until the next Advance.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []*timer
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		switch {
+		case t.stopped:
+		case !t.when.After(c.now):
+			t.stopped = true
+			due = append(due, t)
+		default:
+			pending = append(pending, t)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].when.Before(due[j].when)
+	})
+	for _, t := range due {
+		t.f()
+	}
+}
+
+// Stop prevents the timer from firing.
+func (t *timer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	stopped := t.stopped
+	t.stopped = true
+	return !stopped
+}
@@ -0,0 +1,43 @@
+package finetest_test
+
+import (
+	"testing"
+	"time"
+
+	"interrato.dev/fine/finetest"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := finetest.NewClock(start)
+	var fired []int
+	clock.AfterFunc(2*time.Second, func() { fired = append(fired, 2) })
+	clock.AfterFunc(time.Second, func() { fired = append(fired, 1) })
+	stopped := clock.AfterFunc(time.Second, func() { fired = append(fired, 0) })
+
+	// Test that stopped timers never fire.
+	if !stopped.Stop() {
+		t.Fatal("the timer should have been stopped")
+	}
+	if stopped.Stop() {
+		t.Fatal("the timer should have been already stopped")
+	}
+
+	// Test that time only moves when advanced.
+	if now := clock.Now(); !now.Equal(start) {
+		t.Fatalf("wrong time: got %v, want %v", now, start)
+	}
+	clock.Advance(500 * time.Millisecond)
+	if len(fired) != 0 {
+		t.Fatalf("no timers expected to fire, got: %v", fired)
+	}
+
+	// Test that due timers fire in chronological order.
+	clock.Advance(3 * time.Second)
+	if len(fired) != 2 || fired[0] != 1 || fired[1] != 2 {
+		t.Fatalf("wrong timers fired: got %v, want [1 2]", fired)
+	}
+	if now := clock.Now(); !now.Equal(start.Add(3500 * time.Millisecond)) {
+		t.Fatalf("wrong time: got %v", now)
+	}
+}
@@ -0,0 +1,37 @@
+package finetest
+
+import (
+	"fmt"
+	"strings"
+
+	"interrato.dev/fine"
+)
+
+// TB is the subset of testing.TB used by AssertFullCoverage.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertFullCoverage fails the test if any event of any state of the given
+// FSM never fired, listing the missing ones. The FSM must count the events,
+// as enabled with fine.WithCoverage.
+func AssertFullCoverage(t TB, m *fine.FSM) {
+	t.Helper()
+
+	entries := m.Coverage()
+	if entries == nil {
+		t.Errorf("coverage is not enabled: use fine.WithCoverage")
+		return
+	}
+	var missing []string
+	for _, e := range entries {
+		if e.Count == 0 {
+			missing = append(missing, fmt.Sprintf("%q on state %q", e.Event, e.State))
+		}
+	}
+	if len(missing) > 0 {
+		t.Errorf("%d of %d transitions never fired: %s",
+			len(missing), len(entries), strings.Join(missing, ", "))
+	}
+}
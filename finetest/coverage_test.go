@@ -0,0 +1,53 @@
+package finetest_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"interrato.dev/fine"
+	"interrato.dev/fine/finetest"
+)
+
+// fakeTB is a finetest.TB recording the errors.
+type fakeTB struct {
+	errors []string
+}
+
+func (t *fakeTB) Helper() {}
+
+func (t *fakeTB) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertFullCoverage(t *testing.T) {
+	machine := fine.Machine("off", fine.States{
+		"off": {"toggle": "on"},
+		"on":  {"toggle": "off", "break": "off"},
+	}, fine.WithCoverage())
+
+	// Test that the missing transitions are listed.
+	machine.Do("toggle")
+	tb := &fakeTB{}
+	finetest.AssertFullCoverage(tb, machine)
+	if len(tb.errors) != 1 || !strings.Contains(tb.errors[0], `"break" on state "on", "toggle" on state "on"`) {
+		t.Fatalf("wrong errors: got %q", tb.errors)
+	}
+
+	// Test that full coverage passes.
+	machine.Do("break")
+	machine.Do("toggle")
+	machine.Do("toggle")
+	tb = &fakeTB{}
+	finetest.AssertFullCoverage(tb, machine)
+	if len(tb.errors) != 0 {
+		t.Fatalf("no errors expected, got: %q", tb.errors)
+	}
+
+	// Test that the coverage must be enabled.
+	tb = &fakeTB{}
+	finetest.AssertFullCoverage(tb, fine.Machine("a", fine.States{"a": {}}))
+	if len(tb.errors) != 1 {
+		t.Fatalf("wrong errors: got %q", tb.errors)
+	}
+}
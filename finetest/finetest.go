@@ -0,0 +1,91 @@
+// Package finetest provides utilities for testing code that uses the fine
+// finite-state machines.
+package finetest
+
+import (
+	"sync"
+	"time"
+
+	"interrato.dev/fine"
+)
+
+// Recorder records, in chronological order, the lifecycle of an FSM: the
+// lifecycle actions being dispatched, including the transition-scoped ones,
+// and the notifications to the subscribers. It makes it easy to assert the
+// exact order of the calls in tests.
+//
+// The recorded events have the following forms, where state is the state
+// the lifecycle action belongs to, or the state being notified.
+//
+//	@exit state
+//	notify state
+//	@enter state
+//	@before:event state
+//	@after:event state
+//
+// Lifecycle events are recorded even for states that do not define the
+// corresponding lifecycle action.
+type Recorder struct {
+	mu          sync.Mutex
+	events      []string
+	stopped     bool
+	untrace     func()
+	unsubscribe func()
+}
+
+// NewRecorder returns a Recorder that starts recording the lifecycle of the
+// given FSM right away. Since the Recorder subscribes to the FSM, its
+// transitions always take the full path, as if observed by any subscriber.
+func NewRecorder(m *fine.FSM) *Recorder {
+	r := &Recorder{}
+	r.untrace = m.OnLifecycle(func(kind, state string, _ fine.Metadata, _ time.Duration) {
+		r.record(kind + " " + state)
+	})
+
+	subscribed := false
+	r.unsubscribe = m.Subscribe(func(state string) {
+		// Skip the notification received when subscribing.
+		if !subscribed {
+			subscribed = true
+			return
+		}
+		r.record("notify " + state)
+	})
+
+	return r
+}
+
+// record appends an event to the log, unless the Recorder is stopped.
+func (r *Recorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.stopped {
+		r.events = append(r.events, event)
+	}
+}
+
+// Events returns a copy of the events recorded so far.
+func (r *Recorder) Events() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.events...)
+}
+
+// Reset clears the events recorded so far, while the recording goes on.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.events = nil
+	r.mu.Unlock()
+}
+
+// Stop stops recording. The events recorded so far are kept.
+func (r *Recorder) Stop() {
+	r.mu.Lock()
+	r.stopped = true
+	r.mu.Unlock()
+
+	r.untrace()
+	r.unsubscribe()
+}
@@ -0,0 +1,52 @@
+package finetest_test
+
+import (
+	"fmt"
+	"testing"
+
+	"interrato.dev/fine"
+	"interrato.dev/fine/finetest"
+)
+
+func TestRecorder(t *testing.T) {
+	machine := fine.Machine("off", fine.States{
+		"off": {
+			"toggle":        "on",
+			"@after:toggle": func() {},
+		},
+		"on": {
+			"@enter": func() {},
+			"toggle": "off",
+		},
+	})
+	r := finetest.NewRecorder(machine)
+
+	// Test that the full lifecycle sequence is recorded in order.
+	machine.Do("toggle")
+	machine.Do("toggle")
+	want := []string{
+		"@exit off",
+		"notify on",
+		"@enter on",
+		"@after:toggle off",
+		"@exit on",
+		"notify off",
+		"@enter off",
+	}
+	if got := r.Events(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("wrong events:\ngot  %v\nwant %v", got, want)
+	}
+
+	// Test that Reset clears the recorded events.
+	r.Reset()
+	if got := r.Events(); len(got) != 0 {
+		t.Fatalf("no events expected, got: %v", got)
+	}
+
+	// Test that nothing is recorded after Stop.
+	r.Stop()
+	machine.Do("toggle")
+	if got := r.Events(); len(got) != 0 {
+		t.Fatalf("no events expected, got: %v", got)
+	}
+}
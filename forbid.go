@@ -0,0 +1,68 @@
+package fine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrForbidden is returned by Do when, in strict mode, an action tries to lead
+// the FSM to a forbidden state.
+var ErrForbidden = errors.New("forbidden state")
+
+// WithStrictForbid makes the FSM prevent the transitions towards forbidden
+// states: Do returns an error wrapping ErrForbidden, and the FSM stays in the
+// current state. By default, such transitions are only observed.
+func WithStrictForbid() Option {
+	return func(m *FSM) {
+		m.strictForbid = true
+	}
+}
+
+// Forbid declares that the FSM must never enter the given states, since that
+// would signal a bug. Forbidden states are meant to be unreachable by design,
+// unlike the ones that are simply the end of the FSM life.
+//
+// Whenever an action leads to a forbidden state, the hooks registered with
+// OnViolation are called before the transition starts. Then, by default, the
+// transition happens anyway, while in strict mode it is prevented: see
+// WithStrictForbid.
+func (m *FSM) Forbid(states ...string) {
+	m.mu.Lock()
+	if m.forbidden == nil {
+		m.forbidden = make(map[string]bool, len(states))
+	}
+	for _, state := range states {
+		m.forbidden[state] = true
+	}
+	m.mu.Unlock()
+}
+
+// OnViolation registers a hook that is called whenever an action leads to a
+// forbidden state, with the metadata of the offending transition. Multiple
+// hooks can be registered, and they run in registration order, without
+// holding any lock.
+func (m *FSM) OnViolation(hook func(metadata Metadata)) {
+	m.mu.Lock()
+	m.violationHooks = append(m.violationHooks, hook)
+	m.mu.Unlock()
+}
+
+// violate reports the given transition towards a forbidden state, and returns
+// a non-nil error if the transition must be prevented.
+func (m *FSM) violate(metadata Metadata) error {
+	m.mu.RLock()
+	hooks := m.violationHooks
+	strict := m.strictForbid
+	m.mu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(metadata)
+	}
+	if strict {
+		return fmt.Errorf(
+			"%w: %q cannot be entered from %q with %q",
+			ErrForbidden, metadata.To, metadata.From, metadata.Event,
+		)
+	}
+	return nil
+}
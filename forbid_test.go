@@ -0,0 +1,82 @@
+package fine_test
+
+import (
+	"errors"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func newHeater(opts ...fine.Option) *fine.FSM {
+	temperature := 0
+	return fine.Machine("idle", fine.States{
+		"idle": {
+			"heat": func() string {
+				temperature += 50
+				if temperature > 80 {
+					return "overheated"
+				}
+				return "heating"
+			},
+		},
+		"heating": {
+			"stop": "idle",
+		},
+		"overheated": {},
+	}, opts...)
+}
+
+func TestForbid(t *testing.T) {
+	machine := newHeater()
+	machine.Forbid("overheated")
+
+	var violations []fine.Metadata
+	machine.OnViolation(func(metadata fine.Metadata) {
+		violations = append(violations, metadata)
+	})
+
+	// Test that allowed transitions are not reported.
+	machine.Do("heat")
+	machine.Do("stop")
+	if len(violations) != 0 {
+		t.Fatalf("no violations expected, got: %v", violations)
+	}
+
+	// Test that, by default, entering a forbidden state is reported but
+	// allowed.
+	state, err := machine.Do("heat")
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if state != "overheated" {
+		t.Fatalf("wrong state: got %q, want %q", state, "overheated")
+	}
+	if len(violations) != 1 || violations[0].From != "idle" || violations[0].To != "overheated" {
+		t.Fatalf("wrong violations: got %v", violations)
+	}
+}
+
+func TestForbidStrict(t *testing.T) {
+	machine := newHeater(fine.WithStrictForbid())
+	machine.Forbid("overheated")
+
+	var violations []fine.Metadata
+	machine.OnViolation(func(metadata fine.Metadata) {
+		violations = append(violations, metadata)
+	})
+
+	// Test that, in strict mode, entering a forbidden state is reported and
+	// prevented.
+	machine.Do("heat")
+	machine.Do("stop")
+	state, err := machine.Do("heat")
+	if !errors.Is(err, fine.ErrForbidden) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrForbidden)
+	}
+	if state != "idle" || machine.State() != "idle" {
+		t.Fatalf("wrong state: got %q, want %q", machine.State(), "idle")
+	}
+	if len(violations) != 1 || violations[0].To != "overheated" {
+		t.Fatalf("wrong violations: got %v", violations)
+	}
+}
@@ -0,0 +1,103 @@
+package fine
+
+import "sort"
+
+// FrozenFSM is an immutable snapshot of an FSM, taken at a point in time by
+// Freeze. It can be read concurrently by any number of goroutines without any
+// locking, and without contending with the live FSM in any way. It cannot do
+// actions nor be modified.
+type FrozenFSM struct {
+	initial string
+	current string
+	states  stateTable
+	global  *state
+	less    func(a, b string) bool
+}
+
+// Freeze returns an immutable snapshot of the FSM, with its current state and
+// its states, taken consistently. Later changes to the FSM do not affect the
+// snapshot. It is meant for read-heavy workloads, such as dashboards and
+// exporters, that would otherwise contend with the live FSM.
+func (m *FSM) Freeze() *FrozenFSM {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// The precompiled states are never modified, so copying the table is
+	// enough for taking a snapshot.
+	states := make(stateTable, len(m.table()))
+	for name, s := range m.table() {
+		states[name] = s
+	}
+
+	return &FrozenFSM{
+		initial: m.initial,
+		current: m.current,
+		states:  states,
+		global:  m.global.Load(),
+		less:    m.stateLess(),
+	}
+}
+
+// State returns the state of the FSM when it was frozen.
+func (f *FrozenFSM) State() string {
+	return f.current
+}
+
+// States returns a slice with all the possible states of the FSM when it was
+// frozen, sorted alphabetically, or following the order of the states if the
+// FSM was instantiated with MachineOrdered.
+func (f *FrozenFSM) States() []string {
+	states := make([]string, 0, len(f.states))
+	for name := range f.states {
+		states = append(states, name)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return f.less(states[i], states[j])
+	})
+
+	return states
+}
+
+// Exists returns whether the specified state was a possible state for the FSM
+// when it was frozen.
+func (f *FrozenFSM) Exists(state string) bool {
+	_, ok := f.states[state]
+	return ok
+}
+
+// Can returns whether the specified action was a valid action for the state
+// of the FSM when it was frozen.
+func (f *FrozenFSM) Can(action string) bool {
+	_, ok := resolve(f.states[f.current], f.global, action)
+	return ok
+}
+
+// ExportDOT behaves like the ExportDOT method of FSM, on the frozen FSM.
+func (f *FrozenFSM) ExportDOT() string {
+	return f.describe().dot()
+}
+
+// ExportDOTReachable behaves like the ExportDOTReachable method of FSM, on the
+// frozen FSM.
+func (f *FrozenFSM) ExportDOTReachable() string {
+	d := f.describe()
+	return d.restrict(d.reachable(d.current)).dot()
+}
+
+// ExportMermaid behaves like the ExportMermaid method of FSM, on the frozen
+// FSM.
+func (f *FrozenFSM) ExportMermaid() string {
+	return f.describe().mermaid()
+}
+
+// ExportMermaidReachable behaves like the ExportMermaidReachable method of
+// FSM, on the frozen FSM.
+func (f *FrozenFSM) ExportMermaidReachable() string {
+	d := f.describe()
+	return d.restrict(d.reachable(d.current)).mermaid()
+}
+
+// describe returns the description of the frozen FSM.
+func (f *FrozenFSM) describe() description {
+	return describe(f.initial, f.current, f.states, f.global, f.less)
+}
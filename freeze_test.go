@@ -0,0 +1,55 @@
+package fine_test
+
+import (
+	"sync"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestFreeze(t *testing.T) {
+	machine := newExportMachine()
+	want := machine.ExportDOT()
+	frozen := machine.Freeze()
+
+	// Test that later changes do not affect the snapshot.
+	machine.Do("pay")
+	machine.Add("new", fine.Transitions{"next": "locked"})
+	machine.AddOrMerge("locked", fine.Transitions{"kick": "broken"})
+
+	if state := frozen.State(); state != "locked" {
+		t.Fatalf("wrong state: got %q, want %q", state, "locked")
+	}
+	if frozen.Exists("new") || !frozen.Exists("broken") {
+		t.Fatal("wrong states in the snapshot")
+	}
+	if frozen.Can("kick") || !frozen.Can("pay") {
+		t.Fatal("wrong actions in the snapshot")
+	}
+	states := frozen.States()
+	if len(states) != 4 || states[0] != "broken" || states[3] != "unlocked" {
+		t.Fatalf("wrong states: got %v", states)
+	}
+	if got := frozen.ExportDOT(); got != want {
+		t.Fatalf("wrong DOT:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Concurrency test (run with `-race`).
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			frozen.State()
+			frozen.States()
+			frozen.ExportMermaid()
+			frozen.ExportMermaidReachable()
+		}()
+		go func() {
+			defer wg.Done()
+			machine.Do("push")
+			machine.Do("pay")
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,55 @@
+package fine
+
+import "fmt"
+
+// AddGlobal adds a global transition, which applies from every state: doing the
+// given event from any state executes the given action, as if it was part of
+// the Transitions of that state. A state that has its own transition for the
+// same event overrides the global one. Adding a global transition for an event
+// that already has one replaces it.
+//
+// A non-nil error is returned, and nothing is added, if the event is the key
+// of a lifecycle action, or if the action has an invalid type, unless the FSM
+// was created with WithSafeDispatch, as for AddOrMerge.
+func (m *FSM) AddGlobal(event string, action interface{}) error {
+	if event == "@enter" || event == "@exit" || event == Final || isScopedHook(event) {
+		return fmt.Errorf("the lifecycle action %q cannot be global", event)
+	}
+	if err := m.checkActions(globalName, Transitions{event: action}); err != nil {
+		return err
+	}
+
+	m.writeStates(func(stateTable) {
+		m.global.Store(merge(globalName, m.global.Load(), Transitions{event: action}))
+	})
+
+	return nil
+}
+
+// globalName is the name of the pseudo-state holding the global transitions.
+const globalName = "*"
+
+// lookup returns the action for the given event from the given state, which
+// may be nil, falling back to the global transitions, which may be nil too.
+func lookup(s, global *state, event string) (action, bool) {
+	if s != nil {
+		if a, ok := s.actions[event]; ok {
+			return a, true
+		}
+	}
+	if global != nil {
+		a, ok := global.actions[event]
+		return a, ok
+	}
+	return action{}, false
+}
+
+// handles reports whether the state, which may be nil, has an action for the
+// given event.
+func (s *state) handles(event string) bool {
+	if s == nil {
+		return false
+	}
+	_, ok := s.actions[event]
+	return ok
+}
@@ -0,0 +1,72 @@
+package fine_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestAddGlobal(t *testing.T) {
+	machine := fine.Machine("idle", fine.States{
+		"idle":    {"start": "running"},
+		"running": {"stop": "idle"},
+		"locked":  {"reset": nil},
+	})
+	if err := machine.AddGlobal("reset", "idle"); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	machine.AddGlobal("lock", "locked")
+
+	// Test that global transitions apply from every state.
+	for _, tc := range []struct {
+		action, want string
+	}{
+		{"start", "running"},
+		{"reset", "idle"},
+		{"lock", "locked"},
+		// Test that local transitions override global ones.
+		{"reset", "locked"},
+	} {
+		if state, err := machine.Do(tc.action); err != nil || state != tc.want {
+			t.Fatalf("wrong state: got %q (%v), want %q", state, err, tc.want)
+		}
+	}
+
+	// Test that introspection takes global transitions into account.
+	if missing := machine.StatesMissing("lock"); len(missing) != 0 {
+		t.Fatalf("no missing states expected, got: %v", missing)
+	}
+	if e := machine.Explain("lock"); e.Mechanism != "global" || e.Target != "locked" {
+		t.Fatalf("wrong explanation: got %+v", e)
+	}
+	if e := machine.Explain("reset"); e.Mechanism != "transition" {
+		t.Fatalf("wrong explanation: got %+v", e)
+	}
+	if target, _, _ := machine.DryRun("lock"); target != "locked" {
+		t.Fatalf("wrong target: got %q, want %q", target, "locked")
+	}
+	dot := machine.ExportDOT()
+	if !strings.Contains(dot, `"running" -> "idle" [label="reset"]`) ||
+		strings.Contains(dot, `"locked" -> "idle" [label="reset"]`) {
+		t.Fatalf("wrong global edges in DOT:\n%s", dot)
+	}
+
+	// Test that lifecycle actions and invalid types are rejected.
+	if err := machine.AddGlobal("@enter", func() {}); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+	if err := machine.AddGlobal("bad", 42); !errors.Is(err, fine.ErrBadActionType) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrBadActionType)
+	}
+
+	// Test that with WithSafeDispatch invalid types are not rejected.
+	machine = fine.Machine("idle", fine.States{"idle": {}}, fine.WithSafeDispatch())
+	if err := machine.AddGlobal("bad", 42); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if _, err := machine.Do("bad"); !errors.Is(err, fine.ErrBadActionType) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrBadActionType)
+	}
+}
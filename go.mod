@@ -1,3 +1,3 @@
 module interrato.dev/fine
 
-go 1.17
+go 1.19
@@ -0,0 +1,34 @@
+package fine
+
+// History is an action leading to the named state, like a string action, but
+// resuming the machine embedded in that state, if any, from the sub-state it
+// was in when the state was last exited, instead of restarting it from its
+// initial state. This is the shallow history of statecharts: only the
+// embedded machine resumes, while the machines embedded in its own states are
+// restarted. See Embed.
+//
+// For example, the following action leads back to the "playback" state,
+// resuming its sub-state, such as "playing" or "paused".
+//
+//	"resume": fine.History("playback")
+type History string
+
+// DeepHistory is an action leading to the named state, like History, but
+// resuming all the nested embedded machines at any depth, which is the deep
+// history of statecharts.
+type DeepHistory string
+
+// historyMode tells how the machine embedded in a state resumes when the state
+// is entered.
+type historyMode uint8
+
+const (
+	// The embedded machine restarts from its initial state.
+	historyNone historyMode = iota
+
+	// The embedded machine resumes, while the nested ones restart.
+	historyShallow
+
+	// All the nested embedded machines resume.
+	historyDeep
+)
@@ -0,0 +1,59 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestHistory(t *testing.T) {
+	quality := fine.Machine("low", fine.States{
+		"low":  {"upgrade": "high"},
+		"high": {},
+	})
+	playback := fine.Machine("playing", fine.States{
+		"playing": {"pause": "paused"},
+		"paused":  {"play": "playing"},
+	})
+	playback.Embed("playing", quality, map[string]string{"upgrade": "upgrade"})
+	player := fine.Machine("idle", fine.States{
+		"idle": {
+			"open":       "playback",
+			"resume":     fine.History("playback"),
+			"resumeDeep": fine.DeepHistory("playback"),
+		},
+		"playback": {"close": "idle"},
+	})
+	player.Embed("playback", playback, map[string]string{
+		"pause":   "pause",
+		"upgrade": "upgrade",
+	})
+
+	for _, tc := range []struct {
+		actions  []string
+		playback string
+		quality  string
+	}{
+		{[]string{"open"}, "playing", "low"},
+		{[]string{"upgrade"}, "playing", "high"},
+		// Test that shallow history resumes only the embedded machine.
+		{[]string{"close", "resume"}, "playing", "low"},
+		// Test that deep history resumes all the nested machines.
+		{[]string{"upgrade", "close", "resumeDeep"}, "playing", "high"},
+		{[]string{"pause", "close", "resume"}, "paused", "high"},
+		// Test that plain targets restart the embedded machine.
+		{[]string{"close", "open"}, "playing", "low"},
+	} {
+		for _, action := range tc.actions {
+			if _, err := player.Do(action); err != nil {
+				t.Fatalf("no error expected, got: %v", err)
+			}
+		}
+		if state := playback.State(); state != tc.playback {
+			t.Fatalf("wrong state after %v: got %q, want %q", tc.actions, state, tc.playback)
+		}
+		if state := quality.State(); state != tc.quality {
+			t.Fatalf("wrong state after %v: got %q, want %q", tc.actions, state, tc.quality)
+		}
+	}
+}
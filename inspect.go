@@ -0,0 +1,437 @@
+package fine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DryRun reports where doing the specified action from the current state would
+// lead, without executing anything.
+//
+// For string actions the target is known statically, for nil actions it is
+// the current state, and for Dispatch actions it depends on the arguments
+// only, so in all these cases determinable is true. For function
+// actions the target cannot be known without executing them, with all their
+// side effects, so determinable is false and the target is empty.
+//
+// A non-nil error is returned whenever Do would reject the action before
+// executing it, for example because the action is not valid for the current
+// state, or because the arguments do not match its schema.
+func (m *FSM) DryRun(action string, args ...interface{}) (target string, determinable bool, err error) {
+	switch {
+	case action == "@enter" || action == "@exit" || action == Final:
+		return "", false, errors.New("calling a lifecycle action manually is illegal")
+	case action == UnknownEvent:
+		return "", false, errors.New("calling the fallback action manually is illegal")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.dryRun(m.current, action, args)
+}
+
+// dryRun reports where doing the specified action from the given state would
+// lead, as DryRun does. The caller must hold m.mu.
+func (m *FSM) dryRun(current, action string, args []interface{}) (string, bool, error) {
+	next, ok := resolve(m.table()[current], m.global.Load(), action)
+	argsErr := m.checkArgs(action, args)
+
+	switch {
+	case !ok:
+		return "", false, fmt.Errorf(
+			"%q is not a valid action for the current state %q",
+			action, current,
+		)
+	case argsErr != nil:
+		return "", false, argsErr
+	}
+
+	switch next.kind {
+	case kindNil:
+		return current, true, nil
+	case kindTarget:
+		return next.target, true, nil
+	case kindDispatch:
+		if target, ok := next.dispatch.resolve(args); ok {
+			return target, true, nil
+		}
+		return current, true, nil
+	case kindInvalid:
+		return "", false, badActionType(action, current)
+	}
+	return "", false, nil
+}
+
+// Simulate reports the states the FSM would go through by doing the given
+// events in order, starting from the current state, without executing any
+// action, lifecycle action, or notification, and without changing the state.
+// The events are done with no arguments, so Dispatch actions lead to their
+// DispatchDefault entry, if any.
+//
+// A non-nil error is returned, along with the states of the events before the
+// failing one, if an event would be rejected, as for DryRun, or if its target
+// cannot be known without executing a function action.
+//
+// Note: the deferrals and the rate limits are not considered, and neither are
+// the forbidden states.
+func (m *FSM) Simulate(events ...string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	states := make([]string, 0, len(events))
+	current := m.current
+	for _, event := range events {
+		if event == "@enter" || event == "@exit" || event == Final {
+			return states, errors.New("calling a lifecycle action manually is illegal")
+		}
+		target, determinable, err := m.dryRun(current, event, nil)
+		switch {
+		case err != nil:
+			return states, err
+		case !determinable:
+			return states, fmt.Errorf(
+				"the target of %q on state %q cannot be known without executing it",
+				event, current,
+			)
+		}
+		states = append(states, target)
+		current = target
+	}
+	return states, nil
+}
+
+// CanDo reports whether doing the specified action from the current state
+// would execute it, without executing anything. It is false whenever Do would
+// reject the action before executing it, as for DryRun, and also when the FSM
+// is closed, or when the current state defers the action.
+//
+// Note: the rate limits are not considered, since they depend on the exact
+// time Do is called.
+func (m *FSM) CanDo(action string, args ...interface{}) bool {
+	switch {
+	case action == "@enter" || action == "@exit" || action == Final:
+		return false
+	case action == UnknownEvent:
+		return false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed || m.deferrals[m.current][action] {
+		return false
+	}
+	next, ok := resolve(m.table()[m.current], m.global.Load(), action)
+	if !ok || next.kind == kindInvalid {
+		return false
+	}
+	return m.checkArgs(action, args) == nil
+}
+
+// Events returns, sorted alphabetically, the events that the current state
+// handles, including the global ones. See EventsFor.
+func (m *FSM) Events() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return events(m.table()[m.current], m.global.Load())
+}
+
+// EventsFor returns, sorted alphabetically, the events that the given state
+// handles, including the global ones, or nil if the state does not exist.
+// Lifecycle actions and fallback actions are not events, so they are never
+// included.
+func (m *FSM) EventsFor(state string) []string {
+	var evs []string
+	m.readStates(func(states stateTable) {
+		if s := states[state]; s != nil {
+			evs = events(s, m.global.Load())
+		}
+	})
+	return evs
+}
+
+// events returns the sorted events handled by the given state, which may be
+// nil, and by the given global transitions, which may be nil too.
+func events(s, global *state) []string {
+	evs := make([]string, 0)
+	for _, t := range []*state{s, global} {
+		if t == nil {
+			continue
+		}
+		for event := range t.actions {
+			if event != UnknownEvent && (t == s || !s.handles(event)) {
+				evs = append(evs, event)
+			}
+		}
+	}
+	sort.Strings(evs)
+	return evs
+}
+
+// ReachableFrom returns, sorted alphabetically, the given state and all the
+// states reachable from it by doing any sequence of actions. If the given
+// state does not exist, nil is returned.
+//
+// Note: since the targets of function actions are not known statically, only
+// string and nil actions are followed, and some states that are actually
+// reachable through function actions may be omitted.
+func (m *FSM) ReachableFrom(state string) []string {
+	var states []string
+	for name := range m.describe().reachable(state) {
+		states = append(states, name)
+	}
+	sort.Strings(states)
+
+	return states
+}
+
+// Edge is a transition of the FSM, from a state to another one, as found by
+// the introspection features.
+type Edge struct {
+	From  string
+	Event string
+	To    string
+
+	// Branch is the key of the Dispatch entry the edge comes from, if any.
+	Branch string
+
+	// Unresolved reports whether the target cannot be known without executing
+	// the action, as for function actions. In that case To is empty.
+	Unresolved bool
+}
+
+// Table returns the whole transition table of the FSM, as a list of edges
+// sorted by state, alphabetically or in the order given to MachineOrdered,
+// and then by event and branch. Global
+// transitions result in edges from every state that does not override them,
+// while function actions, whose target is not known statically, result in
+// unresolved edges. It is meant as a basis for tooling, such as
+// visualization, validation, and documentation.
+func (m *FSM) Table() []Edge {
+	d := m.describe()
+
+	table := make([]Edge, 0, len(d.edges))
+	for _, e := range d.edges {
+		table = append(table, e.export())
+	}
+	return table
+}
+
+// export returns the edge as an Edge.
+func (e edge) export() Edge {
+	return Edge{
+		From:       e.from,
+		Event:      e.event,
+		To:         e.to,
+		Branch:     e.branch,
+		Unresolved: e.dynamic,
+	}
+}
+
+// ReachabilityGraph returns the graph of all the states reachable from the
+// initial state, mapped to the edges leaving them, which are sorted by event.
+// Every reachable state is a key of the returned map, even if no edge leaves
+// it. It is meant as a basis for verifying properties of the FSM, such as
+// every reachable state being able to reach a final one.
+//
+// Note: as for ReachableFrom, only string, nil and Dispatch actions are
+// followed, while function actions result in unresolved edges.
+func (m *FSM) ReachabilityGraph() map[string][]Edge {
+	d := m.describe()
+	d = d.restrict(d.reachable(d.initial))
+
+	graph := make(map[string][]Edge, len(d.states))
+	for _, name := range d.states {
+		graph[name] = nil
+	}
+	for _, e := range d.edges {
+		graph[e.from] = append(graph[e.from], e.export())
+	}
+
+	return graph
+}
+
+// CheckDeterministic reports, for every state, each event that could be
+// handled by more than one mechanism, as named by Explanation, with no clear
+// precedence between them, which makes the outcome of doing that event depend
+// on the order in which they are checked rather than on any single
+// declaration. The errors are sorted by state and event, and nil is returned
+// for a deterministic FSM. The reported overlaps are:
+//
+//   - a deferral and a transition of the same state, as both are declared for
+//     the state itself: see Defer;
+//   - a Dispatch action, or a global one, with no DispatchDefault entry, from
+//     a state with a fallback action, or a global one, as its unmatched
+//     arguments never reach the fallback.
+//
+// The overlaps with a documented winner are not reported: a transition of the
+// state overriding a global transition, a deferral overriding a global
+// transition, any explicit event overriding the fallback action, and the
+// fallback action of the state overriding the global one. The keys of a
+// Transitions map are unique, so an FSM only made of them is always
+// deterministic.
+func (m *FSM) CheckDeterministic() []error {
+	var errs []error
+
+	m.mu.RLock()
+	deferrals := make(map[string][]string, len(m.deferrals))
+	for state, events := range m.deferrals {
+		for event := range events {
+			deferrals[state] = append(deferrals[state], event)
+		}
+	}
+	m.mu.RUnlock()
+
+	m.readStates(func(states stateTable) {
+		global := m.global.Load()
+		names := make([]string, 0, len(states))
+		for name := range states {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			handlers := handlers(states[name], global, deferrals[name])
+			events := make([]string, 0, len(handlers))
+			for event := range handlers {
+				events = append(events, event)
+			}
+			sort.Strings(events)
+
+			for _, event := range events {
+				if mechanisms := handlers[event]; len(mechanisms) > 1 {
+					errs = append(errs, fmt.Errorf(
+						"event %q on state %q is ambiguous: handled by %s",
+						event, name, strings.Join(mechanisms, " and "),
+					))
+				}
+			}
+		}
+	})
+
+	return errs
+}
+
+// handlers returns, for every event handled by the given state, which defers
+// the given events, or by the given global transitions, which may be nil, the
+// mechanisms that could handle it with no clear precedence between them.
+func handlers(s, global *state, deferred []string) map[string][]string {
+	handlers := make(map[string][]string, len(s.actions))
+	add := func(event, mechanism string) {
+		handlers[event] = append(handlers[event], mechanism)
+	}
+
+	fallback := ""
+	switch {
+	case s.handles(UnknownEvent):
+		fallback = "fallback"
+	case global.handles(UnknownEvent):
+		fallback = "global fallback"
+	}
+
+	for event, a := range s.actions {
+		if event == UnknownEvent {
+			continue
+		}
+		add(event, "transition")
+		if _, ok := a.dispatch[DispatchDefault]; a.kind == kindDispatch && !ok && fallback != "" {
+			add(event, fallback)
+		}
+	}
+	if global != nil {
+		for event, a := range global.actions {
+			if event == UnknownEvent || s.handles(event) {
+				continue
+			}
+			add(event, "global")
+			if _, ok := a.dispatch[DispatchDefault]; a.kind == kindDispatch && !ok && fallback != "" {
+				add(event, fallback)
+			}
+		}
+	}
+	for _, event := range deferred {
+		if s.handles(event) {
+			add(event, "deferral")
+		}
+	}
+	return handlers
+}
+
+// Explanation describes how an action would be resolved from a state. See
+// Explain.
+type Explanation struct {
+	// State is the state the action would be done from.
+	State string
+	// Action is the explained action.
+	Action string
+	// Mechanism is the mechanism that would handle the action, which is
+	// "deferral" for an action deferred by the state, "transition" for a key
+	// of the state Transitions, "global" for a global
+	// transition, "fallback" for the fallback action of the state, and
+	// "global fallback" for the global one. It is empty when the action is
+	// not handled at all.
+	Mechanism string
+	// Type is the type of the resolved action value, formatted as with the
+	// %T verb of the fmt package, for example "string" or "func() string".
+	Type string
+	// Target is the state the action leads to, if it is known statically,
+	// which is only the case for string actions.
+	Target string
+}
+
+// String returns a human-readable description of the explanation.
+func (e Explanation) String() string {
+	if e.Mechanism == "" {
+		return fmt.Sprintf("%q is not handled by state %q", e.Action, e.State)
+	}
+	s := fmt.Sprintf(
+		"%q on state %q is handled by %s with a %s action",
+		e.Action, e.State, e.Mechanism, e.Type,
+	)
+	if e.Target != "" {
+		s += fmt.Sprintf(" leading to %q", e.Target)
+	}
+	return s
+}
+
+// Explain reports how doing the specified action from the current state would
+// be resolved, without executing anything. It is a diagnostic meant to answer
+// the question of why an action did what it did.
+func (m *FSM) Explain(action string) Explanation {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	e := Explanation{State: m.current, Action: action}
+	s := m.table()[m.current]
+	global := m.global.Load()
+	key := action
+	switch {
+	case s == nil || action == UnknownEvent:
+		return e
+	case m.deferrals[m.current][action]:
+		e.Mechanism = "deferral"
+		return e
+	case s.handles(action):
+		e.Mechanism = "transition"
+	case global.handles(action):
+		e.Mechanism = "global"
+		s = global
+	case s.handles(UnknownEvent):
+		e.Mechanism = "fallback"
+		key = UnknownEvent
+	case global.handles(UnknownEvent):
+		e.Mechanism = "global fallback"
+		s, key = global, UnknownEvent
+	default:
+		return e
+	}
+	e.Type = fmt.Sprintf("%T", s.transitions[key])
+	if next := s.actions[key]; next.kind == kindTarget {
+		e.Target = next.target
+	}
+	return e
+}
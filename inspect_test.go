@@ -0,0 +1,393 @@
+package fine_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestDryRun(t *testing.T) {
+	executed := false
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"next": "b",
+			"stay": nil,
+			"func": func() string {
+				executed = true
+				return "b"
+			},
+			"dispatch": fine.Dispatch{"x": "b"},
+		},
+		"b": {},
+	})
+
+	for _, tc := range []struct {
+		action       string
+		target       string
+		determinable bool
+		fails        bool
+	}{
+		{"next", "b", true, false},
+		{"stay", "a", true, false},
+		{"func", "", false, false},
+		{"dispatch", "a", true, false},
+		{"missing", "", false, true},
+		{"@enter", "", false, true},
+	} {
+		target, determinable, err := machine.DryRun(tc.action)
+		if (err != nil) != tc.fails {
+			t.Fatalf("wrong error for %q: got %v", tc.action, err)
+		}
+		if target != tc.target || determinable != tc.determinable {
+			t.Fatalf(
+				"wrong result for %q: got (%q, %v), want (%q, %v)",
+				tc.action, target, determinable, tc.target, tc.determinable,
+			)
+		}
+	}
+
+	// Test that Dispatch actions are resolved with the arguments.
+	if target, _, _ := machine.DryRun("dispatch", "x"); target != "b" {
+		t.Fatalf("wrong target: got %q, want %q", target, "b")
+	}
+
+	// Test that the fallback action cannot be done directly, as with Do.
+	fallback := fine.Machine("a", fine.States{"a": {fine.UnknownEvent: "b"}, "b": {}})
+	if _, _, err := fallback.DryRun(fine.UnknownEvent); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+	if _, err := fallback.Do(fine.UnknownEvent); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+
+	// Test that nothing was executed.
+	if executed {
+		t.Fatal("no action execution expected")
+	}
+	if state := machine.State(); state != "a" {
+		t.Fatalf("wrong state: got %q, want %q", state, "a")
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	executed := false
+	machine := fine.Machine("draft", fine.States{
+		"draft":  {"submit": "review", "save": nil},
+		"review": {"decide": fine.Dispatch{"yes": "published", fine.DispatchDefault: "draft"}},
+		"published": {"compute": func() string {
+			executed = true
+			return "draft"
+		}},
+	})
+	machine.OnEnter("review", func(fine.Metadata) { executed = true })
+
+	// Test that the states are walked without executing anything.
+	states, err := machine.Simulate("save", "submit", "decide", "submit")
+	if err != nil || strings.Join(states, " ") != "draft review draft review" {
+		t.Fatalf("wrong states: got %v (%v)", states, err)
+	}
+	if executed || machine.State() != "draft" {
+		t.Fatalf("nothing should have been executed, the state is %q", machine.State())
+	}
+
+	// Test that the simulation stops at invalid and undeterminable events.
+	states, err = machine.Simulate("submit", "missing")
+	if err == nil || len(states) != 1 {
+		t.Fatalf("wrong states: got %v (%v)", states, err)
+	}
+	machine.AddOrMerge("review", fine.Transitions{"approve": "published"})
+	states, err = machine.Simulate("submit", "approve", "compute", "submit")
+	if err == nil || len(states) != 2 || executed {
+		t.Fatalf("wrong states: got %v (%v)", states, err)
+	}
+}
+
+func TestCanDo(t *testing.T) {
+	executed := false
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"next": "b",
+			"func": func(args ...interface{}) string {
+				executed = true
+				return "b"
+			},
+			"bad":   42,
+			"later": "b",
+		},
+		"b": {},
+	}, fine.WithSafeDispatch())
+	machine.SetArgSchema("func", reflect.TypeOf(0))
+	machine.Defer("a", "later")
+
+	for _, tc := range []struct {
+		action string
+		args   []interface{}
+		want   bool
+	}{
+		{"next", nil, true},
+		{"func", []interface{}{1}, true},
+		{"func", []interface{}{"1"}, false},
+		{"bad", nil, false},
+		{"later", nil, false},
+		{"missing", nil, false},
+		{"@enter", nil, false},
+	} {
+		if got := machine.CanDo(tc.action, tc.args...); got != tc.want {
+			t.Fatalf("wrong result for %q %v: got %v, want %v", tc.action, tc.args, got, tc.want)
+		}
+	}
+
+	// Test that nothing was executed, and that a closed FSM cannot do
+	// anything.
+	if executed || machine.State() != "a" {
+		t.Fatal("no action execution expected")
+	}
+	machine.Close()
+	if machine.CanDo("next") {
+		t.Fatal("a closed FSM should not do anything")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"next":            "b",
+			"reset":           "a",
+			"@enter":          func() {},
+			"@before:next":    func() {},
+			fine.UnknownEvent: nil,
+		},
+		"b": {},
+	})
+	machine.AddGlobal("reset", "b")
+
+	// Test that only the events are listed, once, including the global ones.
+	for _, tc := range []struct {
+		events []string
+		want   []string
+	}{
+		{machine.Events(), []string{"next", "reset"}},
+		{machine.EventsFor("a"), []string{"next", "reset"}},
+		{machine.EventsFor("b"), []string{"reset"}},
+		{machine.EventsFor("missing"), nil},
+	} {
+		if len(tc.events) != len(tc.want) {
+			t.Fatalf("wrong events: got %v, want %v", tc.events, tc.want)
+		}
+		for i := range tc.want {
+			if tc.events[i] != tc.want[i] {
+				t.Fatalf("wrong events: got %v, want %v", tc.events, tc.want)
+			}
+		}
+	}
+}
+
+func TestReachableFrom(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b", "stay": nil},
+		"b": {"next": "c", "jump": func() string { return "d" }},
+		"c": {"next": "b"},
+		"d": {"next": "a"},
+	})
+
+	for _, tc := range []struct {
+		from string
+		want []string
+	}{
+		{"a", []string{"a", "b", "c"}},
+		{"c", []string{"b", "c"}},
+		{"d", []string{"a", "b", "c", "d"}},
+		{"missing", nil},
+	} {
+		got := machine.ReachableFrom(tc.from)
+		if len(got) != len(tc.want) {
+			t.Fatalf("wrong states from %q: got %v, want %v", tc.from, got, tc.want)
+		}
+		for i := range tc.want {
+			if got[i] != tc.want[i] {
+				t.Fatalf("wrong states from %q: got %v, want %v", tc.from, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"next":   "b",
+			"func":   func() string { return "b" },
+			"signal": fine.Dispatch{"x": "b", "y": "a"},
+		},
+		"b": {},
+	})
+	machine.AddGlobal("reset", "a")
+
+	// Test that every edge is listed, in order.
+	want := []fine.Edge{
+		{From: "a", Event: "func", Unresolved: true},
+		{From: "a", Event: "next", To: "b"},
+		{From: "a", Event: "reset", To: "a"},
+		{From: "a", Event: "signal", To: "b", Branch: "x"},
+		{From: "a", Event: "signal", To: "a", Branch: "y"},
+		{From: "b", Event: "reset", To: "a"},
+	}
+	table := machine.Table()
+	if len(table) != len(want) {
+		t.Fatalf("wrong table: got %+v, want %+v", table, want)
+	}
+	for i := range want {
+		if table[i] != want[i] {
+			t.Fatalf("wrong edge %d: got %+v, want %+v", i, table[i], want[i])
+		}
+	}
+}
+
+func TestReachabilityGraph(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b", "stay": nil},
+		"b": {
+			"jump":   func() string { return "d" },
+			"signal": fine.Dispatch{"x": "c"},
+		},
+		"c": {},
+		"d": {"next": "a"},
+	})
+
+	want := map[string][]fine.Edge{
+		"a": {
+			{From: "a", Event: "next", To: "b"},
+			{From: "a", Event: "stay", To: "a"},
+		},
+		"b": {
+			{From: "b", Event: "jump", Unresolved: true},
+			{From: "b", Event: "signal", To: "c", Branch: "x"},
+		},
+		"c": nil,
+	}
+	got := machine.ReachabilityGraph()
+	if len(got) != len(want) {
+		t.Fatalf("wrong graph: got %v, want %v", got, want)
+	}
+	for state, edges := range want {
+		if len(got[state]) != len(edges) {
+			t.Fatalf("wrong edges from %q: got %v, want %v", state, got[state], edges)
+		}
+		for i := range edges {
+			if got[state][i] != edges[i] {
+				t.Fatalf("wrong edges from %q: got %v, want %v", state, got[state], edges)
+			}
+		}
+	}
+}
+
+func TestCheckDeterministic(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b", "stay": nil},
+		"b": {"next": func() string { return "a" }},
+	})
+
+	// Test that an FSM made of plain transitions is deterministic.
+	if errs := machine.CheckDeterministic(); errs != nil {
+		t.Fatalf("no errors expected, got: %v", errs)
+	}
+
+	// Test that a global transition with no overlap is deterministic.
+	machine.AddGlobal("reset", "a")
+	if errs := machine.CheckDeterministic(); errs != nil {
+		t.Fatalf("no errors expected, got: %v", errs)
+	}
+
+	// Test that the overlaps with a documented winner are not reported: a
+	// state overriding a global transition, and an explicit event, or the
+	// fallback action of the state, overriding the global fallback one.
+	machine = fine.Machine("a", fine.States{
+		"a": {
+			"reset":           "a",
+			fine.UnknownEvent: "a",
+		},
+		"b": {},
+	})
+	machine.AddGlobal("reset", "b")
+	machine.AddGlobal("stop", "b")
+	machine.AddGlobal(fine.UnknownEvent, "b")
+	if errs := machine.CheckDeterministic(); errs != nil {
+		t.Fatalf("no errors expected, got: %v", errs)
+	}
+
+	// Test that the ambiguous overlaps are reported.
+	machine = fine.Machine("a", fine.States{
+		"a": {
+			fine.UnknownEvent: "a",
+		},
+		"b": {
+			"signal": fine.Dispatch{"red": "a"},
+		},
+		"c": {
+			"signal": fine.Dispatch{"red": "a", fine.DispatchDefault: "b"},
+		},
+	})
+	machine.AddGlobal("light", fine.Dispatch{"green": "b"})
+	machine.AddGlobal(fine.UnknownEvent, "c")
+	want := []string{
+		`event "light" on state "a" is ambiguous: handled by global and fallback`,
+		`event "light" on state "b" is ambiguous: handled by global and global fallback`,
+		`event "signal" on state "b" is ambiguous: handled by transition and global fallback`,
+		`event "light" on state "c" is ambiguous: handled by global and global fallback`,
+	}
+	errs := machine.CheckDeterministic()
+	if len(errs) != len(want) {
+		t.Fatalf("wrong errors: got %v, want %d errors", errs, len(want))
+	}
+	for i, err := range errs {
+		if err.Error() != want[i] {
+			t.Fatalf("wrong error: got %q, want %q", err, want[i])
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"@enter":   func() {},
+			"next":     "b",
+			"stay":     nil,
+			"func":     func() string { return "b" },
+			"dispatch": fine.Dispatch{"x": "b"},
+		},
+		"b": {},
+	})
+
+	for _, tc := range []struct {
+		action    string
+		mechanism string
+		typ       string
+		target    string
+	}{
+		{"next", "transition", "string", "b"},
+		{"stay", "transition", "<nil>", ""},
+		{"func", "transition", "func() string", ""},
+		{"dispatch", "transition", "fine.Dispatch", ""},
+		{"missing", "", "", ""},
+		{"@enter", "", "", ""},
+	} {
+		e := machine.Explain(tc.action)
+		if e.State != "a" || e.Action != tc.action {
+			t.Fatalf("wrong explanation subject: got %+v", e)
+		}
+		if e.Mechanism != tc.mechanism || e.Type != tc.typ || e.Target != tc.target {
+			t.Fatalf(
+				"wrong explanation for %q: got (%q, %q, %q), want (%q, %q, %q)",
+				tc.action, e.Mechanism, e.Type, e.Target,
+				tc.mechanism, tc.typ, tc.target,
+			)
+		}
+	}
+
+	// Test that the explanation is human-readable.
+	want := `"next" on state "a" is handled by transition with a string action leading to "b"`
+	if got := machine.Explain("next").String(); got != want {
+		t.Fatalf("wrong description: got %q, want %q", got, want)
+	}
+}
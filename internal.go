@@ -0,0 +1,16 @@
+package fine
+
+// Internal marks the wrapped action as internal: the action is executed as
+// usual, but the resulting state change, if any, happens silently, without
+// executing the @exit and @enter lifecycle actions, and without notifying the
+// subscribers. This is useful for "refresh" events that only update some data
+// without conceptually leaving the state. For example:
+//
+//	"refresh": fine.Internal{Action: func() { counter++ }}
+//
+// The wrapped action can have any of the types of a regular action, except
+// Internal itself. The @before and @after hooks of the event are still
+// executed, as the action itself is.
+type Internal struct {
+	Action interface{}
+}
@@ -0,0 +1,69 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestInternal(t *testing.T) {
+	var lifecycle, notified []string
+	refreshed := 0
+	machine := fine.Machine("idle", fine.States{
+		"idle": {
+			"refresh": fine.Internal{Action: func() { refreshed++ }},
+			"skip":    fine.Internal{Action: "running"},
+			"start":   "running",
+			"@exit":   func() { lifecycle = append(lifecycle, "@exit idle") },
+		},
+		"running": {
+			"stop":   fine.Internal{Action: func() string { return "idle" }},
+			"@enter": func() { lifecycle = append(lifecycle, "@enter running") },
+		},
+	})
+	machine.Subscribe(func(state string) {
+		notified = append(notified, state)
+	})
+	notified = nil
+
+	// Test that internal actions are executed.
+	if state, err := machine.Do("refresh"); err != nil || state != "idle" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "idle")
+	}
+	if refreshed != 1 {
+		t.Fatalf("wrong refresh count: got %d, want 1", refreshed)
+	}
+
+	// Test that internal transitions skip lifecycle actions and
+	// notifications.
+	for _, tc := range []struct {
+		action, want string
+	}{
+		{"skip", "running"},
+		{"stop", "idle"},
+	} {
+		if state, err := machine.Do(tc.action); err != nil || state != tc.want {
+			t.Fatalf("wrong state: got %q (%v), want %q", state, err, tc.want)
+		}
+	}
+	if len(lifecycle) != 0 || len(notified) != 0 {
+		t.Fatalf("no lifecycle actions or notifications expected, got: %v %v", lifecycle, notified)
+	}
+
+	// Test that regular transitions are not affected.
+	machine.Do("start")
+	if len(lifecycle) != 2 || len(notified) != 1 {
+		t.Fatalf("wrong lifecycle actions or notifications: %v %v", lifecycle, notified)
+	}
+}
+
+func TestInternalNested(t *testing.T) {
+	machine := fine.Machine("idle", fine.States{
+		"idle": {"bad": fine.Internal{Action: fine.Internal{Action: "idle"}}},
+	}, fine.WithSafeDispatch())
+
+	// Test that nested internal actions are invalid.
+	if _, err := machine.Do("bad"); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+}
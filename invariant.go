@@ -0,0 +1,81 @@
+package fine
+
+import "fmt"
+
+// InvariantError is the violation of an invariant registered with
+// AddInvariant.
+type InvariantError struct {
+	// Name is the name of the violated invariant.
+	Name string
+
+	// State is the state in which the invariant was violated.
+	State string
+
+	// Err is the error returned by the check of the invariant.
+	Err error
+}
+
+func (e *InvariantError) Error() string {
+	return fmt.Sprintf("invariant %q violated in state %q: %v", e.Name, e.State, e.Err)
+}
+
+func (e *InvariantError) Unwrap() error {
+	return e.Err
+}
+
+// invariant is a check registered with AddInvariant.
+type invariant struct {
+	name  string
+	check func(state string) error
+}
+
+// AddInvariant registers a property that must hold in every state of the FSM,
+// for lightweight runtime model checking. The check is evaluated after every
+// state change, once the transition completed, with the new state, and it
+// returns a non-nil error if the property is violated, for example because
+// the FSM is dispensing while another machine has its door open. The checks
+// run in registration order, without holding any lock.
+//
+// Each violation is passed to the hooks registered with OnInvariantViolation,
+// or, if there are none, reported to the ones registered with OnError, as an
+// *InvariantError. The transition is not undone.
+func (m *FSM) AddInvariant(name string, check func(state string) error) {
+	m.mu.Lock()
+	m.invariants = append(m.invariants, invariant{name, check})
+	m.mu.Unlock()
+}
+
+// OnInvariantViolation registers a hook that is called whenever an invariant
+// registered with AddInvariant is violated, with the violation and the
+// metadata of the transition that led to it, replacing the default handling,
+// which reports the violations to the hooks registered with OnError. Multiple
+// hooks can be registered, and they run in registration order, without
+// holding any lock.
+func (m *FSM) OnInvariantViolation(hook func(err *InvariantError, metadata Metadata)) {
+	m.mu.Lock()
+	m.invariantHooks = append(m.invariantHooks, hook)
+	m.mu.Unlock()
+}
+
+// checkInvariants evaluates the invariants in the destination state of the
+// given transition, handling their violations.
+func (m *FSM) checkInvariants(metadata Metadata) {
+	m.mu.RLock()
+	invariants := m.invariants
+	hooks := m.invariantHooks
+	m.mu.RUnlock()
+
+	for _, inv := range invariants {
+		err := inv.check(metadata.To)
+		if err == nil {
+			continue
+		}
+		violation := &InvariantError{Name: inv.name, State: metadata.To, Err: err}
+		if len(hooks) == 0 {
+			m.report(violation)
+		}
+		for _, hook := range hooks {
+			hook(violation, metadata)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package fine_test
+
+import (
+	"errors"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestInvariant(t *testing.T) {
+	door := fine.Machine("closed", fine.States{
+		"closed": {"open": "opened"},
+		"opened": {"close": "closed"},
+	})
+	vending := fine.Machine("idle", fine.States{
+		"idle":       {"dispense": "dispensing", "refill": fine.Internal{Action: "dispensing"}},
+		"dispensing": {"done": "idle"},
+	})
+	errDoor := errors.New("the door is open")
+	vending.AddInvariant("closed door", func(state string) error {
+		if state == "dispensing" && door.State() == "opened" {
+			return errDoor
+		}
+		return nil
+	})
+
+	// Test that the violations are reported to the error hooks by default.
+	var reported []error
+	vending.OnError(func(err error) { reported = append(reported, err) })
+	vending.Do("dispense")
+	vending.Do("done")
+	door.Do("open")
+	vending.Do("dispense")
+	var violation *fine.InvariantError
+	if len(reported) != 1 || !errors.As(reported[0], &violation) || !errors.Is(reported[0], errDoor) {
+		t.Fatalf("wrong reported errors: got %v", reported)
+	}
+	if violation.Name != "closed door" || violation.State != "dispensing" {
+		t.Fatalf("wrong violation: got %+v", violation)
+	}
+
+	// Test that the violation hooks replace the default handling, and that
+	// internal transitions are checked too.
+	var violations []fine.Metadata
+	vending.OnInvariantViolation(func(err *fine.InvariantError, metadata fine.Metadata) {
+		violations = append(violations, metadata)
+	})
+	vending.Do("done")
+	vending.Do("refill")
+	if len(violations) != 1 || violations[0].Event != "refill" || len(reported) != 1 {
+		t.Fatalf("wrong violations: got %v (%d reported)", violations, len(reported))
+	}
+}
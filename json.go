@@ -0,0 +1,243 @@
+package fine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Registry maps names to the functions used as actions, lifecycle actions,
+// or actions attached to Transition values, so that they can be referenced in
+// the JSON definitions of MarshalJSON and LoadJSON.
+type Registry map[string]interface{}
+
+// name returns the name under which the given function is registered. The
+// functions are compared by their code, so distinct closures created by the
+// same function literal cannot be told apart.
+func (r Registry) name(fn interface{}) (string, bool) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return "", false
+	}
+	for _, name := range sortedKeys(r) {
+		if f := reflect.ValueOf(r[name]); f.Kind() == reflect.Func && f.Type() == v.Type() && f.Pointer() == v.Pointer() {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// jsonDefinition is the JSON form of a machine definition.
+type jsonDefinition struct {
+	Initial string                                `json:"initial"`
+	States  map[string]map[string]json.RawMessage `json:"states"`
+}
+
+// jsonAction is the JSON form of the transition values that are not strings,
+// nil, nor booleans. Exactly one of its forms is used at a time.
+type jsonAction struct {
+	Action      string          `json:"action,omitempty"`
+	Target      *string         `json:"target,omitempty"`
+	Dispatch    Dispatch        `json:"dispatch,omitempty"`
+	History     *string         `json:"history,omitempty"`
+	DeepHistory *string         `json:"deepHistory,omitempty"`
+	Reenter     *string         `json:"reenter,omitempty"`
+	Internal    json.RawMessage `json:"internal,omitempty"`
+	Timeout     json.RawMessage `json:"timeout,omitempty"`
+	After       string          `json:"after,omitempty"`
+}
+
+// MarshalJSON returns the JSON form of the machine definition made of the given
+// initial state and states, which LoadJSON reads back. String actions are
+// serialized as their target, nil actions as null, and the @final key as a
+// boolean, while the other values are objects:
+//
+//	{"action": "name"}                     a registered function
+//	{"target": "state", "action": "name"}  a Transition, whose action is optional
+//	{"dispatch": {"key": "state"}}         a Dispatch
+//	{"history": "state"}                   a History, and so on for
+//	                                       "deepHistory" and "reenter"
+//	{"internal": value}                    an Internal wrapping the value
+//	{"timeout": value, "after": "5s"}      a Timeout wrapping the value
+//
+// Functions, including the lifecycle actions, are referenced by the name they
+// have in the given registry. A non-nil error is returned if a function is not
+// registered, or if a value cannot be serialized, such as a Handler.
+func MarshalJSON(initialState string, states States, registry Registry) ([]byte, error) {
+	def := jsonDefinition{
+		Initial: initialState,
+		States:  make(map[string]map[string]json.RawMessage, len(states)),
+	}
+	for _, name := range sortedKeys(states) {
+		transitions := states[name]
+		encoded := make(map[string]json.RawMessage, len(transitions))
+		for _, event := range sortedKeys(transitions) {
+			raw, err := marshalValue(transitions[event], registry)
+			if err != nil {
+				return nil, fmt.Errorf("action %q on state %q: %w", event, name, err)
+			}
+			encoded[event] = raw
+		}
+		def.States[name] = encoded
+	}
+	return json.Marshal(def)
+}
+
+// marshalValue returns the JSON form of the given transition value.
+func marshalValue(value interface{}, registry Registry) (json.RawMessage, error) {
+	var a jsonAction
+	switch v := value.(type) {
+	case nil, string, bool:
+		return json.Marshal(v)
+	case Dispatch:
+		a.Dispatch = v
+	case History:
+		target := string(v)
+		a.History = &target
+	case DeepHistory:
+		target := string(v)
+		a.DeepHistory = &target
+	case Reenter:
+		target := string(v)
+		a.Reenter = &target
+	case Transition:
+		a.Target = &v.Target
+		if v.Action != nil {
+			name, ok := registry.name(v.Action)
+			if !ok {
+				return nil, fmt.Errorf("unregistered function %T", v.Action)
+			}
+			a.Action = name
+		}
+	case Internal:
+		raw, err := marshalValue(v.Action, registry)
+		if err != nil {
+			return nil, err
+		}
+		a.Internal = raw
+	case Timeout:
+		raw, err := marshalValue(v.Action, registry)
+		if err != nil {
+			return nil, err
+		}
+		a.Timeout, a.After = raw, v.After.String()
+	default:
+		name, ok := registry.name(v)
+		if !ok {
+			return nil, fmt.Errorf("unregistered function or unsupported value %T", v)
+		}
+		a.Action = name
+	}
+	return json.Marshal(a)
+}
+
+// LoadJSON instantiates a new FSM, with the given options, from the JSON form
+// of a machine definition returned by MarshalJSON, resolving the functions by
+// their name in the given registry. As for Define, a non-nil error is returned
+// if the JSON is malformed, if a function is not registered, if any action
+// has an invalid type, or if the initial state, or any static target, is not
+// among the states.
+func LoadJSON(data []byte, registry Registry, opts ...Option) (*FSM, error) {
+	var def jsonDefinition
+	if err := json.Unmarshal(data, &def); err != nil {
+		return nil, err
+	}
+
+	states := make(States, len(def.States))
+	for _, name := range sortedKeys(def.States) {
+		encoded := def.States[name]
+		transitions := make(Transitions, len(encoded))
+		for _, event := range sortedKeys(encoded) {
+			value, err := unmarshalValue(encoded[event], registry)
+			if err != nil {
+				return nil, fmt.Errorf("action %q on state %q: %w", event, name, err)
+			}
+			transitions[event] = value
+		}
+		states[name] = transitions
+	}
+	if _, ok := states[def.Initial]; !ok {
+		return nil, fmt.Errorf("the initial state %q is not among the states", def.Initial)
+	}
+
+	d, err := Define(states, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return d.NewInstance(def.Initial), nil
+}
+
+// unmarshalValue returns the transition value of the given JSON form.
+func unmarshalValue(raw json.RawMessage, registry Registry) (interface{}, error) {
+	raw = bytes.TrimSpace(raw)
+	switch {
+	case len(raw) == 0 || bytes.Equal(raw, []byte("null")):
+		return nil, nil
+	case raw[0] == '"':
+		var target string
+		err := json.Unmarshal(raw, &target)
+		return target, err
+	case raw[0] == 't' || raw[0] == 'f':
+		var final bool
+		err := json.Unmarshal(raw, &final)
+		return final, err
+	}
+
+	var a jsonAction
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&a); err != nil {
+		return nil, err
+	}
+	switch {
+	case a.Target != nil:
+		t := Transition{Target: *a.Target}
+		if a.Action != "" {
+			fn, ok := registry[a.Action].(func(Metadata))
+			if !ok {
+				return nil, fmt.Errorf("unregistered transition action %q", a.Action)
+			}
+			t.Action = fn
+		}
+		return t, nil
+	case a.Action != "":
+		fn, ok := registry[a.Action]
+		if !ok {
+			return nil, fmt.Errorf("unregistered function %q", a.Action)
+		}
+		return fn, nil
+	case a.Dispatch != nil:
+		return a.Dispatch, nil
+	case a.History != nil:
+		return History(*a.History), nil
+	case a.DeepHistory != nil:
+		return DeepHistory(*a.DeepHistory), nil
+	case a.Reenter != nil:
+		return Reenter(*a.Reenter), nil
+	case a.Internal != nil:
+		value, err := unmarshalValue(a.Internal, registry)
+		return Internal{Action: value}, err
+	case a.Timeout != nil:
+		after, err := time.ParseDuration(a.After)
+		if err != nil {
+			return nil, err
+		}
+		value, err := unmarshalValue(a.Timeout, registry)
+		return Timeout{After: after, Action: value}, err
+	}
+	return nil, fmt.Errorf("unsupported action %s", raw)
+}
+
+// sortedKeys returns the keys of the given map, sorted alphabetically, so that
+// the errors are deterministic.
+func sortedKeys[V interface{}, M ~map[string]V](m M) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
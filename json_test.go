@@ -0,0 +1,83 @@
+package fine_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"interrato.dev/fine"
+)
+
+func TestJSON(t *testing.T) {
+	var entered, effects int
+	enter := func() { entered++ }
+	count := func(fine.Metadata) { effects++ }
+	choose := func() string { return "done" }
+	registry := fine.Registry{"enter": enter, "count": count, "choose": choose}
+
+	states := fine.States{
+		"idle": {
+			"start":  "running",
+			"noop":   nil,
+			"signal": fine.Dispatch{"red": "done", fine.DispatchDefault: "running"},
+			"effect": fine.Transition{Target: "running", Action: count},
+		},
+		"running": {
+			"@enter":  enter,
+			"finish":  choose,
+			"refresh": fine.Internal{Action: nil},
+			"expire":  fine.After(time.Hour, "idle"),
+			"again":   fine.Reenter("running"),
+			"back":    fine.History("idle"),
+		},
+		"done": {fine.Final: true},
+	}
+
+	// Test that a definition survives a round trip.
+	data, err := fine.MarshalJSON("idle", states, registry)
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	m, err := fine.LoadJSON(data, registry)
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if state, err := m.Do("effect"); err != nil || state != "running" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "running")
+	}
+	if entered != 1 || effects != 1 {
+		t.Fatalf("wrong calls: got (%d, %d), want (1, 1)", entered, effects)
+	}
+	if state, err := m.Do("finish"); err != nil || state != "done" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "done")
+	}
+	again, err := fine.MarshalJSON("idle", states, registry)
+	if err != nil || string(again) != string(data) {
+		t.Fatalf("wrong round trip: got %s (%v), want %s", again, err, data)
+	}
+	if !strings.Contains(string(data), `"finish":{"action":"choose"}`) {
+		t.Fatalf("wrong function reference in %s", data)
+	}
+
+	// Test that unregistered functions are rejected.
+	if _, err := fine.MarshalJSON("idle", states, fine.Registry{"enter": enter}); err == nil {
+		t.Fatal("error expected")
+	}
+	if _, err := fine.LoadJSON(data, fine.Registry{"enter": enter}); err == nil {
+		t.Fatal("error expected")
+	}
+
+	// Test that invalid definitions are rejected.
+	for _, data := range []string{
+		`{"initial": "a", "states": {"a": {"go": "b"}}}`,
+		`{"initial": "b", "states": {"a": {}}}`,
+		`{"initial": "a", "states": {"a": {"go": {"unknown": 1}}}}`,
+		`{"initial": "a", "states": {"a": {"go": {"timeout": "a", "after": "soon"}}}}`,
+		`{"initial": "a", "states": {"a": {"go": 42}}}`,
+		`not json`,
+	} {
+		if _, err := fine.LoadJSON([]byte(data), nil); err == nil {
+			t.Fatalf("error expected for %s", data)
+		}
+	}
+}
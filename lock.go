@@ -0,0 +1,93 @@
+package fine
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// transitionLock is the lock serializing the transitions of an FSM. It is made
+// of levels, each one being a plain mutex: a transition holds a level, and once
+// it changed the state, it can lend the next level while it runs the code that
+// may do nested actions, such as the subscribers and the @enter lifecycle
+// action, so that those actions run right away, holding the lent level,
+// instead of deadlocking. Until the holder of a level unlocks it, the actions
+// done meanwhile lock the innermost lent level.
+type transitionLock struct {
+	root level
+
+	// The innermost lent level, or nil if none is lent.
+	open atomic.Pointer[level]
+}
+
+// level is a level of a transitionLock. Only its holder lends the next one.
+type level struct {
+	mu    sync.Mutex
+	inner *level
+	lent  bool
+}
+
+// current returns the level that the actions done now must lock.
+func (l *transitionLock) current() *level {
+	if v := l.open.Load(); v != nil {
+		return v
+	}
+	return &l.root
+}
+
+// lock waits for the current level to be free, and then locks it, returning
+// it.
+func (l *transitionLock) lock() *level {
+	for {
+		v := l.current()
+		v.mu.Lock()
+		if l.current() == v {
+			return v
+		}
+
+		// The level was reclaimed while waiting for it.
+		v.mu.Unlock()
+	}
+}
+
+// lockOuter waits for the outermost level to be free, such as once the
+// transition in progress completed, even if it lent a level, and then locks
+// it, returning it.
+func (l *transitionLock) lockOuter() *level {
+	l.root.mu.Lock()
+	return &l.root
+}
+
+// tryLock locks the outermost level and returns it, or returns nil if it is not
+// free, such as while a transition is in progress, even if it lent a level.
+func (l *transitionLock) tryLock() *level {
+	v := &l.root
+	if !v.mu.TryLock() {
+		return nil
+	}
+	return v
+}
+
+// lend lends the level next to the given one, which the caller holds, until
+// the caller unlocks it. Nothing happens if the given level is nil.
+func (l *transitionLock) lend(v *level) {
+	if v == nil || v.lent {
+		return
+	}
+	if v.inner == nil {
+		v.inner = new(level)
+	}
+	v.lent = true
+	l.open.Store(v.inner)
+}
+
+// unlock unlocks the given level, which the caller holds, first reclaiming the
+// level it lent, if any, once the nested action holding it completes.
+func (l *transitionLock) unlock(v *level) {
+	if v.lent {
+		v.lent = false
+		v.inner.mu.Lock()
+		l.open.Store(v)
+		v.inner.mu.Unlock()
+	}
+	v.mu.Unlock()
+}
@@ -0,0 +1,16 @@
+package fine
+
+import (
+	"context"
+	"time"
+)
+
+// logger receives the structured log records of an FSM. See WithLogger.
+type logger interface {
+	// logStep logs the outcome of doing the given event from the given
+	// state, which led to the given one, or failed with the given error.
+	logStep(ctx context.Context, from, to, event string, duration time.Duration, err error)
+
+	// logLifecycle logs the execution of a lifecycle action.
+	logLifecycle(kind, state string, metadata Metadata, duration time.Duration)
+}
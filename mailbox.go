@@ -0,0 +1,170 @@
+package fine
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrMailboxFull is returned by Post when the mailbox of the FSM is full.
+var ErrMailboxFull = errors.New("the mailbox of the FSM is full")
+
+// WithMailbox makes the FSM execute all its events on a single owner goroutine,
+// as an actor: Do, and every other way of doing an event, queues the event in a
+// mailbox holding up to the given number of events, and waits for the owner
+// goroutine to execute it. The events are executed one at a time, in the order
+// they were queued, each with its whole transition, so that the transitions of
+// concurrent callers never interleave. The owner goroutine is started when
+// there is something to execute, and it exits once done.
+//
+// Post queues an event without waiting for it, while Call, as Do, waits for
+// its outcome, blocking while the mailbox is full.
+//
+// Note: in this mode, doing an action from within an action, a lifecycle
+// action or a subscriber, synchronously, deadlocks, as it waits for the owner
+// goroutine itself. Use Post there instead.
+func WithMailbox(size int) Option {
+	return func(m *FSM) {
+		m.inbox = newInbox(size)
+	}
+}
+
+// Post queues the specified action in the mailbox of the FSM, and returns
+// without waiting for it, or ErrMailboxFull if the mailbox is full. The errors
+// caused by the action are reported to the hooks registered with OnError.
+//
+// Without a mailbox, the action is executed on a new goroutine, as with
+// DoAsync.
+func (m *FSM) Post(action string, args ...interface{}) error {
+	if m.inbox == nil {
+		go func() {
+			if _, _, err := m.do(nil, action, args); err != nil {
+				m.report(err)
+			}
+		}()
+		return nil
+	}
+
+	b := m.inbox
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.queue) >= b.size {
+		return ErrMailboxFull
+	}
+	m.deposit(letter{event: pendingEvent{action: action, args: args}})
+	return nil
+}
+
+// Call executes the specified action on the owner goroutine of the FSM, as
+// Do, and waits for its outcome. It blocks while the mailbox is full.
+//
+// Without a mailbox, Call is the same as Do.
+func (m *FSM) Call(action string, args ...interface{}) (string, error) {
+	state, _, err := m.do(nil, action, args)
+	return state, err
+}
+
+// inbox is the mailbox of the events to execute on the owner goroutine.
+type inbox struct {
+	mu      sync.Mutex
+	space   sync.Cond
+	queue   []letter
+	size    int
+	running bool
+}
+
+// letter is an event queued in the mailbox, with the channel receiving its
+// outcome, if the caller waits for it.
+type letter struct {
+	event pendingEvent
+	reply chan outcome
+}
+
+// outcome is the outcome of an event executed by the owner goroutine.
+type outcome struct {
+	state  string
+	result interface{}
+	err    error
+}
+
+// newInbox returns an empty mailbox of the given size, which is at least one.
+func newInbox(size int) *inbox {
+	if size < 1 {
+		size = 1
+	}
+	b := &inbox{size: size}
+	b.space.L = &b.mu
+	return b
+}
+
+// mail queues the given event in the mailbox, waiting for room, and then
+// waits for the owner goroutine to execute it.
+func (m *FSM) mail(e pendingEvent) (string, interface{}, error) {
+	reply := make(chan outcome, 1)
+
+	b := m.inbox
+	b.mu.Lock()
+	for len(b.queue) >= b.size {
+		b.space.Wait()
+	}
+	m.deposit(letter{event: e, reply: reply})
+	b.mu.Unlock()
+
+	o := <-reply
+	return o.state, o.result, o.err
+}
+
+// tryMail queues the given event in the mailbox, as mail, and waits for the
+// owner goroutine to execute it, unless the mailbox is not empty, in which case
+// it returns errBusy right away.
+func (m *FSM) tryMail(e pendingEvent) (string, interface{}, error) {
+	reply := make(chan outcome, 1)
+
+	b := m.inbox
+	b.mu.Lock()
+	if b.running {
+		b.mu.Unlock()
+		return m.State(), nil, errBusy
+	}
+	m.deposit(letter{event: e, reply: reply})
+	b.mu.Unlock()
+
+	o := <-reply
+	return o.state, o.result, o.err
+}
+
+// deposit queues the given letter, starting the owner goroutine if it is not
+// running. The caller must hold m.inbox.mu.
+func (m *FSM) deposit(l letter) {
+	b := m.inbox
+	b.queue = append(b.queue, l)
+	if !b.running {
+		b.running = true
+		go m.own()
+	}
+}
+
+// own executes the queued events in order, until the mailbox is empty.
+func (m *FSM) own() {
+	b := m.inbox
+	for {
+		b.mu.Lock()
+		if len(b.queue) == 0 {
+			b.running = false
+			b.mu.Unlock()
+			return
+		}
+		l := b.queue[0]
+		b.queue[0] = letter{}
+		b.queue = b.queue[1:]
+		b.space.Signal()
+		b.mu.Unlock()
+
+		state, result, err := m.process(l.event)
+		switch {
+		case l.reply != nil:
+			l.reply <- outcome{state, result, err}
+		case err != nil:
+			m.report(err)
+		}
+	}
+}
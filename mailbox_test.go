@@ -0,0 +1,114 @@
+package fine_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"interrato.dev/fine"
+)
+
+func TestMailbox(t *testing.T) {
+	// The number of transitions in progress, which must never be more than
+	// one while an action is running.
+	var inProgress int32
+	var violations int32
+	action := func(target string) func() string {
+		return func() string {
+			if atomic.AddInt32(&inProgress, 1) != 1 {
+				atomic.AddInt32(&violations, 1)
+			}
+			return target
+		}
+	}
+	done := func() { atomic.AddInt32(&inProgress, -1) }
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"next":        action("b"),
+			"@after:next": done,
+			"@exit":       func() { time.Sleep(10 * time.Microsecond) },
+		},
+		"b": {
+			"next":        action("a"),
+			"@after:next": done,
+			"@exit":       func() { time.Sleep(10 * time.Microsecond) },
+		},
+	}, fine.WithMailbox(4))
+
+	// Concurrency test (run with `-race`): test that the transitions of
+	// concurrent calls never overlap.
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			machine.Call("next")
+		}()
+	}
+	wg.Wait()
+
+	if violations != 0 {
+		t.Fatalf("wrong number of overlapping transitions: got %d, want 0", violations)
+	}
+	if state := machine.State(); state != "a" {
+		t.Fatalf("wrong state: got %q, want %q", state, "a")
+	}
+}
+
+func TestPost(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var errs []error
+	var mu sync.Mutex
+	var machine *fine.FSM
+	machine = fine.Machine("idle", fine.States{
+		"idle": {"block": func() string {
+			close(started)
+			<-release
+			return "blocked"
+		}},
+		"blocked": {"next": "done"},
+		"done": {"finish": "finished", "@enter": func() {
+			// Test that posting from a lifecycle action does not
+			// deadlock.
+			machine.Post("finish")
+		}},
+		"finished": {},
+	}, fine.WithMailbox(1))
+	machine.OnError(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+
+	// Test that Post does not wait for the action, and fails once the
+	// mailbox is full.
+	if err := machine.Post("block"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-started
+	if err := machine.Post("missing"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := machine.Post("missing"); !errors.Is(err, fine.ErrMailboxFull) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrMailboxFull)
+	}
+	close(release)
+
+	// Test that Call waits for the queued events.
+	if state, err := machine.Call("next"); err != nil || state != "done" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "done")
+	}
+	if _, err := machine.Call("nothing"); err == nil || machine.State() != "finished" {
+		t.Fatalf("wrong state: got %q (%v), want %q", machine.State(), err, "finished")
+	}
+
+	// Test that the errors of the posted events are reported.
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 1 {
+		t.Fatalf("wrong errors: got %v", errs)
+	}
+}
@@ -0,0 +1,52 @@
+package fine
+
+import "fmt"
+
+// WithVersion sets the version of the definition of the FSM, which is saved in
+// its snapshots, so that the ones taken with an older definition can be
+// migrated by Restore. See WithMigration. The default version is zero.
+func WithVersion(version int) Option {
+	return func(m *FSM) {
+		m.version = version
+	}
+}
+
+// WithMigration sets the function that Restore calls to migrate the snapshots
+// taken with an older version of the definition, as set by WithVersion, for
+// example across deploys renaming or removing states. The function receives
+// the version of the snapshot and one of its states, and returns the state it
+// corresponds to in the current definition. It is called for the current
+// state and for every state of the journal, while the history is kept as it
+// was.
+func WithMigration(migrate func(oldVersion int, oldState string) string) Option {
+	return func(m *FSM) {
+		m.migration = migrate
+	}
+}
+
+// migrate returns the given snapshot migrated to the version of the FSM, if
+// it is older and a migration is set. A non-nil error is returned if the
+// snapshot is newer than the FSM.
+func (m *FSM) migrate(snapshot Snapshot) (Snapshot, error) {
+	switch {
+	case snapshot.Version > m.version:
+		return snapshot, fmt.Errorf(
+			"the snapshot version %d is newer than the definition version %d",
+			snapshot.Version, m.version,
+		)
+	case snapshot.Version == m.version || m.migration == nil:
+		return snapshot, nil
+	}
+
+	snapshot.State = m.migration(snapshot.Version, snapshot.State)
+	if snapshot.Initial != "" {
+		snapshot.Initial = m.migration(snapshot.Version, snapshot.Initial)
+	}
+	journal := make([]string, len(snapshot.Journal))
+	for i, state := range snapshot.Journal {
+		journal[i] = m.migration(snapshot.Version, state)
+	}
+	snapshot.Journal = journal
+	snapshot.Version = m.version
+	return snapshot, nil
+}
@@ -0,0 +1,81 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestMigration(t *testing.T) {
+	v1, err := fine.Define(fine.States{
+		"pending": {"pay": "paid"},
+		"paid":    {"ship": "shipped"},
+		"shipped": {},
+	}, fine.WithVersion(1), fine.WithUndo(10))
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	m := v1.NewInstance("pending")
+	m.Do("pay")
+	snapshot := m.Snapshot()
+	if snapshot.Version != 1 {
+		t.Fatalf("wrong version: got %d, want 1", snapshot.Version)
+	}
+
+	// The second version renames "pending" and "paid".
+	var migrated []int
+	v2, err := fine.Define(fine.States{
+		"created":  {"pay": "awaiting"},
+		"awaiting": {"ship": "shipped"},
+		"shipped":  {},
+	}, fine.WithVersion(2), fine.WithUndo(10), fine.WithMigration(func(version int, state string) string {
+		migrated = append(migrated, version)
+		switch state {
+		case "pending":
+			return "created"
+		case "paid":
+			return "awaiting"
+		}
+		return state
+	}))
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+
+	// Test that the older snapshots are migrated, including their initial
+	// state and their journal.
+	restored, err := fine.Restore(v2, snapshot)
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if state := restored.State(); state != "awaiting" {
+		t.Fatalf("wrong state: got %q, want %q", state, "awaiting")
+	}
+	if len(migrated) != 3 || migrated[0] != 1 {
+		t.Fatalf("wrong migrations: got %v, want [1 1 1]", migrated)
+	}
+	if state, err := restored.Undo(); err != nil || state != "created" {
+		t.Fatalf("wrong undo: got (%q, %v), want %q", state, err, "created")
+	}
+	if version := restored.Snapshot().Version; version != 2 {
+		t.Fatalf("wrong version: got %d, want 2", version)
+	}
+
+	// Test that the snapshots of the same version are not migrated.
+	migrated = nil
+	if _, err := fine.Restore(v2, restored.Snapshot()); err != nil || len(migrated) != 0 {
+		t.Fatalf("wrong migrations: got %v (%v), want none", migrated, err)
+	}
+
+	// Test that newer snapshots, and unmigrated ones, cannot be restored.
+	if _, err := fine.Restore(v1, restored.Snapshot()); err == nil {
+		t.Fatalf("error expected for a newer snapshot")
+	}
+	v3, err := fine.Define(fine.States{"created": {}}, fine.WithVersion(3))
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if _, err := fine.Restore(v3, snapshot); err == nil {
+		t.Fatalf("error expected for an unmigrated state")
+	}
+}
@@ -0,0 +1,213 @@
+package fine
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OnEnter registers a callback that is called every time the FSM enters the
+// given state, with the metadata of the transition. The callback runs right
+// after the subscribers have been notified, and before the @enter lifecycle
+// action, without holding any lock.
+//
+// A function to remove the callback is returned.
+func (m *FSM) OnEnter(state string, callback func(metadata Metadata)) func() {
+	return m.OnEnterAny([]string{state}, callback)
+}
+
+// OnEnterAny registers a callback that is called every time the FSM enters any
+// of the given states, as OnEnter does. The state being entered is available
+// as the To field of the metadata.
+//
+// A single function to remove the callback from all the states is returned.
+func (m *FSM) OnEnterAny(states []string, callback func(metadata Metadata)) func() {
+	key := atomic.AddInt32(&m.lastSubKey, 1)
+
+	m.mu.Lock()
+	if m.enterCallbacks == nil {
+		m.enterCallbacks = make(map[string]map[int32]func(Metadata))
+	}
+	for _, state := range states {
+		if m.enterCallbacks[state] == nil {
+			m.enterCallbacks[state] = make(map[int32]func(Metadata))
+		}
+		m.enterCallbacks[state][key] = callback
+	}
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		for _, state := range states {
+			delete(m.enterCallbacks[state], key)
+			if len(m.enterCallbacks[state]) == 0 {
+				delete(m.enterCallbacks, state)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// notifyEnter calls the callbacks registered for entering the destination
+// state of the given transition.
+func (m *FSM) notifyEnter(metadata Metadata) {
+	m.mu.RLock()
+	callbacks := make([]func(Metadata), 0, len(m.enterCallbacks[metadata.To]))
+	for _, callback := range m.enterCallbacks[metadata.To] {
+		callbacks = append(callbacks, callback)
+	}
+	m.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		m.protect(metadata, func() { callback(metadata) })
+	}
+}
+
+// OnEvent registers a callback that is called every time the given event
+// causes a transition, from any state, with the metadata of the transition.
+// The callback runs right after the ones registered with OnEnter, and before
+// the @enter lifecycle action, without holding any lock. Events that do not
+// change the state, and internal transitions, do not call it.
+//
+// A function to remove the callback is returned.
+func (m *FSM) OnEvent(event string, callback func(metadata Metadata)) func() {
+	key := atomic.AddInt32(&m.lastSubKey, 1)
+
+	m.mu.Lock()
+	if m.eventCallbacks == nil {
+		m.eventCallbacks = make(map[string]map[int32]func(Metadata))
+	}
+	if m.eventCallbacks[event] == nil {
+		m.eventCallbacks[event] = make(map[int32]func(Metadata))
+	}
+	m.eventCallbacks[event][key] = callback
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		delete(m.eventCallbacks[event], key)
+		if len(m.eventCallbacks[event]) == 0 {
+			delete(m.eventCallbacks, event)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// OnTransition registers a callback that is called every time the FSM
+// changes state, or reenters a state, with the metadata of the transition, as
+// OnEvent does for every event. The callback runs right after the ones
+// registered with OnEvent.
+//
+// A function to remove the callback is returned.
+func (m *FSM) OnTransition(callback func(metadata Metadata)) func() {
+	key := atomic.AddInt32(&m.lastSubKey, 1)
+
+	m.mu.Lock()
+	if m.transitionCallbacks == nil {
+		m.transitionCallbacks = make(map[int32]func(Metadata))
+	}
+	m.transitionCallbacks[key] = callback
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		delete(m.transitionCallbacks, key)
+		m.mu.Unlock()
+	}
+}
+
+// notifyEvent calls the callbacks registered for the event of the given
+// transition, and then the ones registered for every transition.
+func (m *FSM) notifyEvent(metadata Metadata) {
+	m.mu.RLock()
+	events := m.eventCallbacks[metadata.Event]
+	callbacks := make([]func(Metadata), 0, len(events)+len(m.transitionCallbacks))
+	for _, callback := range events {
+		callbacks = append(callbacks, callback)
+	}
+	for _, callback := range m.transitionCallbacks {
+		callbacks = append(callbacks, callback)
+	}
+	m.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		m.protect(metadata, func() { callback(metadata) })
+	}
+}
+
+// OnDone registers a hook that is called every time an event is done, such as
+// with Do, once its whole transition completed, or once it was rejected or
+// failed. The hook receives the metadata of the event, whose To field is the
+// resulting state, or the empty string if the event was rejected, how long the
+// event took, measured with the Clock of the FSM, and the error returned to
+// the caller, if any. Multiple hooks can be registered, and they run in
+// registration order, without holding any lock.
+//
+// Events that do not change the state, and deferred ones, are reported too,
+// while Undo, Reset and the rollbacks of Atomic are not.
+func (m *FSM) OnDone(hook func(metadata Metadata, duration time.Duration, err error)) {
+	m.mu.Lock()
+	m.doneHooks = append(m.doneHooks, hook)
+	m.mu.Unlock()
+	m.observed.Store(true)
+}
+
+// stepDone logs and reports the outcome of an event.
+func (m *FSM) stepDone(metadata Metadata, duration time.Duration, err error) {
+	if m.logger != nil {
+		m.logger.logStep(metadata.Context, metadata.From, metadata.To, metadata.Event, duration, err)
+	}
+
+	m.mu.RLock()
+	hooks := m.doneHooks
+	m.mu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(metadata, duration, err)
+	}
+}
+
+// Changes returns a channel receiving the metadata of every state change, as
+// the subscribers do, with the given buffer size, and a function to cancel the
+// stream, which closes the channel. Unlike a subscription, the current state
+// is not sent first.
+//
+// Sending to the channel blocks the transition, as a slow subscriber would,
+// once the buffer is full, until the value is received or the stream is
+// cancelled. Cancelling is safe from any goroutine, and more than once.
+func (m *FSM) Changes(buffer int) (<-chan Metadata, func()) {
+	changes := make(chan Metadata, buffer)
+	done := make(chan struct{})
+	var mu sync.Mutex
+	closed := false
+
+	subscribing := true
+	unsubscribe := m.SubscribeMeta(func(metadata Metadata) {
+		if subscribing {
+			subscribing = false
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case changes <- metadata:
+		case <-done:
+		}
+	})
+
+	var once sync.Once
+	return changes, func() {
+		once.Do(func() {
+			// Unblock any pending send before closing the channel.
+			close(done)
+			unsubscribe()
+			mu.Lock()
+			closed = true
+			close(changes)
+			mu.Unlock()
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package fine_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"interrato.dev/fine"
+	"interrato.dev/fine/finetest"
+)
+
+func TestOnEnter(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"next": "a"},
+	})
+
+	var entered []string
+	remove := machine.OnEnter("b", func(metadata fine.Metadata) {
+		entered = append(entered, metadata.From+" -> "+metadata.To)
+	})
+
+	// Test that the callback only runs when entering the given state.
+	machine.Do("next")
+	machine.Do("next")
+	if len(entered) != 1 || entered[0] != "a -> b" {
+		t.Fatalf("wrong entries: got %v, want [a -> b]", entered)
+	}
+
+	// Test that the callback does not run after being removed.
+	remove()
+	machine.Do("next")
+	if len(entered) != 1 {
+		t.Fatalf("wrong entries: got %v, want [a -> b]", entered)
+	}
+}
+
+func TestOnEnterAny(t *testing.T) {
+	machine := fine.Machine("pending", fine.States{
+		"pending":   {"approve": "approved", "reject": "rejected"},
+		"approved":  {"reset": "pending"},
+		"rejected":  {"reset": "pending"},
+		"cancelled": {},
+	})
+
+	var terminal []string
+	remove := machine.OnEnterAny([]string{"approved", "rejected", "cancelled"}, func(metadata fine.Metadata) {
+		terminal = append(terminal, metadata.To)
+	})
+
+	// Test that the callback runs when entering any of the given states.
+	for _, action := range []string{"approve", "reset", "reject", "reset"} {
+		machine.Do(action)
+	}
+	if len(terminal) != 2 || terminal[0] != "approved" || terminal[1] != "rejected" {
+		t.Fatalf("wrong entries: got %v, want [approved rejected]", terminal)
+	}
+
+	// Test that a single removal covers all the states.
+	remove()
+	machine.Do("approve")
+	machine.Do("reset")
+	machine.Do("reject")
+	if len(terminal) != 2 {
+		t.Fatalf("wrong entries: got %v, want [approved rejected]", terminal)
+	}
+}
+
+func TestOnEvent(t *testing.T) {
+	machine := fine.Machine("cart", fine.States{
+		"cart":     {"pay": "paid", "refresh": nil},
+		"invoiced": {"pay": "paid"},
+		"paid":     {"invoice": "invoiced", "pay": nil},
+	})
+
+	var paid []string
+	remove := machine.OnEvent("pay", func(metadata fine.Metadata) {
+		paid = append(paid, metadata.From+" -> "+metadata.To)
+	})
+
+	// Test that the callback runs whenever the event causes a transition,
+	// from any state, and only then.
+	for _, action := range []string{"refresh", "pay", "pay", "invoice", "pay"} {
+		machine.Do(action)
+	}
+	if len(paid) != 2 || paid[0] != "cart -> paid" || paid[1] != "invoiced -> paid" {
+		t.Fatalf("wrong payments: got %v, want [cart -> paid invoiced -> paid]", paid)
+	}
+
+	// Test that the callback does not run after being removed.
+	remove()
+	machine.Do("invoice")
+	machine.Do("pay")
+	if len(paid) != 2 {
+		t.Fatalf("wrong payments: got %v, want [cart -> paid invoiced -> paid]", paid)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"next": "a"},
+	})
+
+	// Test that the state changes are received in order, without the current
+	// state first.
+	changes, cancel := machine.Changes(2)
+	machine.Do("next")
+	machine.Do("next")
+	for _, want := range []string{"a -> b", "b -> a"} {
+		metadata := <-changes
+		if got := metadata.From + " -> " + metadata.To; got != want {
+			t.Fatalf("wrong change: got %q, want %q", got, want)
+		}
+	}
+
+	// Test that cancelling closes the channel, and unblocks a pending send.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		machine.Do("next")
+		machine.Do("next")
+		machine.Do("next")
+	}()
+	<-changes
+	cancel()
+	<-done
+	for range changes {
+		// Drain the values sent before cancelling.
+	}
+	cancel()
+
+	// Concurrency test (run with `-race`).
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, cancel := machine.Changes(0)
+			go machine.Do("next")
+			cancel()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestOnTransition(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b", "stay": nil},
+		"b": {"next": "a"},
+	})
+
+	var transitions []string
+	remove := machine.OnTransition(func(metadata fine.Metadata) {
+		transitions = append(transitions, metadata.Event+": "+metadata.From+" -> "+metadata.To)
+	})
+
+	// Test that the callback runs for every state change, and only then.
+	for _, action := range []string{"next", "next", "stay"} {
+		machine.Do(action)
+	}
+	if len(transitions) != 2 || transitions[0] != "next: a -> b" || transitions[1] != "next: b -> a" {
+		t.Fatalf("wrong transitions: got %v, want [next: a -> b next: b -> a]", transitions)
+	}
+
+	// Test that the callback does not run after being removed.
+	remove()
+	machine.Do("next")
+	if len(transitions) != 2 {
+		t.Fatalf("wrong transitions: got %v", transitions)
+	}
+}
+
+func TestOnDone(t *testing.T) {
+	clock := finetest.NewClock(time.Unix(0, 0))
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"stay": nil, "@enter": func() { clock.Advance(time.Second) }},
+	}, fine.WithClock(clock))
+	type done struct {
+		from, to, event string
+		duration        time.Duration
+		failed          bool
+	}
+	var dones []done
+	machine.OnDone(func(metadata fine.Metadata, duration time.Duration, err error) {
+		dones = append(dones, done{metadata.From, metadata.To, metadata.Event, duration, err != nil})
+	})
+
+	// Test that the events are reported with their durations, including the
+	// ones not changing the state, and the rejected ones.
+	machine.Do("next")
+	machine.Do("stay")
+	machine.Do("missing")
+	want := []done{
+		{"a", "b", "next", time.Second, false},
+		{"b", "b", "stay", 0, false},
+		{"b", "", "missing", 0, true},
+	}
+	if fmt.Sprint(dones) != fmt.Sprint(want) {
+		t.Fatalf("wrong events:\ngot  %v\nwant %v", dones, want)
+	}
+}
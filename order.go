@@ -0,0 +1,100 @@
+package fine
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MachineOrdered behaves like Machine, but it also records the given order of
+// the states, which is then used by States and by the exporters instead of an
+// arbitrary or alphabetical one. States added later, for example with Add, are
+// appended to the order.
+//
+// Note: the given order must contain exactly the given possible states, each
+// of them only once.
+func MachineOrdered(initialState string, order []string, states States, opts ...Option) *FSM {
+	// Check for the order covering exactly the states.
+	seen := make(map[string]bool, len(order))
+	for _, name := range order {
+		if _, ok := states[name]; !ok {
+			panic(fmt.Sprintf("the ordered state %q must exist", name))
+		}
+		if seen[name] {
+			panic(fmt.Sprintf("the ordered state %q must appear only once", name))
+		}
+		seen[name] = true
+	}
+	if len(seen) != len(states) {
+		panic("the order must contain all the states")
+	}
+
+	ordered := append([]string(nil), order...)
+	return Machine(initialState, states, append([]Option{func(m *FSM) {
+		m.order.Store(&ordered)
+	}}, opts...)...)
+}
+
+// reorder updates the order of the states, if any, to match the given states
+// table: removed states are dropped, and new ones are appended alphabetically.
+// The caller must be the one writing the states.
+func (m *FSM) reorder(states stateTable) {
+	order := m.order.Load()
+	if order == nil {
+		return
+	}
+
+	seen := make(map[string]bool, len(*order))
+	updated := make([]string, 0, len(states))
+	for _, name := range *order {
+		if _, ok := states[name]; ok {
+			seen[name] = true
+			updated = append(updated, name)
+		}
+	}
+	var added []string
+	for name := range states {
+		if !seen[name] {
+			added = append(added, name)
+		}
+	}
+	if len(added) == 0 && len(updated) == len(*order) {
+		return
+	}
+	sort.Strings(added)
+	updated = append(updated, added...)
+	m.order.Store(&updated)
+}
+
+// sortStates sorts the given state names following the recorded order, if
+// any, or alphabetically otherwise. Names missing from the order come last.
+func (m *FSM) sortStates(names []string) {
+	less := m.stateLess()
+	sort.SliceStable(names, func(i, j int) bool {
+		return less(names[i], names[j])
+	})
+}
+
+// stateLess returns a function reporting whether the state a comes before the
+// state b, following the recorded order, if any, or alphabetically otherwise.
+func (m *FSM) stateLess() func(a, b string) bool {
+	order := m.order.Load()
+	if order == nil {
+		return func(a, b string) bool { return a < b }
+	}
+
+	ranks := make(map[string]int, len(*order))
+	for i, name := range *order {
+		ranks[name] = i
+	}
+	return func(a, b string) bool {
+		ra, oka := ranks[a]
+		rb, okb := ranks[b]
+		switch {
+		case oka && okb:
+			return ra < rb
+		case oka != okb:
+			return oka
+		}
+		return a < b
+	}
+}
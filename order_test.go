@@ -0,0 +1,62 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestMachineOrdered(t *testing.T) {
+	machine := fine.MachineOrdered("off", []string{"off", "on", "broken"}, fine.States{
+		"off":    {"toggle": "on"},
+		"on":     {"toggle": "off", "break": "broken"},
+		"broken": {},
+	})
+	machine.Add("dead", fine.Transitions{})
+	machine.Add("burnt", fine.Transitions{})
+
+	// Test that the states follow the declared order, with the added ones
+	// appended.
+	want := []string{"off", "on", "broken", "dead", "burnt"}
+	got := machine.States()
+	if len(got) != len(want) {
+		t.Fatalf("wrong states: got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("wrong states: got %v, want %v", got, want)
+		}
+	}
+
+	// Test that the exporters follow the declared order too.
+	wantMermaid := `stateDiagram-v2
+	state "off" as s0
+	state "on" as s1
+	state "broken" as s2
+	[*] --> s0
+	s0 --> s1: toggle
+	s1 --> s2: break
+	s1 --> s0: toggle
+`
+	if got := machine.ExportMermaidReachable(); got != wantMermaid {
+		t.Fatalf("wrong Mermaid:\n%s\nwant:\n%s", got, wantMermaid)
+	}
+}
+
+func TestMachineOrderedInvalid(t *testing.T) {
+	states := fine.States{"a": {}, "b": {}}
+	for _, order := range [][]string{
+		{"a"},
+		{"a", "b", "c"},
+		{"a", "a", "b"},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("panic expected for order %v", order)
+				}
+			}()
+			fine.MachineOrdered("a", order, states)
+		}()
+	}
+}
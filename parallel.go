@@ -0,0 +1,112 @@
+package fine
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ParallelFSM is a machine made of independent regions, each one being an FSM
+// on its own, that are active at the same time. Its configuration is the set
+// of the current states of all the regions, and every action is done in all
+// the regions that handle it.
+type ParallelFSM struct {
+	names   []string
+	regions map[string]*FSM
+}
+
+// Parallel instantiates a new ParallelFSM with the given regions, mapped by
+// their names. The regions can still be used directly, as any other FSM.
+func Parallel(regions map[string]*FSM) *ParallelFSM {
+	p := &ParallelFSM{regions: make(map[string]*FSM, len(regions))}
+	for name, region := range regions {
+		p.names = append(p.names, name)
+		p.regions[name] = region
+	}
+	sort.Strings(p.names)
+
+	return p
+}
+
+// Region returns the region with the given name, or nil if there is none.
+func (p *ParallelFSM) Region(name string) *FSM {
+	return p.regions[name]
+}
+
+// State returns the active configuration, that is the current state of every
+// region in the form "region:state", sorted by region.
+func (p *ParallelFSM) State() []string {
+	configuration := make([]string, len(p.names))
+	for i, name := range p.names {
+		configuration[i] = name + ":" + p.regions[name].State()
+	}
+	return configuration
+}
+
+// Do does the specified action in every region whose current state handles it,
+// and returns the resulting configuration. The regions are changed atomically,
+// as with Atomic: if the action fails in any region, all of them are rolled
+// back, and the error is returned.
+//
+// A non-nil error is also returned if no region handles the action.
+func (p *ParallelFSM) Do(action string, args ...interface{}) ([]string, error) {
+	var handling []*FSM
+	for _, name := range p.names {
+		if p.regions[name].handles(action) {
+			handling = append(handling, p.regions[name])
+		}
+	}
+	if len(handling) == 0 {
+		return p.State(), fmt.Errorf(
+			"%q is not a valid action for any region of %v",
+			action, p.State(),
+		)
+	}
+
+	err := Atomic(func() error {
+		for _, region := range handling {
+			if _, err := region.Do(action, args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, handling...)
+
+	return p.State(), err
+}
+
+// Subscribe allows subscribing to the changes of the configuration, with a
+// callback function receiving the configuration as returned by State. The
+// callback function runs for every state change of any region, so an action
+// done in multiple regions causes multiple calls. It also runs when
+// subscribing, once.
+//
+// A single function to unsubscribe from all the regions is returned.
+func (p *ParallelFSM) Subscribe(callback func(configuration []string)) func() {
+	unsubscribes := make([]func(), 0, len(p.names))
+	for _, name := range p.names {
+		subscribed := false
+		unsubscribes = append(unsubscribes, p.regions[name].Subscribe(func(string) {
+			if subscribed {
+				callback(p.State())
+			}
+			subscribed = true
+		}))
+	}
+	callback(p.State())
+
+	return func() {
+		for _, unsubscribe := range unsubscribes {
+			unsubscribe()
+		}
+	}
+}
+
+// handles reports whether the current state of the FSM handles the given
+// action.
+func (m *FSM) handles(action string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := resolve(m.table()[m.current], m.global.Load(), action)
+	return ok
+}
@@ -0,0 +1,61 @@
+package fine_test
+
+import (
+	"fmt"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func newPlayer() *fine.ParallelFSM {
+	return fine.Parallel(map[string]*fine.FSM{
+		"audio": fine.Machine("stopped", fine.States{
+			"stopped": {"play": "playing"},
+			"playing": {"pause": "paused", "mute": "muted"},
+			"paused":  {"play": "playing"},
+			"muted":   {"pause": "paused"},
+		}),
+		"video": fine.Machine("stopped", fine.States{
+			"stopped": {"play": "playing"},
+			"playing": {"pause": "paused"},
+			"paused":  {"play": "playing"},
+		}),
+	})
+}
+
+func TestParallel(t *testing.T) {
+	player := newPlayer()
+	var notified [][]string
+	player.Subscribe(func(configuration []string) {
+		notified = append(notified, configuration)
+	})
+
+	// Test that actions are done in all the regions handling them.
+	for _, tc := range []struct {
+		action string
+		want   []string
+	}{
+		{"play", []string{"audio:playing", "video:playing"}},
+		{"mute", []string{"audio:muted", "video:playing"}},
+		{"pause", []string{"audio:paused", "video:paused"}},
+	} {
+		got, err := player.Do(tc.action)
+		if err != nil {
+			t.Fatalf("no error expected, got: %v", err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Fatalf("wrong configuration: got %v, want %v", got, tc.want)
+		}
+	}
+	if len(notified) != 6 {
+		t.Fatalf("wrong number of notifications: got %d, want %d", len(notified), 6)
+	}
+
+	// Test that an action handled by no region is rejected.
+	if _, err := player.Do("rewind"); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+	if state := player.Region("audio").State(); state != "paused" {
+		t.Fatalf("wrong state: got %q, want %q", state, "paused")
+	}
+}
@@ -0,0 +1,245 @@
+package fine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ProductState returns the name of the state of a product machine, as built by
+// Product, in which the first component is in state a, and the second one is
+// in state b.
+func ProductState(a, b string) string {
+	return a + "|" + b
+}
+
+// Product returns the Definition of the composition of the two given
+// machines, whose states are all the pairs of their states, named by
+// ProductState. The events of the components are interleaved: doing one of
+// them moves only the component handling it, with its action, while the
+// other one stays in its state.
+//
+// The given sync map pairs events of the first machine with events of the
+// second one, so that they happen together: the product has the event of the
+// first machine, which is enabled only when both components handle their
+// events, and moves both of them. Synchronized actions that are targets, nil,
+// or Transition values, are composed into a Transition, running both attached
+// actions; every other combination is composed into a function action,
+// executing both actions in order, without their modifiers, such as Internal,
+// Reenter and Timeout, and without their attached actions.
+//
+// The lifecycle actions of a component run when the component leaves or
+// enters its states, and on reentries, receiving the metadata of the product
+// transition. The transition-scoped hooks of the interleaved events are kept,
+// while the ones of the synchronized events are dropped. A pair is final when
+// both its states are final.
+//
+// A non-nil error is returned if an event is handled by both machines without
+// being synchronized, if a synchronized event is not handled by its machine,
+// or if the product is not valid, as for Define.
+func Product(a, b *Definition, sync map[string]string) (*Definition, error) {
+	eventsA, eventsB := a.events(), b.events()
+	synced := make(map[string]bool, len(sync))
+	for _, eventA := range sortedKeys(sync) {
+		eventB := sync[eventA]
+		switch {
+		case !eventsA[eventA]:
+			return nil, fmt.Errorf("the synchronized event %q is not handled by the first machine", eventA)
+		case !eventsB[eventB]:
+			return nil, fmt.Errorf("the synchronized event %q is not handled by the second machine", eventB)
+		}
+		synced[eventB] = true
+	}
+	for _, event := range sortedKeys(eventsB) {
+		if eventsA[event] && !synced[event] {
+			return nil, fmt.Errorf("the event %q is handled by both machines, but it is not synchronized", event)
+		}
+	}
+
+	pairs := make(map[string][2]string, len(a.states)*len(b.states))
+	for nameA := range a.states {
+		for nameB := range b.states {
+			pairs[ProductState(nameA, nameB)] = [2]string{nameA, nameB}
+		}
+	}
+
+	states := make(States, len(pairs))
+	for name, pair := range pairs {
+		pair := pair
+		sa, sb := a.states[pair[0]], b.states[pair[1]]
+		transitions := make(Transitions)
+		for event, value := range sa.transitions {
+			if _, ok := sync[scopedEvent(event)]; ok {
+				continue
+			}
+			if _, ok := sa.actions[event]; ok {
+				transitions[event] = productAction(value, pair[0], func(target string) string {
+					return ProductState(target, pair[1])
+				})
+			} else if isScopedHook(event) {
+				transitions[event] = value
+			}
+		}
+		for event, value := range sb.transitions {
+			if synced[scopedEvent(event)] {
+				continue
+			}
+			if _, ok := sb.actions[event]; ok {
+				transitions[event] = productAction(value, pair[1], func(target string) string {
+					return ProductState(pair[0], target)
+				})
+			} else if isScopedHook(event) {
+				transitions[event] = value
+			}
+		}
+		for eventA, eventB := range sync {
+			valueA, okA := sa.transitions[eventA]
+			valueB, okB := sb.transitions[eventB]
+			if okA && okB {
+				transitions[eventA] = syncAction(valueA, valueB, pair)
+			}
+		}
+		if sa.enter != nil || sb.enter != nil {
+			transitions["@enter"] = productHook(sa.enter, sb.enter, pairs, 0)
+		}
+		if sa.exit != nil || sb.exit != nil {
+			transitions["@exit"] = productHook(sa.exit, sb.exit, pairs, 1)
+		}
+		if sa.final && sb.final {
+			transitions[Final] = true
+		}
+		states[name] = transitions
+	}
+	return Define(states)
+}
+
+// scopedEvent returns the event the given key refers to, which is the key
+// itself, unless it is the key of a transition-scoped hook.
+func scopedEvent(key string) string {
+	if !isScopedHook(key) {
+		return key
+	}
+	return key[strings.Index(key, ":")+1:]
+}
+
+// events returns the set of the events handled by any state of the
+// Definition.
+func (d *Definition) events() map[string]bool {
+	events := make(map[string]bool)
+	for _, s := range d.states {
+		for event := range s.actions {
+			events[event] = true
+		}
+	}
+	return events
+}
+
+// productAction returns the action of a product state for the given action of
+// a component, which is in the given state, mapping its targets with wrap.
+func productAction(value interface{}, current string, wrap func(string) string) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return wrap(v)
+	case History:
+		return History(wrap(string(v)))
+	case DeepHistory:
+		return DeepHistory(wrap(string(v)))
+	case Reenter:
+		return Reenter(wrap(string(v)))
+	case Transition:
+		return Transition{Target: wrap(v.Target), Action: v.Action}
+	case Dispatch:
+		d := make(Dispatch, len(v))
+		for key, target := range v {
+			d[key] = wrap(target)
+		}
+		return d
+	case Internal:
+		return Internal{Action: productAction(v.Action, current, wrap)}
+	case Timeout:
+		return Timeout{After: v.After, Action: productAction(v.Action, current, wrap)}
+	}
+
+	a := compileAction("", "", value)
+	return func(ctx context.Context, args ...interface{}) (string, error) {
+		target, err := a.exec(ctx, current, args)
+		return wrap(target), err
+	}
+}
+
+// syncAction returns the action of the given product state for the given
+// synchronized actions of its components.
+func syncAction(valueA, valueB interface{}, pair [2]string) interface{} {
+	targetA, effectA, okA := plainTarget(valueA, pair[0])
+	targetB, effectB, okB := plainTarget(valueB, pair[1])
+	if okA && okB {
+		t := Transition{Target: ProductState(targetA, targetB)}
+		if effectA != nil || effectB != nil {
+			t.Action = func(metadata Metadata) {
+				for _, effect := range []func(Metadata){effectA, effectB} {
+					if effect != nil {
+						effect(metadata)
+					}
+				}
+			}
+		}
+		return t
+	}
+
+	a, b := compileAction("", "", valueA), compileAction("", "", valueB)
+	return func(ctx context.Context, args ...interface{}) (string, error) {
+		current := ProductState(pair[0], pair[1])
+		targetA, err := a.exec(ctx, pair[0], args)
+		if err != nil {
+			return current, err
+		}
+		targetB, err := b.exec(ctx, pair[1], args)
+		if err != nil {
+			return current, err
+		}
+		return ProductState(targetA, targetB), nil
+	}
+}
+
+// plainTarget returns the target and the attached action of the given action
+// of a component in the given state, if it is a target, nil, or a Transition.
+func plainTarget(value interface{}, current string) (string, func(Metadata), bool) {
+	switch v := value.(type) {
+	case nil:
+		return current, nil, true
+	case string:
+		return v, nil, true
+	case Transition:
+		return v.Target, v.Action, true
+	}
+	return "", nil, false
+}
+
+// productHook returns the lifecycle action of a product state, running the
+// given ones of the components, if any, when the component at the given index
+// of the pairs changes state, in the transition side given by side: 0 for
+// @enter, comparing with the source state, 1 for @exit, comparing with the
+// destination one. The result of the first component takes precedence.
+func productHook(hookA, hookB hook, pairs map[string][2]string, side int) func(*FSM, Metadata) interface{} {
+	return func(m *FSM, metadata Metadata) interface{} {
+		here, there := metadata.To, metadata.From
+		if side == 1 {
+			here, there = metadata.From, metadata.To
+		}
+		other, known := pairs[there]
+		reentry := here == there
+
+		var result interface{}
+		for i, h := range []hook{hookA, hookB} {
+			if h == nil || known && !reentry && other[i] == pairs[here][i] {
+				continue
+			}
+			if r := h(m, metadata); result == nil {
+				result = r
+			}
+		}
+		return result
+	}
+}
@@ -0,0 +1,84 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestProduct(t *testing.T) {
+	var lit, pressed int
+	led, err := fine.Define(fine.States{
+		"off": {"toggle": "on"},
+		"on":  {"toggle": "off", "dim": func() string { return "off" }, "@enter": func() { lit++ }},
+	})
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	button, err := fine.Define(fine.States{
+		"released": {"press": "pressed"},
+		"pressed":  {"release": "released", "@enter": func() { pressed++ }},
+	})
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+
+	// Test that pressing the button toggles the LED, while releasing it
+	// only moves the button.
+	d, err := fine.Product(led, button, map[string]string{"toggle": "press"})
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if states := d.States(); len(states) != 4 {
+		t.Fatalf("wrong states: got %v", states)
+	}
+	m := d.NewInstance(fine.ProductState("off", "released"))
+	for _, step := range []struct {
+		event string
+		want  string
+	}{
+		{"toggle", fine.ProductState("on", "pressed")},
+		{"release", fine.ProductState("on", "released")},
+		{"dim", fine.ProductState("off", "released")},
+		{"toggle", fine.ProductState("on", "pressed")},
+	} {
+		if state, err := m.Do(step.event); err != nil || state != step.want {
+			t.Fatalf("wrong state after %q: got %q (%v), want %q", step.event, state, err, step.want)
+		}
+	}
+
+	// Test that synchronized events need both components to handle them.
+	if _, err := m.Do("toggle"); err == nil {
+		t.Fatalf("error expected for a disabled synchronized event")
+	}
+
+	// Test that the lifecycle actions only run for the components that
+	// change state.
+	m.Do("release")
+	if lit != 2 || pressed != 2 {
+		t.Fatalf("wrong @enter calls: got %d and %d, want 2 and 2", lit, pressed)
+	}
+}
+
+func TestProductErrors(t *testing.T) {
+	a, _ := fine.Define(fine.States{"idle": {"reset": "idle", "go": "idle"}})
+	b, _ := fine.Define(fine.States{"idle": {"reset": "idle", "run": "idle"}})
+
+	// Test that shared events must be synchronized.
+	if _, err := fine.Product(a, b, nil); err == nil {
+		t.Fatalf("error expected for an unsynchronized shared event")
+	}
+	if _, err := fine.Product(a, b, map[string]string{"reset": "reset"}); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+
+	// Test that the synchronized events must exist.
+	for _, sync := range []map[string]string{
+		{"reset": "reset", "missing": "run"},
+		{"reset": "reset", "go": "missing"},
+	} {
+		if _, err := fine.Product(a, b, sync); err == nil {
+			t.Fatalf("error expected for %v", sync)
+		}
+	}
+}
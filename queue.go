@@ -0,0 +1,59 @@
+package fine
+
+// WithRunToCompletion makes the FSM process one event at a time, running every
+// transition to completion before starting the next one. A Do made while a
+// transition is in progress, for example from a lifecycle action or a
+// subscriber, or from another goroutine, does not execute anything: the event
+// is appended to a FIFO queue, and Do returns the current state with a nil
+// error right away. The queued events are then processed in order by the Do
+// that started the transition, before it returns, and the errors they cause
+// are reported to the hooks registered with OnError.
+//
+// By default, instead, a Do made from a lifecycle action runs immediately,
+// nested in the transition in progress, which interleaves the two
+// transitions.
+func WithRunToCompletion() Option {
+	return func(m *FSM) {
+		m.runToCompletion = true
+	}
+}
+
+// enqueue queues the given event if a transition is in progress, returning the
+// current state, or returns errBusy instead for an event done with TryDo.
+// Otherwise, it marks the FSM as busy, and the caller must call drain once
+// done.
+func (m *FSM) enqueue(e pendingEvent) (string, bool, error) {
+	m.qmu.Lock()
+	defer m.qmu.Unlock()
+
+	switch {
+	case !m.busy:
+		m.busy = true
+		return "", false, nil
+	case e.try:
+		return m.State(), false, errBusy
+	}
+	m.queue = append(m.queue, e)
+	return m.State(), true, nil
+}
+
+// drain processes the queued events in order, until there are none left, and
+// then marks the FSM as idle.
+func (m *FSM) drain() {
+	for {
+		m.qmu.Lock()
+		if len(m.queue) == 0 {
+			m.queue = nil
+			m.busy = false
+			m.qmu.Unlock()
+			return
+		}
+		e := m.queue[0]
+		m.queue = m.queue[1:]
+		m.qmu.Unlock()
+
+		if _, _, err := m.run(e); err != nil {
+			m.report(err)
+		}
+	}
+}
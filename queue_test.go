@@ -0,0 +1,77 @@
+package fine_test
+
+import (
+	"sync"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestWithRunToCompletion(t *testing.T) {
+	var events []string
+	var machine *fine.FSM
+	machine = fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {
+			"@enter": func() {
+				state, err := machine.Do("next")
+				events = append(events, "queued from "+state)
+				if err != nil {
+					t.Errorf("no error expected, got: %v", err)
+				}
+				events = append(events, "@enter b done")
+			},
+			"@exit": func() { events = append(events, "@exit b") },
+			"next":  "c",
+		},
+		"c": {},
+	}, fine.WithRunToCompletion())
+
+	// Test that the event done from the lifecycle action is processed
+	// after the transition completes, before Do returns.
+	if state, err := machine.Do("next"); err != nil || state != "b" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "b")
+	}
+	if state := machine.State(); state != "c" {
+		t.Fatalf("wrong state: got %q, want %q", state, "c")
+	}
+	want := []string{"queued from b", "@enter b done", "@exit b"}
+	if len(events) != len(want) {
+		t.Fatalf("wrong events: got %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("wrong events: got %v, want %v", events, want)
+		}
+	}
+}
+
+func TestWithRunToCompletionConcurrent(t *testing.T) {
+	var count int
+	machine := fine.Machine("off", fine.States{
+		"off": {"toggle": "on"},
+		"on": {
+			"@enter": func() { count++ },
+			"toggle": "off",
+		},
+	}, fine.WithRunToCompletion())
+
+	// Concurrency test (run with `-race`): test that every event is processed
+	// exactly once, either directly or from the queue.
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			machine.Do("toggle")
+		}()
+	}
+	wg.Wait()
+
+	if count != concurrentRuns/2 {
+		t.Fatalf("wrong number of entries: got %d, want %d", count, concurrentRuns/2)
+	}
+	if state := machine.State(); state != "off" {
+		t.Fatalf("wrong state: got %q, want %q", state, "off")
+	}
+}
@@ -0,0 +1,68 @@
+package fine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRateLimited is returned by Do when an event is done again too soon after
+// its last execution, according to the limit set with SetRateLimit.
+var ErrRateLimited = errors.New("rate limited")
+
+// SetRateLimit limits how often the given event can be done: Do rejects the
+// event, with an error wrapping ErrRateLimited and without any change, if less
+// than minInterval elapsed since its last successful execution, in any state.
+// Setting a non-positive minInterval removes the limit.
+//
+// Rejected requests are dropped, not delayed: see DoDebounced for coalescing
+// bursts of requests instead. Since the limit is enforced by Do, it applies to
+// every other method that executes the event through it, such as DoDebounced.
+// Time is measured with the Clock of the FSM.
+func (m *FSM) SetRateLimit(event string, minInterval time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if minInterval <= 0 {
+		delete(m.rateLimits, event)
+		return
+	}
+	if m.rateLimits == nil {
+		m.rateLimits = make(map[string]time.Duration)
+		m.lastFired = make(map[string]time.Time)
+	}
+	m.rateLimits[event] = minInterval
+}
+
+// rateLimit checks that the given limited event is not done too soon since its
+// last successful execution, returning the current time, to be recorded with
+// fired once the event succeeds.
+func (m *FSM) rateLimit(event string) (time.Time, error) {
+	now := m.clock.Now()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limit, ok := m.rateLimits[event]
+	if !ok {
+		return now, nil
+	}
+	if last, ok := m.lastFired[event]; ok && now.Sub(last) < limit {
+		return now, fmt.Errorf(
+			"%w: event %q can be done at most once every %v",
+			ErrRateLimited, event, limit,
+		)
+	}
+	return now, nil
+}
+
+// fired records the successful execution of the given limited event at the
+// given time.
+func (m *FSM) fired(event string, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rateLimits[event]; ok {
+		m.lastFired[event] = at
+	}
+}
@@ -0,0 +1,73 @@
+package fine_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"interrato.dev/fine"
+	"interrato.dev/fine/finetest"
+)
+
+func TestSetRateLimit(t *testing.T) {
+	clock := finetest.NewClock(time.Unix(0, 0))
+	machine := fine.Machine("locked", fine.States{
+		"locked":   {"unlock": "unlocked"},
+		"unlocked": {"lock": "locked"},
+	}, fine.WithClock(clock))
+	machine.SetRateLimit("unlock", time.Second)
+
+	// Test that the first execution is allowed.
+	if _, err := machine.Do("unlock"); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+
+	// Test that executing again too soon is rejected without any change.
+	machine.Do("lock")
+	clock.Advance(500 * time.Millisecond)
+	_, err := machine.Do("unlock")
+	if !errors.Is(err, fine.ErrRateLimited) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrRateLimited)
+	}
+	if state := machine.State(); state != "locked" {
+		t.Fatalf("wrong state: got %q, want %q", state, "locked")
+	}
+
+	// Test that executing again after the interval is allowed.
+	clock.Advance(500 * time.Millisecond)
+	if _, err := machine.Do("unlock"); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+
+	// Test that removing the limit allows any execution.
+	machine.SetRateLimit("unlock", 0)
+	machine.Do("lock")
+	if _, err := machine.Do("unlock"); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+}
+
+func TestRateLimitFailure(t *testing.T) {
+	clock := finetest.NewClock(time.Unix(0, 0))
+	failure := errors.New("jammed")
+	jammed := true
+	machine := fine.Machine("locked", fine.States{
+		"locked": {"unlock": func() (string, error) {
+			if jammed {
+				return "", failure
+			}
+			return "unlocked", nil
+		}},
+		"unlocked": {},
+	}, fine.WithClock(clock))
+	machine.SetRateLimit("unlock", time.Hour)
+
+	// Test that a failed execution does not count against the limit.
+	if _, err := machine.Do("unlock"); !errors.Is(err, failure) {
+		t.Fatalf("wrong error: got %v, want %v", err, failure)
+	}
+	jammed = false
+	if state, err := machine.Do("unlock"); err != nil || state != "unlocked" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "unlocked")
+	}
+}
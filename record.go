@@ -0,0 +1,64 @@
+package fine
+
+import "time"
+
+// Record is a past transition of the FSM, as returned by History.
+type Record struct {
+	Metadata
+
+	// Time is when the state changed, according to the Clock of the FSM.
+	Time time.Time
+}
+
+// WithHistory makes the FSM record its last n transitions, so that History
+// can return them. A non-positive n disables the recording.
+func WithHistory(n int) Option {
+	return func(m *FSM) {
+		m.historyDepth = n
+	}
+}
+
+// History returns the last transitions of the FSM, from the oldest to the
+// newest, as recorded when enabled with WithHistory, or nil otherwise. Every
+// state change is recorded, including the ones of Reset, Undo and of the
+// rollbacks of Atomic, which have their own pseudo-events.
+//
+// Not to be confused with the History action, which resumes an embedded
+// machine.
+func (m *FSM) History() []Record {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.historyDepth <= 0 {
+		return nil
+	}
+	records := make([]Record, 0, len(m.records))
+	if len(m.records) == m.historyDepth {
+		records = append(records, m.records[m.nextRecord:]...)
+	}
+	return append(records, m.records[:m.nextRecord]...)
+}
+
+// record records the given transition, if enabled, as happening now. The
+// caller must hold m.mu for writing.
+func (m *FSM) record(metadata Metadata) {
+	if m.historyDepth <= 0 {
+		return
+	}
+	m.appendRecord(Record{Metadata: metadata, Time: m.clock.Now()})
+}
+
+// appendRecord appends the given record to the history, if enabled,
+// overwriting the oldest one when the history is full. The caller must hold
+// m.mu for writing.
+func (m *FSM) appendRecord(r Record) {
+	if m.historyDepth <= 0 {
+		return
+	}
+	if len(m.records) < m.historyDepth {
+		m.records = append(m.records, r)
+	} else {
+		m.records[m.nextRecord] = r
+	}
+	m.nextRecord = (m.nextRecord + 1) % m.historyDepth
+}
@@ -0,0 +1,85 @@
+package fine_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"interrato.dev/fine"
+	"interrato.dev/fine/finetest"
+)
+
+func TestHistoryRecords(t *testing.T) {
+	clock := finetest.NewClock(time.Unix(0, 0))
+	m := fine.Machine("0", fine.States{
+		"0": {"next": "1"},
+		"1": {"next": "2"},
+		"2": {"next": "3", "stay": nil},
+		"3": {},
+	}, fine.WithHistory(2), fine.WithClock(clock))
+
+	// Test that nothing is recorded before any transition.
+	if h := m.History(); len(h) != 0 {
+		t.Fatalf("wrong history: got %v, want none", h)
+	}
+
+	m.Do("next")
+	clock.Advance(time.Second)
+	m.Do("next", "arg")
+	clock.Advance(time.Second)
+	m.Do("stay")
+
+	// Test that the transitions are recorded in order, with their metadata
+	// and timestamps, while actions that do not change state are not.
+	h := m.History()
+	if len(h) != 2 {
+		t.Fatalf("wrong history length: got %d, want 2", len(h))
+	}
+	if h[0].From != "0" || h[0].To != "1" || h[0].Event != "next" || !h[0].Time.Equal(time.Unix(0, 0)) {
+		t.Fatalf("wrong first record: got %+v", h[0])
+	}
+	if h[1].From != "1" || h[1].To != "2" || len(h[1].Args) != 1 || !h[1].Time.Equal(time.Unix(1, 0)) {
+		t.Fatalf("wrong second record: got %+v", h[1])
+	}
+
+	// Test that the oldest transitions are dropped when the history is full.
+	m.Do("next")
+	h = m.History()
+	if len(h) != 2 || h[0].To != "2" || h[1].To != "3" {
+		t.Fatalf("wrong history: got %+v, want the last two transitions", h)
+	}
+
+	// Test that without the option nothing is recorded.
+	m = fine.Machine("0", fine.States{"0": {"next": "1"}, "1": {}})
+	m.Do("next")
+	if h := m.History(); h != nil {
+		t.Fatalf("wrong history: got %v, want nil", h)
+	}
+}
+
+// Concurrency test (run with `-race`): test that recording and reading the
+// history concurrently do not race.
+func TestHistoryRecordsConcurrent(t *testing.T) {
+	m := fine.Machine("off", fine.States{
+		"off": {"toggle": "on"},
+		"on":  {"toggle": "off"},
+	}, fine.WithHistory(10))
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			m.Do("toggle")
+		}()
+		go func() {
+			defer wg.Done()
+			m.History()
+		}()
+	}
+	wg.Wait()
+
+	if h := m.History(); len(h) != 10 {
+		t.Fatalf("wrong history length: got %d, want 10", len(h))
+	}
+}
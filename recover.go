@@ -0,0 +1,83 @@
+package fine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPanic is returned by Do when, with WithRecover, the action panics.
+var ErrPanic = errors.New("action panicked")
+
+// ErrSubscriberPanic is reported to the hooks registered with OnError when a
+// subscriber panics, unless the FSM uses WithRecover.
+var ErrSubscriberPanic = errors.New("subscriber panicked")
+
+// WithRecover makes the FSM recover the panics of the user code it runs, that
+// is actions, lifecycle actions, transition-scoped hooks, the actions attached
+// to Transition values, subscribers, and the callbacks registered with OnEnter.
+// The given handler receives the recovered value, and the metadata of the
+// transition during which the panic happened.
+//
+// The panics of the subscribers are recovered even without this option: see
+// ErrSubscriberPanic.
+//
+// The FSM is always left in a consistent state: when an action panics, the
+// transition is aborted and Do returns an error wrapping ErrPanic, as if the
+// action failed, while when any other callback panics, it is skipped and the
+// transition carries on.
+func WithRecover(handler func(recovered interface{}, metadata Metadata)) Option {
+	return func(m *FSM) {
+		m.recoverHandler = handler
+	}
+}
+
+// protect calls the given function, recovering any panic and passing it to
+// the handler given to WithRecover, along with the given metadata, if the FSM
+// uses it. It returns the recovered value, and whether the function panicked.
+func (m *FSM) protect(metadata Metadata, fn func()) (recovered interface{}, panicked bool) {
+	if m.recoverHandler == nil {
+		fn()
+		return nil, false
+	}
+
+	// A panicking function never clears the flag, which also detects
+	// panic(nil).
+	panicked = true
+	defer func() {
+		if panicked {
+			recovered = recover()
+			m.recoverHandler(recovered, metadata)
+		}
+	}()
+	fn()
+	return nil, false
+}
+
+// call calls the given subscriber with the given metadata, always recovering
+// any panic, so that a panicking subscriber never leaves the FSM locked nor
+// prevents the other subscribers from being notified. The panic is passed to
+// the handler given to WithRecover, if the FSM uses it, or returned as an
+// error wrapping ErrSubscriberPanic otherwise, which the caller must report
+// once it does not hold any lock.
+func (m *FSM) call(s *subscriber, metadata Metadata) (err error) {
+	if m.recoverHandler != nil {
+		m.protect(metadata, func() { s.callback(metadata) })
+		return nil
+	}
+
+	panicked := true
+	defer func() {
+		if panicked {
+			err = fmt.Errorf("%w: %v", ErrSubscriberPanic, recover())
+		}
+	}()
+	s.callback(metadata)
+	panicked = false
+	return nil
+}
+
+// panicError returns the error for an action that panicked with the given
+// value.
+func panicError(action string, recovered interface{}) error {
+	return fmt.Errorf("%w: action %q: %v", ErrPanic, action, recovered)
+}
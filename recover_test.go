@@ -0,0 +1,103 @@
+package fine_test
+
+import (
+	"errors"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestWithRecover(t *testing.T) {
+	var recovered []interface{}
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"crash": func() string { panic("boom") },
+			"next":  "b",
+			"@exit": func() { panic("exit") },
+		},
+		"b": {
+			"@enter": func() { panic("enter") },
+		},
+	}, fine.WithRecover(func(r interface{}, md fine.Metadata) {
+		recovered = append(recovered, r)
+	}))
+
+	// Test that a panicking action aborts the transition.
+	state, err := machine.Do("crash")
+	if !errors.Is(err, fine.ErrPanic) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrPanic)
+	}
+	if state != "a" || machine.State() != "a" {
+		t.Fatalf("wrong state: got %q, want %q", machine.State(), "a")
+	}
+	if len(recovered) != 1 || recovered[0] != "boom" {
+		t.Fatalf("wrong recovered values: got %v", recovered)
+	}
+
+	// Test that panicking lifecycle actions and subscribers are skipped.
+	machine.Subscribe(func(state string) {
+		if state == "b" {
+			panic("subscriber")
+		}
+	})
+	if state, err := machine.Do("next"); err != nil || state != "b" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "b")
+	}
+	want := []interface{}{"boom", "exit", "subscriber", "enter"}
+	if len(recovered) != len(want) {
+		t.Fatalf("wrong recovered values: got %v, want %v", recovered, want)
+	}
+	for i := range want {
+		if recovered[i] != want[i] {
+			t.Fatalf("wrong recovered values: got %v, want %v", recovered, want)
+		}
+	}
+
+	// Test that the FSM is still usable, with no lock held.
+	if state := machine.State(); state != "b" {
+		t.Fatalf("wrong state: got %q, want %q", state, "b")
+	}
+}
+
+func TestSubscriberPanic(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"next": "a"},
+	})
+	var reported []error
+	machine.OnError(func(err error) {
+		reported = append(reported, err)
+	})
+
+	// Test that a panicking subscriber is reported, and does not prevent the
+	// others from being notified.
+	var notified []string
+	machine.Subscribe(func(state string) {
+		if state == "b" {
+			panic("boom")
+		}
+	})
+	machine.Subscribe(func(state string) {
+		notified = append(notified, state)
+	})
+	if state, err := machine.Do("next"); err != nil || state != "b" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "b")
+	}
+	if len(notified) != 2 || notified[1] != "b" {
+		t.Fatalf("wrong notifications: got %v, want [a b]", notified)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], fine.ErrSubscriberPanic) {
+		t.Fatalf("wrong errors: got %v, want [%v]", reported, fine.ErrSubscriberPanic)
+	}
+
+	// Test that the FSM is not left locked.
+	if state, err := machine.Do("next"); err != nil || state != "a" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "a")
+	}
+
+	// Test that a subscriber panicking when subscribing is reported too.
+	machine.Subscribe(func(string) { panic("boom") })
+	if len(reported) != 2 {
+		t.Fatalf("wrong errors: got %v, want 2 errors", reported)
+	}
+}
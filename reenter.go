@@ -0,0 +1,14 @@
+package fine
+
+// Reenter is an action leading to the named state, like a string action, but
+// when the named state is the current one, the state is exited and entered
+// again: the @exit and @enter lifecycle actions are executed, the subscribers
+// are notified, any embedded machine restarts, and every call scheduled while
+// in the state, such as the ones requested with DoDebounced, is cancelled.
+// This is useful to restart a timer started on entering a state.
+//
+// For example, the following action keeps the FSM in the "on" state,
+// restarting it from scratch.
+//
+//	"touch": fine.Reenter("on")
+type Reenter string
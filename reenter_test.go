@@ -0,0 +1,53 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestReenter(t *testing.T) {
+	var events []string
+	machine := fine.Machine("off", fine.States{
+		"off": {"touch": fine.Reenter("on")},
+		"on": {
+			"touch":  fine.Reenter("on"),
+			"stay":   "on",
+			"@enter": func(md fine.Metadata) { events = append(events, "@enter "+md.From) },
+			"@exit":  func(md fine.Metadata) { events = append(events, "@exit "+md.To) },
+		},
+	})
+	machine.Subscribe(func(state string) {
+		events = append(events, "notify "+state)
+	})
+	events = nil
+
+	// Test that a Reenter action to another state behaves like a string one.
+	if state, err := machine.Do("touch"); err != nil || state != "on" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "on")
+	}
+	if len(events) != 2 {
+		t.Fatalf("wrong events: got %v", events)
+	}
+
+	// Test that a plain self-transition does nothing.
+	events = nil
+	machine.Do("stay")
+	if len(events) != 0 {
+		t.Fatalf("no events expected, got: %v", events)
+	}
+
+	// Test that a Reenter self-transition exits and enters the state again.
+	if state, err := machine.Do("touch"); err != nil || state != "on" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "on")
+	}
+	want := []string{"@exit on", "notify on", "@enter on"}
+	if len(events) != len(want) {
+		t.Fatalf("wrong events: got %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("wrong events: got %v, want %v", events, want)
+		}
+	}
+}
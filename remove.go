@@ -0,0 +1,68 @@
+package fine
+
+import "fmt"
+
+// Remove removes the named state from the FSM, along with everything that was
+// registered for it, such as its embedded machine, its result, the events it
+// defers, and its entries in the journal of Undo, which then skips it. The
+// transitions of the other states leading to it are kept, so they should be
+// removed or replaced too.
+//
+// A non-nil error is returned, and nothing is removed, if the state does not
+// exist, or if it is the current or the initial state of the FSM.
+func (m *FSM) Remove(state string) error {
+	var err error
+	m.writeStatesLocked(func(states stateTable) {
+		switch {
+		case states[state] == nil:
+			err = fmt.Errorf("the state %q does not exist", state)
+			return
+		case state == m.current:
+			err = fmt.Errorf("cannot remove the current state %q", state)
+			return
+		case state == m.initial:
+			err = fmt.Errorf("cannot remove the initial state %q", state)
+			return
+		}
+
+		delete(states, state)
+		delete(m.embedded, state)
+		delete(m.enterCallbacks, state)
+		delete(m.results, state)
+		delete(m.forbidden, state)
+		delete(m.deferrals, state)
+		m.pruneJournal(state)
+	})
+
+	return err
+}
+
+// RemoveTransition removes the given event from the transitions of the named
+// state. Any key can be removed, including the ones of the lifecycle actions.
+//
+// A non-nil error is returned, and nothing is removed, if the state does not
+// exist, or if it has no such event.
+func (m *FSM) RemoveTransition(state, event string) error {
+	var err error
+	m.writeStates(func(states stateTable) {
+		s := states[state]
+		if s == nil {
+			err = fmt.Errorf("the state %q does not exist", state)
+			return
+		}
+		if _, ok := s.transitions[event]; !ok {
+			err = fmt.Errorf("the state %q has no transition for %q", state, event)
+			return
+		}
+
+		transitions := make(Transitions, len(s.transitions)-1)
+		for key, value := range s.transitions {
+			if key != event {
+				transitions[key] = value
+			}
+		}
+		states[state] = compileState(state, transitions)
+	})
+
+	return err
+}
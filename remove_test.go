@@ -0,0 +1,70 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestRemove(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []fine.Option
+	}{
+		{"default", nil},
+		{"cow", []fine.Option{fine.WithCopyOnWrite()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			machine := fine.Machine("a", fine.States{
+				"a": {"next": "b"},
+				"b": {"next": "c"},
+				"c": {},
+			}, tc.opts...)
+			machine.Do("next")
+
+			// Test that the current, the initial, and missing states cannot
+			// be removed.
+			for _, state := range []string{"a", "b", "missing"} {
+				if err := machine.Remove(state); err == nil {
+					t.Fatalf("error expected removing %q, got <nil>", state)
+				}
+			}
+
+			// Test that other states can be removed.
+			if err := machine.Remove("c"); err != nil {
+				t.Fatalf("no error expected, got: %v", err)
+			}
+			if machine.Exists("c") || len(machine.States()) != 2 {
+				t.Fatalf("wrong states: got %v", machine.States())
+			}
+		})
+	}
+}
+
+func TestRemoveTransition(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b", "skip": "c"},
+		"b": {},
+		"c": {},
+	})
+
+	// Test that missing states and events are reported.
+	if err := machine.RemoveTransition("missing", "next"); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+	if err := machine.RemoveTransition("a", "missing"); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+
+	// Test that the removed transition cannot be done anymore, while the
+	// others still work.
+	if err := machine.RemoveTransition("a", "next"); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if _, err := machine.Do("next"); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+	if state, err := machine.Do("skip"); err != nil || state != "c" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "c")
+	}
+}
@@ -0,0 +1,153 @@
+package fine
+
+import "fmt"
+
+// Rename renames a state of the FSM, rewriting every static target leading to
+// it, in any state and in the global transitions, along with everything that
+// was registered for it, such as its embedded machine, its result, the events
+// it defers, and its entries in the journal of Undo. If the state is the current or the initial one, they are
+// renamed too, without any transition, and so without notifying the
+// subscribers.
+//
+// Static targets are the ones of string, Dispatch, History, DeepHistory,
+// Reenter and Transition actions, possibly wrapped in Internal or Timeout.
+// The targets returned by function actions cannot be rewritten, so they must
+// be updated by hand.
+//
+// A non-nil error is returned, and nothing is renamed, if the old state does
+// not exist, or if the new one already exists.
+func (m *FSM) Rename(old, new string) error {
+	var err error
+	var running bool
+	m.writeStatesLocked(func(states stateTable) {
+		switch {
+		case states[old] == nil:
+			err = fmt.Errorf("the state %q does not exist", old)
+			return
+		case states[new] != nil:
+			err = fmt.Errorf("a state with name %q already exists", new)
+			return
+		}
+
+		// Move the state, and rewrite the targets everywhere.
+		states[new] = states[old]
+		delete(states, old)
+		for name, s := range states {
+			if transitions, ok := renameTargets(s.transitions, old, new); ok {
+				states[name] = compileState(name, transitions)
+			}
+		}
+		if global := m.global.Load(); global != nil {
+			if transitions, ok := renameTargets(global.transitions, old, new); ok {
+				m.global.Store(compileState(globalName, transitions))
+			}
+		}
+		if order := m.order.Load(); order != nil {
+			renamed := append([]string(nil), *order...)
+			for i, name := range renamed {
+				if name == old {
+					renamed[i] = new
+				}
+			}
+			m.order.Store(&renamed)
+		}
+
+		// Move everything registered for the state.
+		if m.current == old {
+			m.current = new
+			running = m.embedded[old] != nil && m.embedded[old].stop != nil
+		}
+		if m.initial == old {
+			m.initial = new
+		}
+		if e, ok := m.embedded[old]; ok {
+			m.embedded[new] = e
+			delete(m.embedded, old)
+		}
+		if c, ok := m.enterCallbacks[old]; ok {
+			m.enterCallbacks[new] = c
+			delete(m.enterCallbacks, old)
+		}
+		if fn, ok := m.results[old]; ok {
+			m.results[new] = fn
+			delete(m.results, old)
+		}
+		if f, ok := m.forbidden[old]; ok {
+			m.forbidden[new] = f
+			delete(m.forbidden, old)
+		}
+		if d, ok := m.deferrals[old]; ok {
+			m.deferrals[new] = d
+			delete(m.deferrals, old)
+		}
+		for i, name := range m.journal {
+			if name == old {
+				m.journal[i] = new
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Surface the state changes of a running embedded machine with the new
+	// name, resuming it as it is.
+	if running {
+		m.stopEmbedded(new)
+		m.startEmbedded(new, historyDeep)
+	}
+
+	return nil
+}
+
+// renameTargets returns a copy of the given transitions where every static
+// target equal to old is replaced with new, and whether anything changed.
+func renameTargets(transitions Transitions, old, new string) (Transitions, bool) {
+	var renamed Transitions
+	for event, value := range transitions {
+		if v, ok := renameTarget(value, old, new); ok {
+			if renamed == nil {
+				renamed = make(Transitions, len(transitions))
+				for k, v := range transitions {
+					renamed[k] = v
+				}
+			}
+			renamed[event] = v
+		}
+	}
+	return renamed, renamed != nil
+}
+
+// renameTarget returns the given action value with its static targets equal to
+// old replaced with new, and whether anything changed.
+func renameTarget(value interface{}, old, new string) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		return new, v == old
+	case History:
+		return History(new), string(v) == old
+	case DeepHistory:
+		return DeepHistory(new), string(v) == old
+	case Reenter:
+		return Reenter(new), string(v) == old
+	case Transition:
+		return Transition{Target: new, Action: v.Action}, v.Target == old
+	case Dispatch:
+		changed := false
+		renamed := make(Dispatch, len(v))
+		for key, target := range v {
+			if target == old {
+				target, changed = new, true
+			}
+			renamed[key] = target
+		}
+		return renamed, changed
+	case Internal:
+		action, ok := renameTarget(v.Action, old, new)
+		return Internal{Action: action}, ok
+	case Timeout:
+		action, ok := renameTarget(v.Action, old, new)
+		return Timeout{After: v.After, Action: action}, ok
+	}
+	return value, false
+}
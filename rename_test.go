@@ -0,0 +1,65 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestRename(t *testing.T) {
+	machine := fine.MachineOrdered("idle", []string{"idle", "running", "stopped"}, fine.States{
+		"idle": {
+			"start":  "running",
+			"signal": fine.Dispatch{"go": "running", "halt": "stopped"},
+			"resume": fine.Internal{Action: fine.History("running")},
+		},
+		"running": {"stop": "stopped"},
+		"stopped": {},
+	})
+	machine.AddGlobal("reset", "idle")
+
+	// Test that missing and existing states are reported.
+	if err := machine.Rename("missing", "other"); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+	if err := machine.Rename("idle", "running"); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+
+	// Test that the current and initial state are renamed, keeping the
+	// order of the states.
+	if err := machine.Rename("idle", "ready"); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if state := machine.State(); state != "ready" {
+		t.Fatalf("wrong state: got %q, want %q", state, "ready")
+	}
+	states := machine.States()
+	if len(states) != 3 || states[0] != "ready" || states[1] != "running" {
+		t.Fatalf("wrong states: got %v", states)
+	}
+
+	// Test that the static targets are rewritten everywhere.
+	machine.Rename("running", "busy")
+	for _, tc := range []struct {
+		action string
+		args   []interface{}
+		want   string
+	}{
+		{"start", nil, "busy"},
+		{"reset", nil, "ready"},
+		{"signal", []interface{}{"go"}, "busy"},
+		{"reset", nil, "ready"},
+		{"resume", nil, "busy"},
+	} {
+		if state, err := machine.Do(tc.action, tc.args...); err != nil || state != tc.want {
+			t.Fatalf("wrong state: got %q (%v), want %q", state, err, tc.want)
+		}
+	}
+
+	// Test that a full reset leads to the renamed initial state.
+	machine.Reset(true)
+	if state := machine.State(); state != "ready" {
+		t.Fatalf("wrong state: got %q, want %q", state, "ready")
+	}
+}
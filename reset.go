@@ -0,0 +1,43 @@
+package fine
+
+// Reset moves the FSM back to its initial state, keeping its states, options,
+// subscribers and hooks, so that it can be reused without rebuilding it. The
+// deferred events are discarded, and, if the FSM completed, the channel
+// returned by Done is replaced with a new one, for the next completion.
+//
+// With lifecycle set, the move is a full transition, whose event is "@reset":
+// the @exit lifecycle action of the current state runs, any embedded machine
+// stops, the subscribers are notified, and the @enter lifecycle action of the
+// initial state runs, even if it is the current state already. Otherwise,
+// the state changes silently, without executing anything.
+func (m *FSM) Reset(lifecycle bool) {
+	held := m.tmu.lock()
+	defer m.tmu.unlock(held)
+
+	m.mu.Lock()
+	current, initial := m.current, m.initial
+	m.dropDeferred()
+	if m.finished {
+		m.finished = false
+		m.done = make(chan interface{}, 1)
+	}
+	metadata := Metadata{From: current, To: initial, Event: "@reset"}
+	m.mu.Unlock()
+
+	if !lifecycle {
+		err := m.writeAhead(metadata)
+		m.mu.Lock()
+		m.commit(metadata)
+		m.mu.Unlock()
+		if err == nil {
+			err = m.writeDone(metadata)
+		}
+		m.reportWAL(err)
+		m.checkInvariants(metadata)
+		return
+	}
+
+	m.reportWAL(m.writeAhead(metadata))
+	m.transition(metadata, held)
+	m.reportWAL(m.writeDone(metadata))
+}
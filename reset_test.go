@@ -0,0 +1,58 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestReset(t *testing.T) {
+	var events []string
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"@enter": func(md fine.Metadata) { events = append(events, "@enter a "+md.Event) },
+			"next":   "b",
+		},
+		"b": {
+			fine.Final: true,
+			"@exit":    func(md fine.Metadata) { events = append(events, "@exit b "+md.Event) },
+		},
+	})
+	machine.Subscribe(func(state string) {
+		events = append(events, "notify "+state)
+	})
+
+	// Test that a silent reset executes nothing.
+	machine.Do("next")
+	<-machine.Done()
+	events = nil
+	machine.Reset(false)
+	if state := machine.State(); state != "a" {
+		t.Fatalf("wrong state: got %q, want %q", state, "a")
+	}
+	if len(events) != 0 {
+		t.Fatalf("no events expected, got: %v", events)
+	}
+
+	// Test that the FSM can complete again after a reset.
+	machine.Do("next")
+	if _, ok := <-machine.Done(); !ok {
+		t.Fatal("a new result was expected")
+	}
+
+	// Test that a full reset executes the lifecycle actions.
+	events = nil
+	machine.Reset(true)
+	want := []string{"@exit b @reset", "notify a", "@enter a @reset"}
+	if len(events) != len(want) {
+		t.Fatalf("wrong events: got %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("wrong events: got %v, want %v", events, want)
+		}
+	}
+	if state := machine.State(); state != "a" {
+		t.Fatalf("wrong state: got %q, want %q", state, "a")
+	}
+}
@@ -0,0 +1,65 @@
+package fine
+
+// SetResult makes the given state a final state of the FSM, carrying a result:
+// when the FSM enters it, after its @enter lifecycle action, fn is called and
+// the value it returns is delivered on the channel returned by Done.
+//
+// An FSM can have multiple final states, but only the first one that is
+// entered delivers its result. Passing a nil fn makes the state non-final
+// again.
+func (m *FSM) SetResult(state string, fn func() interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if fn == nil {
+		delete(m.results, state)
+		return
+	}
+	if m.results == nil {
+		m.results = make(map[string]func() interface{})
+	}
+	m.results[state] = fn
+}
+
+// Done returns a channel on which the result of the FSM is delivered as soon
+// as a final state is entered, after which the channel is closed. This makes
+// it possible to use the FSM like a future: drive it, and then wait for its
+// outcome with <-m.Done(). The result is nil for the final states marked with
+// Final, unless they also have a result. See SetResult.
+func (m *FSM) Done() <-chan interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.done
+}
+
+// finish completes the FSM if the destination of the given transition is a
+// final state: it calls the hooks registered with OnCompletion, and then
+// delivers the result of the FSM, unless a result was delivered before.
+func (m *FSM) finish(metadata Metadata) {
+	m.mu.Lock()
+	fn := m.results[metadata.To]
+	s := m.table()[metadata.To]
+	if fn == nil && (s == nil || !s.final) {
+		m.mu.Unlock()
+		return
+	}
+	hooks := m.completionHooks
+	deliver := !m.finished
+	done := m.done
+	m.finished = true
+	m.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(metadata)
+	}
+	if !deliver {
+		return
+	}
+	var result interface{}
+	if fn != nil {
+		result = fn()
+	}
+	done <- result
+	close(done)
+}
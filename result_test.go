@@ -0,0 +1,81 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func newRequest() *fine.FSM {
+	return fine.Machine("pending", fine.States{
+		"pending": {
+			"ok":   "succeeded",
+			"fail": "failed",
+		},
+		"succeeded": {"retry": "pending"},
+		"failed":    {"retry": "pending"},
+	})
+}
+
+func TestSetResult(t *testing.T) {
+	for _, tc := range []struct {
+		action string
+		want   string
+	}{
+		{"ok", "success"},
+		{"fail", "failure"},
+	} {
+		machine := newRequest()
+		machine.SetResult("succeeded", func() interface{} { return "success" })
+		machine.SetResult("failed", func() interface{} { return "failure" })
+
+		// Test that nothing is delivered before reaching a final state.
+		select {
+		case result := <-machine.Done():
+			t.Fatalf("no result expected, got: %v", result)
+		default:
+		}
+
+		// Test that the result of the final state reached is delivered.
+		go machine.Do(tc.action)
+		if result := <-machine.Done(); result != tc.want {
+			t.Fatalf("wrong result: got %v, want %v", result, tc.want)
+		}
+
+		// Test that the channel is closed after the result.
+		if _, ok := <-machine.Done(); ok {
+			t.Fatal("closed channel expected")
+		}
+	}
+}
+
+func TestSetResultOnce(t *testing.T) {
+	machine := newRequest()
+	calls := 0
+	machine.SetResult("succeeded", func() interface{} {
+		calls++
+		return calls
+	})
+
+	// Test that the result is delivered only the first time.
+	machine.Do("ok")
+	machine.Do("retry")
+	machine.Do("ok")
+	if result := <-machine.Done(); result != 1 {
+		t.Fatalf("wrong result: got %v, want %v", result, 1)
+	}
+	if calls != 1 {
+		t.Fatalf("wrong number of calls: got %d, want %d", calls, 1)
+	}
+
+	// Test that a nil function makes the state non-final again.
+	machine = newRequest()
+	machine.SetResult("succeeded", func() interface{} { return nil })
+	machine.SetResult("succeeded", nil)
+	machine.Do("ok")
+	select {
+	case result := <-machine.Done():
+		t.Fatalf("no result expected, got: %v", result)
+	default:
+	}
+}
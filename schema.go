@@ -0,0 +1,66 @@
+package fine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrArgMismatch is returned by Do when the arguments do not match the schema
+// set for the event with SetArgSchema.
+var ErrArgMismatch = errors.New("arguments do not match the schema")
+
+// SetArgSchema sets the schema for the arguments of the given event, replacing
+// any previous one. From now on, Do rejects the event, without executing any
+// action, unless it receives exactly one argument for each of the given types,
+// and each argument is assignable to its type. A nil argument is accepted for
+// types that can be nil, such as pointers and interfaces.
+//
+// The schema applies to the event in every state. Events without a schema
+// accept any argument.
+func (m *FSM) SetArgSchema(event string, types ...reflect.Type) {
+	m.mu.Lock()
+	if m.schemas == nil {
+		m.schemas = make(map[string][]reflect.Type)
+	}
+	m.schemas[event] = types
+	m.mu.Unlock()
+}
+
+// checkArgs validates the given arguments against the schema of the event, if
+// any. The caller must hold m.mu.
+func (m *FSM) checkArgs(event string, args []interface{}) error {
+	types, ok := m.schemas[event]
+	if !ok {
+		return nil
+	}
+	if len(args) != len(types) {
+		return fmt.Errorf(
+			"%w: event %q wants %d arguments, got %d",
+			ErrArgMismatch, event, len(types), len(args),
+		)
+	}
+	for i, arg := range args {
+		if !assignable(arg, types[i]) {
+			return fmt.Errorf(
+				"%w: event %q wants argument %d of type %v, got %T",
+				ErrArgMismatch, event, i, types[i], arg,
+			)
+		}
+	}
+	return nil
+}
+
+// assignable reports whether the given value can be assigned to a variable of
+// the given type.
+func assignable(value interface{}, t reflect.Type) bool {
+	if value == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice,
+			reflect.Func, reflect.Chan:
+			return true
+		}
+		return false
+	}
+	return reflect.TypeOf(value).AssignableTo(t)
+}
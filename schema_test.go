@@ -0,0 +1,57 @@
+package fine_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestSetArgSchema(t *testing.T) {
+	var messages []string
+	machine := fine.Machine("off", fine.States{
+		"off": {
+			"toggle": func(args ...interface{}) string {
+				messages = append(messages, args[0].(string))
+				return "on"
+			},
+		},
+		"on": {
+			"toggle": "off",
+		},
+	})
+	machine.SetArgSchema("toggle", reflect.TypeOf(""))
+
+	// Test that arguments not matching the schema are rejected before
+	// executing the action.
+	for _, args := range [][]interface{}{
+		nil,
+		{42},
+		{nil},
+		{"hello", "world"},
+	} {
+		_, err := machine.Do("toggle", args...)
+		if !errors.Is(err, fine.ErrArgMismatch) {
+			t.Fatalf("wrong error for %v: got %v, want %v", args, err, fine.ErrArgMismatch)
+		}
+	}
+	if len(messages) != 0 {
+		t.Fatalf("no action execution expected, got: %v", messages)
+	}
+
+	// Test that matching arguments are accepted.
+	state, err := machine.Do("toggle", "hello")
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if state != "on" {
+		t.Fatalf("wrong state: got %q, want %q", state, "on")
+	}
+
+	// Test that nil is accepted for types that can be nil.
+	machine.SetArgSchema("toggle", reflect.TypeOf((*error)(nil)).Elem())
+	if _, err := machine.Do("toggle", nil); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+}
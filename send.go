@@ -0,0 +1,108 @@
+package fine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// NamedEvent is an event object that chooses its own event name, instead of
+// being named after its type. See EventName.
+type NamedEvent interface {
+	EventName() string
+}
+
+// EventName returns the name of the given event object, as used by Send: the
+// result of its EventName method, if it is a NamedEvent, or otherwise the name
+// of its type, without the package, dereferencing pointers. For example, the
+// name of both MyEvent{} and &MyEvent{} is "MyEvent". The name is empty for
+// nil and for values of unnamed types.
+func EventName(event interface{}) string {
+	if named, ok := event.(NamedEvent); ok {
+		return named.EventName()
+	}
+	t := reflect.TypeOf(event)
+	if t == nil {
+		return ""
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// Send does the event named after the given event object, as with Do, passing
+// the object itself as the only argument. Using a type for every event, with
+// its own fields as payload, keeps the events type-safe: the actions can
+// receive the payload as a typed value with Handle and HandleFunc.
+//
+// For example, the following transitions handle the events sent with
+// Send(Deposit{Amount: 10}).
+//
+//	fine.Transitions{
+//		fine.EventName(Deposit{}): fine.HandleFunc(func(e Deposit) {
+//			balance += e.Amount
+//		}),
+//	}
+//
+// A non-nil error is returned, and nothing is done, if the event has an empty
+// name. See EventName.
+func (m *FSM) Send(event interface{}) (string, error) {
+	name := EventName(event)
+	if name == "" {
+		return "", errors.New("the event has no name")
+	}
+	state, _, err := m.do(nil, name, []interface{}{event})
+	return state, err
+}
+
+// Handler is an action receiving the payload of the events sent with Send as a
+// value of type E. See Handle and HandleFunc.
+type Handler[E interface{}] struct {
+	target func(E) string
+	fn     func(E)
+}
+
+// Handle returns an action receiving the payload of the event as a value of
+// type E, and returning the next state, like a func() string action.
+func Handle[E interface{}](fn func(event E) string) Handler[E] {
+	return Handler[E]{target: fn}
+}
+
+// HandleFunc returns an action receiving the payload of the event as a value
+// of type E, without changing the state, like a func() action.
+func HandleFunc[E interface{}](fn func(event E)) Handler[E] {
+	return Handler[E]{fn: fn}
+}
+
+// handle executes the handler with the payload in the given arguments of the
+// named event. It fails, wrapping ErrArgMismatch, if the payload does not have
+// type E.
+func (h Handler[E]) handle(event string, args []interface{}) (string, bool, error) {
+	var payload E
+	if len(args) != 1 {
+		return "", false, fmt.Errorf(
+			"%w: event %q wants a payload of type %T, got %d arguments",
+			ErrArgMismatch, event, payload, len(args),
+		)
+	}
+	payload, ok := args[0].(E)
+	if !ok {
+		return "", false, fmt.Errorf(
+			"%w: event %q wants a payload of type %T, got %T",
+			ErrArgMismatch, event, payload, args[0],
+		)
+	}
+	if h.target != nil {
+		return h.target(payload), true, nil
+	}
+	if h.fn != nil {
+		h.fn(payload)
+	}
+	return "", false, nil
+}
+
+// payloadHandler is implemented by every Handler, whatever its type parameter.
+type payloadHandler interface {
+	handle(event string, args []interface{}) (string, bool, error)
+}
@@ -0,0 +1,84 @@
+package fine_test
+
+import (
+	"errors"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+type deposit struct {
+	amount int
+}
+
+type withdrawal struct {
+	amount int
+}
+
+func (withdrawal) EventName() string {
+	return "withdraw"
+}
+
+func TestEventName(t *testing.T) {
+	for _, tc := range []struct {
+		event interface{}
+		want  string
+	}{
+		{deposit{}, "deposit"},
+		{&deposit{}, "deposit"},
+		{withdrawal{}, "withdraw"},
+		{struct{}{}, ""},
+		{nil, ""},
+	} {
+		if got := fine.EventName(tc.event); got != tc.want {
+			t.Fatalf("wrong name for %#v: got %q, want %q", tc.event, got, tc.want)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	balance := 0
+	machine := fine.Machine("open", fine.States{
+		"open": {
+			fine.EventName(deposit{}): fine.HandleFunc(func(e deposit) {
+				balance += e.amount
+			}),
+			"withdraw": fine.Handle(func(e withdrawal) string {
+				balance -= e.amount
+				if balance < 0 {
+					return "overdrawn"
+				}
+				return "open"
+			}),
+		},
+		"overdrawn": {},
+	})
+
+	// Test that the actions receive the typed payloads.
+	for _, tc := range []struct {
+		event interface{}
+		want  string
+	}{
+		{deposit{10}, "open"},
+		{withdrawal{3}, "open"},
+		{withdrawal{10}, "overdrawn"},
+	} {
+		if state, err := machine.Send(tc.event); err != nil || state != tc.want {
+			t.Fatalf("wrong state: got %q (%v), want %q", state, err, tc.want)
+		}
+	}
+	if balance != -3 {
+		t.Fatalf("wrong balance: got %d, want -3", balance)
+	}
+
+	// Test that unnamed events and wrong payloads are rejected.
+	if _, err := machine.Send(struct{}{}); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+	machine = fine.Machine("open", fine.States{
+		"open": {"deposit": fine.HandleFunc(func(deposit) {})},
+	})
+	if _, err := machine.Do("deposit", 10); !errors.Is(err, fine.ErrArgMismatch) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrArgMismatch)
+	}
+}
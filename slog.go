@@ -0,0 +1,76 @@
+//go:build go1.21
+
+package fine
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// WithLogger makes the FSM emit structured log records to the given logger:
+//
+//   - every state change, at the Info level, with the from, to, event and
+//     duration attributes, where the duration is the one of the whole
+//     transition;
+//   - every event that does not change the state, such as the ones of nil
+//     actions, or the deferred ones, at the Debug level, with the same
+//     attributes;
+//   - every rejected or failed event, at the Warn level, with the from, event,
+//     duration and error attributes;
+//   - every lifecycle action executed, at the Debug level, with the kind,
+//     state, from, to, event and duration attributes.
+//
+// The records of the events carry the context given to DoContext, if any.
+//
+// Note: this option requires Go 1.21 or later.
+func WithLogger(l *slog.Logger) Option {
+	return func(m *FSM) {
+		m.logger = slogLogger{l}
+	}
+}
+
+// slogLogger is a logger emitting the records to a slog.Logger.
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) logStep(ctx context.Context, from, to, event string, duration time.Duration, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	switch {
+	case err != nil:
+		s.l.LogAttrs(ctx, slog.LevelWarn, "rejected event",
+			slog.String("from", from),
+			slog.String("event", event),
+			slog.Duration("duration", duration),
+			slog.Any("error", err),
+		)
+	case from != to:
+		s.l.LogAttrs(ctx, slog.LevelInfo, "transition",
+			slog.String("from", from),
+			slog.String("to", to),
+			slog.String("event", event),
+			slog.Duration("duration", duration),
+		)
+	default:
+		s.l.LogAttrs(ctx, slog.LevelDebug, "event",
+			slog.String("from", from),
+			slog.String("to", to),
+			slog.String("event", event),
+			slog.Duration("duration", duration),
+		)
+	}
+}
+
+func (s slogLogger) logLifecycle(kind, state string, metadata Metadata, duration time.Duration) {
+	s.l.LogAttrs(metadata.context(), slog.LevelDebug, "lifecycle",
+		slog.String("kind", kind),
+		slog.String("state", state),
+		slog.String("from", metadata.From),
+		slog.String("to", metadata.To),
+		slog.String("event", metadata.Event),
+		slog.Duration("duration", duration),
+	)
+}
@@ -0,0 +1,49 @@
+//go:build go1.21
+
+package fine_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"interrato.dev/fine"
+	"interrato.dev/fine/finetest"
+)
+
+func TestLogger(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	clock := finetest.NewClock(time.Unix(0, 0))
+	machine := fine.Machine("off", fine.States{
+		"off": {"toggle": "on"},
+		"on": {"toggle": "off", "check": nil, "@enter": func() {
+			clock.Advance(time.Second)
+		}},
+	}, fine.WithLogger(logger), fine.WithClock(clock))
+
+	// Test that the transitions, the other events, the rejected ones and
+	// the lifecycle actions are all logged.
+	machine.Do("toggle")
+	machine.Do("check")
+	machine.Do("missing")
+	want := []string{
+		`level=DEBUG msg=lifecycle kind=@enter state=on from=off to=on event=toggle duration=1s`,
+		`level=INFO msg=transition from=off to=on event=toggle duration=1s`,
+		`level=DEBUG msg=event from=on to=on event=check duration=0s`,
+		`level=WARN msg="rejected event" from=on event=missing duration=0s error="\"missing\" is not a valid action for the current state \"on\""`,
+	}
+	if got := strings.Split(strings.TrimSpace(out.String()), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("wrong records:\ngot  %q\nwant %q", got, want)
+	}
+}
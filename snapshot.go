@@ -0,0 +1,141 @@
+package fine
+
+import (
+	"fmt"
+	"time"
+)
+
+// Snapshot is the runtime state of an FSM, as returned by its Snapshot method,
+// from which Restore can resume it, for example after a process restart. It
+// is meant to be serialized, for example with the encoding/json package, so
+// the arguments of the events must be serializable too.
+type Snapshot struct {
+	// Version is the version of the definition of the FSM. See WithVersion.
+	Version int `json:"version,omitempty"`
+
+	// Initial is the initial state, which Restore uses, or State if empty.
+	Initial string `json:"initial,omitempty"`
+
+	// State is the current state.
+	State string `json:"state"`
+
+	// Deferred are the deferred events, in the order they will be replayed.
+	// See Defer.
+	Deferred []SnapshotEvent `json:"deferred,omitempty"`
+
+	// History are the recorded transitions, from the oldest to the newest.
+	// See WithHistory.
+	History []SnapshotRecord `json:"history,omitempty"`
+
+	// Journal are the previous states that Undo can return to, from the
+	// oldest to the newest. See WithUndo.
+	Journal []string `json:"journal,omitempty"`
+}
+
+// SnapshotEvent is an event waiting to be done, in a Snapshot.
+type SnapshotEvent struct {
+	Event string        `json:"event"`
+	Args  []interface{} `json:"args,omitempty"`
+}
+
+// SnapshotRecord is a recorded transition, in a Snapshot. Unlike a Record, it
+// has no context.
+type SnapshotRecord struct {
+	From  string        `json:"from"`
+	To    string        `json:"to"`
+	Event string        `json:"event"`
+	Args  []interface{} `json:"args,omitempty"`
+	Time  time.Time     `json:"time"`
+}
+
+// Snapshot returns the runtime state of the FSM, which Restore can resume. The
+// contexts of the deferred events and of the recorded transitions are not
+// part of it.
+func (m *FSM) Snapshot() Snapshot {
+	m.mu.RLock()
+	snapshot := Snapshot{
+		Version: m.version,
+		Initial: m.initial,
+		State:   m.current,
+		Journal: append([]string(nil), m.journal...),
+	}
+	for _, e := range m.deferred {
+		snapshot.Deferred = append(snapshot.Deferred, SnapshotEvent{
+			Event: e.action,
+			Args:  e.args,
+		})
+	}
+	m.mu.RUnlock()
+
+	for _, r := range m.History() {
+		snapshot.History = append(snapshot.History, SnapshotRecord{
+			From:  r.From,
+			To:    r.To,
+			Event: r.Event,
+			Args:  r.Args,
+			Time:  r.Time,
+		})
+	}
+	return snapshot
+}
+
+// Restore instantiates a new FSM from the given Definition, resuming it from
+// the given snapshot: the FSM is in the state of the snapshot, with its
+// deferred events, its history and its journal, as far as the options of the
+// Definition enable them. Since the state was entered already, its @enter
+// lifecycle action is not executed again, while its timeouts are started
+// anew. The states deferring the events must be declared again with Defer.
+//
+// Snapshots taken with an older version of the Definition are migrated first,
+// as set by WithMigration.
+//
+// The initial state of the FSM is the one of the snapshot, or its current
+// state if the snapshot has none, since the Definition does not know it.
+//
+// A non-nil error is returned if the snapshot is newer than the Definition, or
+// if its states, or any state of its journal, are not within the states of the
+// Definition, after the migration.
+func Restore(d *Definition, snapshot Snapshot) (*FSM, error) {
+	m := d.instance(snapshot.State)
+	snapshot, err := m.migrate(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.Initial == "" {
+		snapshot.Initial = snapshot.State
+	}
+	for _, state := range []string{snapshot.Initial, snapshot.State} {
+		if _, ok := d.states[state]; !ok {
+			return nil, fmt.Errorf("the state %q is not in the definition", state)
+		}
+	}
+	for _, state := range snapshot.Journal {
+		if _, ok := d.states[state]; !ok {
+			return nil, fmt.Errorf("the journaled state %q is not in the definition", state)
+		}
+	}
+
+	m.initial, m.current = snapshot.Initial, snapshot.State
+	for _, e := range snapshot.Deferred {
+		m.deferred = append(m.deferred, pendingEvent{action: e.Event, args: e.Args})
+	}
+	m.queued.Store(int32(len(m.deferred)))
+	for _, r := range snapshot.History {
+		m.appendRecord(Record{
+			Metadata: Metadata{From: r.From, To: r.To, Event: r.Event, Args: r.Args},
+			Time:     r.Time,
+		})
+	}
+	if m.undoDepth > 0 {
+		journal := snapshot.Journal
+		if len(journal) > m.undoDepth {
+			journal = journal[len(journal)-m.undoDepth:]
+		}
+		m.journal = append([]string(nil), journal...)
+	}
+
+	m.mu.Lock()
+	m.scheduleTimeouts()
+	m.mu.Unlock()
+	return m, nil
+}
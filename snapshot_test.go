@@ -0,0 +1,101 @@
+package fine_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"interrato.dev/fine"
+	"interrato.dev/fine/finetest"
+)
+
+func TestSnapshot(t *testing.T) {
+	clock := finetest.NewClock(time.Unix(0, 0))
+	entered := 0
+	d, err := fine.Define(fine.States{
+		"draft":     {"submit": "review", "@enter": func() { entered++ }},
+		"review":    {"approve": "published", "reject": "draft"},
+		"published": {"archive": "archived"},
+		"archived":  {},
+	}, fine.WithHistory(10), fine.WithUndo(10), fine.WithClock(clock))
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	m := d.NewInstance("draft")
+	m.Defer("review", "archive")
+	m.Do("submit")
+	m.Do("archive", "reason")
+
+	// Test that the snapshot survives serialization.
+	data, err := json.Marshal(m.Snapshot())
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	var snapshot fine.Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if snapshot.State != "review" || len(snapshot.Deferred) != 1 || len(snapshot.History) != 1 {
+		t.Fatalf("wrong snapshot: got %+v", snapshot)
+	}
+
+	// Test that the restored FSM resumes where the snapshot was taken,
+	// without entering the state again.
+	entered = 0
+	restored, err := fine.Restore(d, snapshot)
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if state := restored.State(); state != "review" {
+		t.Fatalf("wrong state: got %q, want %q", state, "review")
+	}
+	if entered != 0 {
+		t.Fatalf("wrong @enter calls: got %d, want 0", entered)
+	}
+	if deferred := restored.Deferred(); len(deferred) != 1 || deferred[0] != "archive" {
+		t.Fatalf("wrong deferred events: got %v, want [archive]", deferred)
+	}
+	if h := restored.History(); len(h) != 1 || h[0].Event != "submit" || !h[0].Time.Equal(time.Unix(0, 0)) {
+		t.Fatalf("wrong history: got %+v", h)
+	}
+
+	// Test that the deferred events are replayed, and the journal is kept.
+	restored.Do("approve")
+	if state := restored.State(); state != "archived" {
+		t.Fatalf("wrong state: got %q, want %q", state, "archived")
+	}
+	var undone []string
+	for {
+		state, err := restored.Undo()
+		if err != nil {
+			break
+		}
+		undone = append(undone, state)
+	}
+	if want := []string{"published", "review", "draft"}; fmt.Sprint(undone) != fmt.Sprint(want) {
+		t.Fatalf("wrong undone states: got %v, want %v", undone, want)
+	}
+
+	// Test that the restored FSM keeps the initial state, falling back to
+	// the current one for the snapshots without it.
+	restored, _ = fine.Restore(d, snapshot)
+	restored.Reset(false)
+	if state := restored.State(); state != "draft" {
+		t.Fatalf("wrong state: got %q, want %q", state, "draft")
+	}
+	snapshot.Initial = ""
+	restored, _ = fine.Restore(d, snapshot)
+	restored.Reset(false)
+	if state := restored.State(); state != "review" {
+		t.Fatalf("wrong state: got %q, want %q", state, "review")
+	}
+
+	// Test that snapshots of other definitions are rejected.
+	if _, err := fine.Restore(d, fine.Snapshot{State: "missing"}); err == nil {
+		t.Fatal("error expected")
+	}
+	if _, err := fine.Restore(d, fine.Snapshot{State: "draft", Journal: []string{"missing"}}); err == nil {
+		t.Fatal("error expected")
+	}
+}
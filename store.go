@@ -0,0 +1,84 @@
+package fine
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNotFound is returned by a Store when it has no snapshot with the given
+// identifier.
+var ErrNotFound = errors.New("snapshot not found")
+
+// ErrConflict is returned by a Store when a snapshot is saved over a version
+// other than the stored one, because another process saved it meanwhile.
+var ErrConflict = errors.New("snapshot version conflict")
+
+// Store persists the snapshots of machines, keyed by an identifier, with a
+// version for optimistic locking. See Persist and Resume, and the finesql and
+// fineredis packages for implementations.
+type Store interface {
+	// Load returns the snapshot saved with the given identifier, and its
+	// version, or an error wrapping ErrNotFound if there is none.
+	Load(ctx context.Context, id string) (snapshot Snapshot, version int64, err error)
+
+	// Save saves the snapshot with the given identifier, replacing the one
+	// with the given version, which is zero for a new identifier, so that
+	// the saved snapshot has the next version. An error wrapping ErrConflict
+	// is returned, and nothing is saved, if the stored version differs.
+	Save(ctx context.Context, id string, snapshot Snapshot, version int64) error
+}
+
+// Persist saves a snapshot of the FSM to the given store, with the given
+// identifier, after every transition, as seen by OnTransition, starting from
+// the given version, which is zero for a new identifier. The saves are
+// serialized, and the errors they return are reported to the hooks registered
+// with OnError. Internal transitions are saved along with the next transition.
+//
+// A conflict means that another process saved the snapshot meanwhile, so
+// persisting stops after reporting it: the FSM should be resumed again from the
+// store, rather than overwrite what the other process saved.
+//
+// The save runs synchronously, as an OnTransition callback: once the state
+// changed and the subscribers were notified, but before the @enter lifecycle
+// action of the new state, on the goroutine doing the transition, so that Do
+// does not return, and the transitions of other goroutines wait, until it
+// completes. A failed save does not undo the transition, and a crash before it
+// completes loses it.
+//
+// A function to stop persisting the FSM is returned.
+func Persist(m *FSM, store Store, id string, version int64) func() {
+	var (
+		mu         sync.Mutex
+		conflicted bool
+	)
+	return m.OnTransition(func(metadata Metadata) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if conflicted {
+			return
+		}
+		if err := store.Save(metadata.context(), id, m.Snapshot(), version); err != nil {
+			conflicted = errors.Is(err, ErrConflict)
+			m.report(err)
+			return
+		}
+		version++
+	})
+}
+
+// Resume loads the snapshot with the given identifier from the given store,
+// and restores it with Restore, returning the restored FSM and the version of
+// its snapshot, to be passed to Persist.
+func Resume(ctx context.Context, store Store, d *Definition, id string) (*FSM, int64, error) {
+	snapshot, version, err := store.Load(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	m, err := Restore(d, snapshot)
+	if err != nil {
+		return nil, 0, err
+	}
+	return m, version, nil
+}
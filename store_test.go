@@ -0,0 +1,110 @@
+package fine_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+// memoryStore is an in-memory fine.Store.
+type memoryStore struct {
+	mu        sync.Mutex
+	snapshots map[string]fine.Snapshot
+	versions  map[string]int64
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		snapshots: make(map[string]fine.Snapshot),
+		versions:  make(map[string]int64),
+	}
+}
+
+func (s *memoryStore) Load(_ context.Context, id string) (fine.Snapshot, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot, ok := s.snapshots[id]
+	if !ok {
+		return fine.Snapshot{}, 0, fine.ErrNotFound
+	}
+	return snapshot, s.versions[id], nil
+}
+
+func (s *memoryStore) Save(_ context.Context, id string, snapshot fine.Snapshot, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.versions[id] != version {
+		return fine.ErrConflict
+	}
+	s.snapshots[id] = snapshot
+	s.versions[id] = version + 1
+	return nil
+}
+
+func TestPersist(t *testing.T) {
+	d, err := fine.Define(fine.States{
+		"created": {"pay": "paid"},
+		"paid":    {"ship": "shipped"},
+		"shipped": {},
+	})
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	store := newMemoryStore()
+
+	// Test that every transition is saved.
+	m := d.NewInstance("created")
+	fine.Persist(m, store, "order-1", 0)
+	m.Do("pay")
+	snapshot, version, err := store.Load(context.Background(), "order-1")
+	if err != nil || snapshot.State != "paid" || version != 1 {
+		t.Fatalf("wrong saved snapshot: got (%q, %d, %v), want (paid, 1, <nil>)", snapshot.State, version, err)
+	}
+
+	// Test that the saved FSM can be resumed, and persisted further.
+	resumed, version, err := fine.Resume(context.Background(), store, d, "order-1")
+	if err != nil || resumed.State() != "paid" {
+		t.Fatalf("wrong resumed FSM: got (%v, %v)", resumed, err)
+	}
+	stop := fine.Persist(resumed, store, "order-1", version)
+	resumed.Do("ship")
+	if snapshot, version, _ := store.Load(context.Background(), "order-1"); snapshot.State != "shipped" || version != 2 {
+		t.Fatalf("wrong saved snapshot: got (%q, %d), want (shipped, 2)", snapshot.State, version)
+	}
+
+	// Test that conflicting saves are reported.
+	var reported []error
+	m.OnError(func(err error) {
+		reported = append(reported, err)
+	})
+	m.Do("ship")
+	if len(reported) != 1 || !errors.Is(reported[0], fine.ErrConflict) {
+		t.Fatalf("wrong errors: got %v, want [%v]", reported, fine.ErrConflict)
+	}
+
+	// Test that persisting stops after a conflict.
+	m.Reset(true)
+	if len(reported) != 1 {
+		t.Fatalf("wrong errors: got %v, want [%v]", reported, fine.ErrConflict)
+	}
+	if snapshot, version, _ := store.Load(context.Background(), "order-1"); snapshot.State != "shipped" || version != 2 {
+		t.Fatalf("wrong saved snapshot: got (%q, %d), want (shipped, 2)", snapshot.State, version)
+	}
+
+	// Test that nothing is saved once stopped.
+	stop()
+	resumed.Reset(true)
+	if snapshot, version, _ := store.Load(context.Background(), "order-1"); snapshot.State != "shipped" || version != 2 {
+		t.Fatalf("wrong saved snapshot: got (%q, %d), want (shipped, 2)", snapshot.State, version)
+	}
+
+	// Test that resuming a missing snapshot fails.
+	if _, _, err := fine.Resume(context.Background(), store, d, "missing"); !errors.Is(err, fine.ErrNotFound) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrNotFound)
+	}
+}
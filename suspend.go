@@ -0,0 +1,35 @@
+package fine
+
+// SuspendNotifications suspends the notifications to the subscribers, while
+// keeping the FSM live: actions can still be done, and transitions still
+// happen. It is useful to go through several intermediate states without
+// flooding the subscribers with them.
+//
+// Only the subscribers are suspended: the lifecycle actions, and the hooks
+// such as the ones registered with OnEnter or OnLifecycle, keep being called
+// at every step.
+func (m *FSM) SuspendNotifications() {
+	m.mu.Lock()
+	m.suspended = true
+	m.mu.Unlock()
+}
+
+// ResumeNotifications resumes the notifications to the subscribers, after
+// SuspendNotifications. If the state changed in the meantime, the subscribers
+// are notified once with the current state, no matter how many transitions
+// happened. It does nothing if the notifications were not suspended.
+func (m *FSM) ResumeNotifications() {
+	m.mu.Lock()
+	if !m.suspended {
+		m.mu.Unlock()
+		return
+	}
+	m.suspended = false
+	missed := m.missed.Swap(false)
+	current := m.current
+	m.mu.Unlock()
+
+	if missed {
+		m.notify(Metadata{To: current})
+	}
+}
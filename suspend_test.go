@@ -0,0 +1,60 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestSuspendNotifications(t *testing.T) {
+	entered := 0
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {
+			"@enter": func() { entered++ },
+			"next":   "c",
+		},
+		"c": {"next": "a"},
+	})
+
+	var notified []string
+	machine.Subscribe(func(state string) {
+		notified = append(notified, state)
+	})
+	notified = nil // Ignore the initial notification.
+
+	// Test that transitions happen, but subscribers are not notified, while
+	// the notifications are suspended.
+	machine.SuspendNotifications()
+	machine.Do("next")
+	machine.Do("next")
+	if state := machine.State(); state != "c" {
+		t.Fatalf("wrong state: got %q, want %q", state, "c")
+	}
+	if entered != 1 {
+		t.Fatalf("wrong number of @enter calls: got %d, want %d", entered, 1)
+	}
+	if len(notified) != 0 {
+		t.Fatalf("no notifications expected, got: %v", notified)
+	}
+
+	// Test that the subscribers are notified once on resume.
+	machine.ResumeNotifications()
+	if len(notified) != 1 || notified[0] != "c" {
+		t.Fatalf("wrong notifications: got %v, want %v", notified, []string{"c"})
+	}
+
+	// Test that nothing is notified on resume if nothing changed.
+	machine.SuspendNotifications()
+	machine.ResumeNotifications()
+	machine.ResumeNotifications()
+	if len(notified) != 1 {
+		t.Fatalf("wrong notifications: got %v, want %v", notified, []string{"c"})
+	}
+
+	// Test that notifications are delivered normally after resuming.
+	machine.Do("next")
+	if len(notified) != 2 || notified[1] != "a" {
+		t.Fatalf("wrong notifications: got %v, want %v", notified, []string{"c", "a"})
+	}
+}
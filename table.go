@@ -0,0 +1,88 @@
+package fine
+
+// WithCopyOnWrite makes the FSM store its states copy-on-write: every change
+// to the states, such as Add or AddOrMerge, clones the whole table, modifies
+// the clone, and atomically swaps it in. In return, methods that only read the
+// states, such as States, Exists, and StatesMissing, never take any lock, and
+// so they never contend with each other nor with the changes.
+//
+// This is convenient for read-mostly FSM, where the states change rarely and
+// are read very often: the cost of a change grows with the number of states.
+func WithCopyOnWrite() Option {
+	return func(m *FSM) {
+		m.cow = true
+	}
+}
+
+// stateTable maps the names of the states to their precompiled form.
+type stateTable map[string]*state
+
+// table returns the current states table, which must never be modified. The
+// caller must hold m.mu, unless the FSM is copy-on-write.
+func (m *FSM) table() stateTable {
+	return *m.states.Load()
+}
+
+// readStates calls f with the current states table, which f must not modify.
+func (m *FSM) readStates(f func(states stateTable)) {
+	if m.cow {
+		f(m.table())
+		return
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	f(m.table())
+}
+
+// writeStates calls f with a states table that f can modify, which then
+// becomes the current one. The function f can add, replace and delete the
+// entries of the table, but it must never modify the existing states.
+func (m *FSM) writeStates(f func(states stateTable)) {
+	if !m.cow {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		// A table shared with other instances is copied on the first change.
+		if m.shared {
+			m.states.Store(copyTable(m.table()))
+			m.shared = false
+		}
+		f(m.table())
+		m.reorder(m.table())
+		return
+	}
+
+	m.smu.Lock()
+	defer m.smu.Unlock()
+
+	states := copyTable(m.table())
+	f(*states)
+	m.reorder(*states)
+	m.states.Store(states)
+}
+
+// copyTable returns a copy of the given states table, which can be modified.
+func copyTable(table stateTable) *stateTable {
+	states := make(stateTable, len(table)+1)
+	for name, s := range table {
+		states[name] = s
+	}
+	return &states
+}
+
+// writeStatesLocked behaves like writeStates, but f is always called while
+// holding m.mu for writing, even if the FSM is copy-on-write, so that f can
+// also access the rest of the FSM consistently with the states.
+func (m *FSM) writeStatesLocked(f func(states stateTable)) {
+	if !m.cow {
+		m.writeStates(f)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.writeStates(f)
+}
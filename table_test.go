@@ -0,0 +1,86 @@
+package fine_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestCopyOnWrite(t *testing.T) {
+	machine := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"next": "a"},
+	}, fine.WithCopyOnWrite())
+
+	// Test that changes are visible to the following reads.
+	if err := machine.Add("c", fine.Transitions{"next": "a"}); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if err := machine.Add("c", fine.Transitions{}); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+	machine.AddOrMerge("b", fine.Transitions{"next": "c"})
+	for _, want := range []string{"b", "c", "a"} {
+		if state, _ := machine.Do("next"); state != want {
+			t.Fatalf("wrong state: got %q, want %q", state, want)
+		}
+	}
+
+	// Concurrency test (run with `-race`).
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			machine.AddOrReplace(strconv.Itoa(i%10), fine.Transitions{})
+		}(i)
+		go func() {
+			defer wg.Done()
+			machine.Exists("a")
+			machine.States()
+			machine.Do("next")
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkReadsUnderWrites(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []fine.Option
+	}{
+		{"default", nil},
+		{"cow", []fine.Option{fine.WithCopyOnWrite()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			states := fine.States{}
+			for i := 0; i < 16; i++ {
+				states[strconv.Itoa(i)] = fine.Transitions{"next": "0"}
+			}
+			machine := fine.Machine("0", states, bc.opts...)
+
+			// Mutate the states in the background for the whole benchmark.
+			done := make(chan struct{})
+			go func() {
+				for i := 0; ; i++ {
+					select {
+					case <-done:
+						return
+					default:
+						machine.AddOrReplace(strconv.Itoa(i%16), fine.Transitions{"next": "0"})
+					}
+				}
+			}()
+			defer close(done)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					machine.Exists("7")
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package fine
+
+import "time"
+
+// Timeout is an action that is done automatically, as with Do, once the FSM
+// has been in the state for the given duration, measured with the Clock of
+// the FSM. The timer starts whenever the state is entered, including as the
+// initial state, and it is cancelled as soon as the state is exited. The
+// event can still be done manually, executing the wrapped action right away.
+// Errors are reported to the hooks registered with OnError.
+//
+// The wrapped action can have any of the types of a regular action, except
+// Timeout itself. The duration must be positive, otherwise the timer is never
+// started. Timers are only started for the Transitions of the states, not for
+// global transitions, and changes to the current state take effect the next
+// time it is entered.
+//
+// For example, the following state of a traffic light moves to "yellow" after
+// five seconds.
+//
+//	"green": {"timeout": fine.After(5*time.Second, "yellow")}
+type Timeout struct {
+	After  time.Duration
+	Action interface{}
+}
+
+// After returns a Timeout doing the given action after the given duration.
+func After(d time.Duration, action interface{}) Timeout {
+	return Timeout{After: d, Action: action}
+}
+
+// scheduleTimeouts starts the timers of the Timeout actions of the current
+// state. The caller must hold m.mu for writing.
+func (m *FSM) scheduleTimeouts() {
+	s := m.table()[m.current]
+	if s == nil {
+		return
+	}
+	for event, d := range s.timeouts {
+		m.schedule("timeout "+event, d, pendingEvent{action: event})
+	}
+}
@@ -0,0 +1,89 @@
+package fine_test
+
+import (
+	"testing"
+	"time"
+
+	"interrato.dev/fine"
+	"interrato.dev/fine/finetest"
+)
+
+func TestTimeout(t *testing.T) {
+	clock := finetest.NewClock(time.Unix(0, 0))
+	machine := fine.Machine("green", fine.States{
+		"green":  {"timeout": fine.After(5*time.Second, "yellow")},
+		"yellow": {"timeout": fine.After(time.Second, "red")},
+		"red": {
+			"timeout": fine.After(5*time.Second, "green"),
+			"touch":   fine.Reenter("red"),
+		},
+	}, fine.WithClock(clock))
+
+	// Test that the timeouts fire after dwelling in the state, starting from
+	// the initial state.
+	for _, tc := range []struct {
+		advance time.Duration
+		want    string
+	}{
+		{4 * time.Second, "green"},
+		{time.Second, "yellow"},
+		{time.Second, "red"},
+	} {
+		clock.Advance(tc.advance)
+		if state := machine.State(); state != tc.want {
+			t.Fatalf("wrong state: got %q, want %q", state, tc.want)
+		}
+	}
+
+	// Test that re-entering the state restarts the timer.
+	clock.Advance(4 * time.Second)
+	machine.Do("touch")
+	clock.Advance(4 * time.Second)
+	if state := machine.State(); state != "red" {
+		t.Fatalf("wrong state: got %q, want %q", state, "red")
+	}
+	clock.Advance(time.Second)
+	if state := machine.State(); state != "green" {
+		t.Fatalf("wrong state: got %q, want %q", state, "green")
+	}
+
+	// Test that the event can be done manually, cancelling the timer.
+	if state, err := machine.Do("timeout"); err != nil || state != "yellow" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "yellow")
+	}
+	clock.Advance(4 * time.Second)
+	if state := machine.State(); state != "red" {
+		t.Fatalf("wrong state: got %q, want %q", state, "red")
+	}
+}
+
+func TestTimeoutRace(t *testing.T) {
+	clock := finetest.NewClock(time.Unix(0, 0))
+	fired := make(chan struct{})
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"change": fine.After(time.Second, "b"),
+			"slow": func() string {
+				// Fire the timeout while the transition is in progress.
+				go func() {
+					defer close(fired)
+					clock.Advance(time.Second)
+				}()
+				time.Sleep(time.Millisecond)
+				return "b"
+			},
+		},
+		"b": {"change": "c"},
+		"c": {},
+	}, fine.WithClock(clock))
+
+	// Test that a timeout firing during a transition leaving its state is
+	// dropped, instead of being done in the new state.
+	if state, err := machine.Do("slow"); err != nil || state != "b" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "b")
+	}
+	<-fired
+	if state := machine.State(); state != "b" {
+		t.Fatalf("wrong state: got %q, want %q", state, "b")
+	}
+}
@@ -0,0 +1,99 @@
+package fine
+
+import "context"
+
+// Tracer starts the spans of a traced FSM. See WithTracer.
+//
+// Its methods mirror the ones of OpenTelemetry, so that a trace.Tracer can be
+// adapted without this package depending on it:
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, name string, attributes ...fine.Attribute) (context.Context, fine.Span) {
+//		ctx, span := t.Tracer.Start(ctx, name)
+//		s := otelSpan{span}
+//		s.SetAttributes(attributes...)
+//		return ctx, s
+//	}
+//
+//	type otelSpan struct{ trace.Span }
+//
+//	func (s otelSpan) SetAttributes(attributes ...fine.Attribute) {
+//		for _, a := range attributes {
+//			switch v := a.Value.(type) {
+//			case string:
+//				s.Span.SetAttributes(attribute.String(a.Key, v))
+//			case int:
+//				s.Span.SetAttributes(attribute.Int(a.Key, v))
+//			}
+//		}
+//	}
+//
+//	func (s otelSpan) End(err error) {
+//		if err != nil {
+//			s.Span.RecordError(err)
+//			s.Span.SetStatus(codes.Error, err.Error())
+//		}
+//		s.Span.End()
+//	}
+type Tracer interface {
+	// Start starts a span with the given name and attributes, as a child of
+	// the span of the given context, if any, and returns a context holding
+	// the new span.
+	Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttributes sets the given attributes on the span.
+	SetAttributes(attributes ...Attribute)
+
+	// End ends the span, which failed with the given error, if not nil.
+	End(err error)
+}
+
+// Attribute is a key-value pair describing a span. The values are strings or
+// ints.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// WithTracer makes the FSM trace its events with the given tracer:
+//
+//   - every event done, such as with Do, gets a "fine.Do" span, with the
+//     "fine.event", "fine.from", "fine.to" and "fine.args" (the number of
+//     arguments) attributes, which is a child of the span of the context of
+//     DoContext, if any;
+//   - every lifecycle action gets a "fine.lifecycle" child span, with the
+//     "fine.action" and "fine.state" attributes;
+//   - every dispatch to the subscribers gets a "fine.notify" child span, with
+//     the "fine.subscribers" attribute.
+//
+// The context of the span of the event is the Context of the metadata passed
+// to the actions, hooks, and subscribers, so that they can start their own
+// child spans. It is never nil, even for the events done with Do.
+func WithTracer(tracer Tracer) Option {
+	return func(m *FSM) {
+		m.tracer = tracer
+	}
+}
+
+// startSpan starts a span with the given tracer, if not nil, as a child of the
+// span of the given context, which may be nil. Without a tracer, the context
+// is returned as is, with a span doing nothing.
+func startSpan(tracer Tracer, ctx context.Context, name string, attributes ...Attribute) (context.Context, Span) {
+	if tracer == nil {
+		return ctx, noSpan{}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return tracer.Start(ctx, name, attributes...)
+}
+
+// noSpan is a Span doing nothing.
+type noSpan struct{}
+
+func (noSpan) SetAttributes(...Attribute) {}
+func (noSpan) End(error)                  {}
@@ -0,0 +1,87 @@
+package fine_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+// recordingTracer is a fine.Tracer recording the ended spans, as their name,
+// parent, attributes and error.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []string
+}
+
+type spanKey struct{}
+
+type recordingSpan struct {
+	tracer     *recordingTracer
+	name       string
+	parent     string
+	attributes []string
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attributes ...fine.Attribute) (context.Context, fine.Span) {
+	span := &recordingSpan{tracer: t, name: name}
+	if parent, ok := ctx.Value(spanKey{}).(*recordingSpan); ok {
+		span.parent = parent.name
+	}
+	span.SetAttributes(attributes...)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (s *recordingSpan) SetAttributes(attributes ...fine.Attribute) {
+	for _, a := range attributes {
+		s.attributes = append(s.attributes, fmt.Sprintf("%s=%v", a.Key, a.Value))
+	}
+}
+
+func (s *recordingSpan) End(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, fmt.Sprintf(
+		"%s<%s [%s] %v", s.name, s.parent, strings.Join(s.attributes, " "), err,
+	))
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	var inner string
+	machine := fine.Machine("off", fine.States{
+		"off": {"toggle": "on"},
+		"on": {"toggle": "off", "@enter": func(m *fine.FSM, metadata fine.Metadata) {
+			inner = metadata.Context.Value(spanKey{}).(*recordingSpan).name
+		}},
+	}, fine.WithTracer(tracer))
+	machine.Subscribe(func(string) {})
+
+	// Test that an event gets a span, with the lifecycle actions and the
+	// subscribers as children.
+	machine.Do("toggle", 1, 2)
+	want := []string{
+		"fine.notify<fine.Do [fine.subscribers=1] <nil>",
+		"fine.lifecycle<fine.Do [fine.action=@enter fine.state=on] <nil>",
+		"fine.Do< [fine.event=toggle fine.from=off fine.args=2 fine.to=on] <nil>",
+	}
+	if got := strings.Join(tracer.spans, "\n"); got != strings.Join(want, "\n") {
+		t.Fatalf("wrong spans:\ngot  %q\nwant %q", tracer.spans, want)
+	}
+	if inner != "fine.lifecycle" {
+		t.Fatalf("wrong span in the lifecycle action: got %q", inner)
+	}
+
+	// Test that the span of a rejected event records the error, and is a
+	// child of the span of the context.
+	tracer.spans = nil
+	ctx, parent := tracer.Start(context.Background(), "request")
+	_, err := machine.DoContext(ctx, "missing")
+	parent.End(nil)
+	if len(tracer.spans) != 2 || !strings.HasPrefix(tracer.spans[0], "fine.Do<request ") || !strings.HasSuffix(tracer.spans[0], err.Error()) {
+		t.Fatalf("wrong spans: got %q", tracer.spans)
+	}
+}
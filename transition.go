@@ -0,0 +1,20 @@
+package fine
+
+// Transition is an action leading to the Target state, like a string action,
+// with an Action attached to the transition itself. The Action is executed
+// between the @exit lifecycle action of the previous state and the @enter one
+// of the new state, and receives the same Metadata. It is executed even when
+// the Target is the current state, in which case no lifecycle action is
+// executed at all.
+//
+// For example, the following action leads to the "on" state, logging the
+// transition after the "off" state is exited.
+//
+//	"switch": fine.Transition{
+//		Target: "on",
+//		Action: func(md fine.Metadata) { log.Printf("%s -> %s", md.From, md.To) },
+//	}
+type Transition struct {
+	Target string
+	Action func(Metadata)
+}
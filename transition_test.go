@@ -0,0 +1,48 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestTransition(t *testing.T) {
+	var events []string
+	effect := func(md fine.Metadata) {
+		events = append(events, "effect "+md.From+" -> "+md.To)
+	}
+	machine := fine.Machine("off", fine.States{
+		"off": {
+			"switch": fine.Transition{Target: "on", Action: effect},
+			"@exit":  func() { events = append(events, "@exit off") },
+		},
+		"on": {
+			"touch":  fine.Transition{Target: "on", Action: effect},
+			"@enter": func() { events = append(events, "@enter on") },
+		},
+	})
+
+	// Test that the transition action runs between @exit and @enter.
+	if state, err := machine.Do("switch"); err != nil || state != "on" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "on")
+	}
+	want := []string{"@exit off", "effect off -> on", "@enter on"}
+	if len(events) != len(want) {
+		t.Fatalf("wrong events: got %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("wrong events: got %v, want %v", events, want)
+		}
+	}
+
+	// Test that the transition action of a self-transition runs without any
+	// lifecycle action.
+	events = nil
+	if state, err := machine.Do("touch"); err != nil || state != "on" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "on")
+	}
+	if len(events) != 1 || events[0] != "effect on -> on" {
+		t.Fatalf("wrong events: got %v", events)
+	}
+}
@@ -0,0 +1,38 @@
+package fine
+
+import "errors"
+
+// TryDo executes the specified action as Do, unless another action is being
+// done on the FSM, such as with Do from another goroutine or from within the
+// transition in progress, or a batch of DoAll is running, or the mailbox of
+// the FSM is not empty, in which case it returns the current state right away,
+// without executing anything. The boolean reports whether the action was
+// executed, in which case the error is the one returned by Do.
+//
+// TryDo never queues the action: with WithRunToCompletion, it returns false
+// where Do would queue it, and with WithMailbox, it only hands the action to
+// the owner goroutine if the mailbox is empty, in which case the action is
+// still not executed if the owner goroutine finds another one in progress,
+// such as with Undo from another goroutine.
+//
+// This is meant for best-effort sources of events, such as user input, which
+// would rather drop an event than wait.
+func (m *FSM) TryDo(action string, args ...interface{}) (string, bool, error) {
+	e := pendingEvent{action: action, args: args, try: true}
+	var state string
+	var err error
+	if m.inbox != nil {
+		state, _, err = m.tryMail(e)
+	} else {
+		state, _, err = m.process(e)
+	}
+	if err == errBusy {
+		return state, false, nil
+	}
+	return state, true, err
+}
+
+// errBusy is returned for an event done with TryDo, by step if a transition
+// is in progress, by enqueue if it would be queued, and by tryMail if the
+// mailbox is not empty.
+var errBusy = errors.New("a transition is in progress")
@@ -0,0 +1,145 @@
+package fine_test
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestTryDo(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	machine := fine.Machine("a", fine.States{
+		"a": {"slow": func() string {
+			close(started)
+			<-release
+			return "b"
+		}},
+		"b": {"next": "c"},
+		"c": {},
+	})
+
+	// Test that nothing is executed while another action is being done.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		machine.Do("slow")
+	}()
+	<-started
+	if state, ok, err := machine.TryDo("next"); ok || err != nil || state != "a" {
+		t.Fatalf("wrong outcome: got %q, %v (%v), want %q, false", state, ok, err, "a")
+	}
+	close(release)
+	<-done
+
+	// Test that the action is executed otherwise.
+	if state, ok, err := machine.TryDo("next"); !ok || err != nil || state != "c" {
+		t.Fatalf("wrong outcome: got %q, %v (%v), want %q, true", state, ok, err, "c")
+	}
+	if _, ok, err := machine.TryDo("missing"); !ok || err == nil {
+		t.Fatalf("wrong outcome: got %v (%v), want true and an error", ok, err)
+	}
+
+	// Test that nothing is executed while a batch is in progress, even
+	// from within it.
+	machine = fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {"next": "a"},
+	})
+	var outcomes []bool
+	machine.Subscribe(func(state string) {
+		if state == "b" {
+			_, ok, _ := machine.TryDo("next")
+			outcomes = append(outcomes, ok)
+		}
+	})
+	if _, err := machine.DoAll("next", "next"); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if len(outcomes) != 1 || outcomes[0] {
+		t.Fatalf("wrong outcomes: got %v, want [false]", outcomes)
+	}
+
+	// Test that nothing is executed from within a transition.
+	outcomes = nil
+	machine.Do("next")
+	if len(outcomes) != 1 || outcomes[0] || machine.State() != "b" {
+		t.Fatalf("wrong outcomes: got %v in %q, want [false]", outcomes, machine.State())
+	}
+}
+
+// Test that with a mailbox nothing is executed while a transition is in
+// progress outside of the owner goroutine, such as one of Undo.
+func TestTryDoMailbox(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	undoing := false
+	machine := fine.Machine("a", fine.States{
+		"a": {
+			"@enter": func() {
+				if undoing {
+					close(entered)
+					<-release
+				}
+			},
+			"next": "b",
+		},
+		"b": {"next": "a"},
+	}, fine.WithMailbox(1), fine.WithUndo(1))
+	machine.Do("next")
+
+	undoing = true
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		machine.Undo()
+	}()
+	<-entered
+	if _, ok, err := machine.TryDo("next"); ok || err != nil {
+		t.Fatalf("wrong outcome: got %v (%v), want false", ok, err)
+	}
+	close(release)
+	<-done
+
+	if state, ok, err := machine.TryDo("next"); !ok || err != nil || state != "b" {
+		t.Fatalf("wrong outcome: got %q, %v (%v), want %q, true", state, ok, err, "b")
+	}
+}
+
+// Concurrency test (run with `-race`): test that with WithRunToCompletion an
+// action reported as executed is never only queued, as each executed action
+// reaches a new state.
+func TestTryDoRunToCompletion(t *testing.T) {
+	var n int32
+	states := fine.States{}
+	for i := 0; i <= concurrentRuns; i++ {
+		states[strconv.Itoa(i)] = fine.Transitions{
+			"next": func() string { return strconv.Itoa(int(atomic.AddInt32(&n, 1))) },
+		}
+	}
+	machine := fine.Machine("0", states, fine.WithRunToCompletion())
+
+	var mu sync.Mutex
+	reached := make(map[string]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			state, ok, err := machine.TryDo("next")
+			if !ok {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil || reached[state] {
+				t.Errorf("wrong outcome: got %q (%v), already reached", state, err)
+			}
+			reached[state] = true
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,213 @@
+package fine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// TypedFSM is an FSM whose states have the custom type S, such as an
+// enumeration, instead of string, so that misspelled states are caught at
+// compile time. It is a thin layer over an FSM, which can be retrieved with
+// Untyped for the features that are not typed.
+//
+// Internally, every state is named after its value, formatted as with
+// fmt.Sprint, so distinct states must have distinct formats.
+type TypedFSM[S comparable] struct {
+	m      *FSM
+	states namer[S]
+}
+
+// MachineOf instantiates a new TypedFSM with the given initial state and the
+// given set of possible states, similarly to Machine.
+//
+// In the given Transitions, a target state can be a value of type S, and a
+// function action can return a value of type S instead of a string, such as
+// func() S, func() (S, error) or
+// func(ctx context.Context, args ...interface{}) S. All the other action types
+// are the same as for Machine.
+//
+// Note: the given initial state must be within the given possible states.
+func MachineOf[S comparable](initial S, states map[S]Transitions, opts ...Option) *TypedFSM[S] {
+	t := &TypedFSM[S]{}
+	untyped := make(States, len(states))
+	for state, transitions := range states {
+		untyped[t.name(state)] = t.transitions(transitions)
+	}
+	if _, ok := states[initial]; !ok {
+		panic("the initial state must exist")
+	}
+	t.m = Machine(t.name(initial), untyped, opts...)
+
+	return t
+}
+
+// namer names the values of type T, formatting them as with fmt.Sprint, and
+// remembers them so that they can be retrieved by name.
+type namer[T comparable] struct {
+	mu     sync.RWMutex
+	names  map[T]string
+	values map[string]T
+}
+
+// name returns the name of the given value, registering it if needed. It
+// panics if another value has the same name.
+func (n *namer[T]) name(value T) string {
+	n.mu.RLock()
+	name, ok := n.names[value]
+	n.mu.RUnlock()
+	if ok {
+		return name
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	name = fmt.Sprint(value)
+	if other, ok := n.values[name]; ok && other != value {
+		panic(fmt.Sprintf("the values %#v and %#v have the same name %q", other, value, name))
+	}
+	if n.names == nil {
+		n.names = make(map[T]string)
+		n.values = make(map[string]T)
+	}
+	n.names[value] = name
+	n.values[name] = value
+	return name
+}
+
+// value returns the value with the given name, and whether it is known.
+func (n *namer[T]) value(name string) (T, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	value, ok := n.values[name]
+	return value, ok
+}
+
+// name returns the name of the given state.
+func (t *TypedFSM[S]) name(state S) string {
+	return t.states.name(state)
+}
+
+// value returns the state with the given name, and whether it is known.
+func (t *TypedFSM[S]) value(name string) (S, bool) {
+	return t.states.value(name)
+}
+
+// nameErr returns the name of the given state, along with the given error, as
+// returned by the typed actions that can fail.
+func (t *TypedFSM[S]) nameErr(state S, err error) (string, error) {
+	return t.name(state), err
+}
+
+// transitions returns the given typed transitions as untyped ones.
+func (t *TypedFSM[S]) transitions(transitions Transitions) Transitions {
+	untyped := make(Transitions, len(transitions))
+	for event, value := range transitions {
+		untyped[event] = t.action(value)
+	}
+	return untyped
+}
+
+// action returns the given typed action as an untyped one.
+func (t *TypedFSM[S]) action(value interface{}) interface{} {
+	switch next := value.(type) {
+	case S:
+		return t.name(next)
+	case func() S:
+		return func() string { return t.name(next()) }
+	case func(...interface{}) S:
+		return func(args ...interface{}) string { return t.name(next(args...)) }
+	case func(context.Context) S:
+		return func(ctx context.Context) string { return t.name(next(ctx)) }
+	case func(context.Context, ...interface{}) S:
+		return func(ctx context.Context, args ...interface{}) string {
+			return t.name(next(ctx, args...))
+		}
+	case func() (S, error):
+		return func() (string, error) { return t.nameErr(next()) }
+	case func(...interface{}) (S, error):
+		return func(args ...interface{}) (string, error) { return t.nameErr(next(args...)) }
+	case func(context.Context) (S, error):
+		return func(ctx context.Context) (string, error) { return t.nameErr(next(ctx)) }
+	case func(context.Context, ...interface{}) (S, error):
+		return func(ctx context.Context, args ...interface{}) (string, error) {
+			return t.nameErr(next(ctx, args...))
+		}
+	}
+	return value
+}
+
+// Untyped returns the underlying FSM, whose states are named after the values
+// of type S, formatted as with fmt.Sprint.
+func (t *TypedFSM[S]) Untyped() *FSM {
+	return t.m
+}
+
+// State returns the current state of the FSM.
+func (t *TypedFSM[S]) State() S {
+	state, _ := t.value(t.m.State())
+	return state
+}
+
+// States returns a slice with all the possible states of the FSM.
+//
+// Note: the order is not guaranteed.
+func (t *TypedFSM[S]) States() []S {
+	names := t.m.States()
+	states := make([]S, 0, len(names))
+	for _, name := range names {
+		if state, ok := t.value(name); ok {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+// Exists returns whether the specified state is a possible state for the FSM.
+func (t *TypedFSM[S]) Exists(state S) bool {
+	return t.m.Exists(t.name(state))
+}
+
+// Add behaves like the Add method of FSM, with typed transitions.
+func (t *TypedFSM[S]) Add(state S, transitions Transitions) error {
+	return t.m.Add(t.name(state), t.transitions(transitions))
+}
+
+// AddOrReplace behaves like the AddOrReplace method of FSM, with typed
+// transitions.
+func (t *TypedFSM[S]) AddOrReplace(state S, transitions Transitions) {
+	t.m.AddOrReplace(t.name(state), t.transitions(transitions))
+}
+
+// AddOrMerge behaves like the AddOrMerge method of FSM, with typed transitions.
+func (t *TypedFSM[S]) AddOrMerge(state S, transitions Transitions) {
+	t.m.AddOrMerge(t.name(state), t.transitions(transitions))
+}
+
+// Do behaves like the Do method of FSM, returning the typed state.
+func (t *TypedFSM[S]) Do(action string, args ...interface{}) (S, error) {
+	name, err := t.m.Do(action, args...)
+	state, _ := t.value(name)
+	return state, err
+}
+
+// DoContext behaves like the DoContext method of FSM, returning the typed
+// state.
+func (t *TypedFSM[S]) DoContext(ctx context.Context, action string, args ...interface{}) (S, error) {
+	name, err := t.m.DoContext(ctx, action, args...)
+	state, _ := t.value(name)
+	return state, err
+}
+
+// Subscribe behaves like the Subscribe method of FSM, with a callback
+// receiving the typed state. Changes to states that are not of type S, such
+// as the ones of embedded machines, are not notified.
+func (t *TypedFSM[S]) Subscribe(callback func(state S)) func() {
+	return t.m.Subscribe(func(name string) {
+		if state, ok := t.value(name); ok {
+			callback(state)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+type light int
+
+const (
+	off light = iota
+	on
+	broken
+)
+
+func (l light) String() string {
+	return [...]string{"off", "on", "broken"}[l]
+}
+
+func TestMachineOf(t *testing.T) {
+	machine := fine.MachineOf(off, map[light]fine.Transitions{
+		off: {"toggle": on},
+		on: {
+			"toggle": off,
+			"break":  func() light { return broken },
+		},
+	})
+	machine.Add(broken, fine.Transitions{"fix": off})
+
+	// Test that the states are typed.
+	if state := machine.State(); state != off {
+		t.Fatalf("wrong state: got %v, want %v", state, off)
+	}
+	var notified []light
+	machine.Subscribe(func(state light) {
+		notified = append(notified, state)
+	})
+	for _, tc := range []struct {
+		action string
+		want   light
+	}{
+		{"toggle", on},
+		{"break", broken},
+		{"fix", off},
+	} {
+		if state, err := machine.Do(tc.action); err != nil || state != tc.want {
+			t.Fatalf("wrong state: got %v (%v), want %v", state, err, tc.want)
+		}
+	}
+	if len(notified) != 4 || notified[2] != broken {
+		t.Fatalf("wrong notifications: got %v", notified)
+	}
+	if !machine.Exists(broken) || len(machine.States()) != 3 {
+		t.Fatalf("wrong states: got %v", machine.States())
+	}
+
+	// Test that the untyped FSM uses the formatted states.
+	if state := machine.Untyped().State(); state != "off" {
+		t.Fatalf("wrong state: got %q, want %q", state, "off")
+	}
+}
+
+type switchEvent string
+
+const (
+	toggle switchEvent = "toggle"
+	hit    switchEvent = "hit"
+)
+
+func TestMachineOfEvents(t *testing.T) {
+	entered := 0
+	machine := fine.MachineOfEvents(off, map[light]fine.EventTransitions[switchEvent]{
+		off: {toggle: on},
+		on: {
+			toggle: off,
+			hit:    func() light { return broken },
+		},
+		broken: {},
+	})
+	machine.SetLifecycle(broken, "@enter", func() { entered++ })
+
+	// Test that both states and events are typed.
+	for _, tc := range []struct {
+		event switchEvent
+		want  light
+	}{
+		{toggle, on},
+		{toggle, off},
+		{toggle, on},
+		{hit, broken},
+	} {
+		if state, err := machine.Do(tc.event); err != nil || state != tc.want {
+			t.Fatalf("wrong state: got %v (%v), want %v", state, err, tc.want)
+		}
+	}
+	if entered != 1 {
+		t.Fatalf("wrong number of @enter calls: got %d, want %d", entered, 1)
+	}
+
+	// Test that typed events can be added later.
+	machine.AddOrMerge(broken, fine.EventTransitions[switchEvent]{"fix": off})
+	if state, err := machine.Do("fix"); err != nil || state != off {
+		t.Fatalf("wrong state: got %v (%v), want %v", state, err, off)
+	}
+	if event := machine.Event(toggle); event != "toggle" {
+		t.Fatalf("wrong event: got %q, want %q", event, "toggle")
+	}
+}
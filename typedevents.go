@@ -0,0 +1,95 @@
+package fine
+
+import "context"
+
+// EventTransitions is a mapping between typed events and actions, as
+// Transitions is for string events. The possible types of the actions are
+// the same as for MachineOf. Lifecycle actions cannot be keyed by a typed
+// event: see the SetLifecycle method of TypedEventFSM.
+type EventTransitions[E comparable] map[E]interface{}
+
+// TypedEventFSM is an FSM whose states have the custom type S, as for
+// TypedFSM, and whose events have the custom type E, so that misspelled
+// events are caught at compile time too.
+//
+// Internally, every event is named after its value, formatted as with
+// fmt.Sprint, so distinct events must have distinct formats.
+type TypedEventFSM[S, E comparable] struct {
+	*TypedFSM[S]
+	events namer[E]
+}
+
+// MachineOfEvents instantiates a new TypedEventFSM with the given initial state
+// and the given set of possible states, similarly to MachineOf.
+//
+// Note: the given initial state must be within the given possible states.
+func MachineOfEvents[S, E comparable](initial S, states map[S]EventTransitions[E], opts ...Option) *TypedEventFSM[S, E] {
+	t := &TypedEventFSM[S, E]{TypedFSM: &TypedFSM[S]{}}
+	typed := make(map[S]Transitions, len(states))
+	for state, transitions := range states {
+		typed[state] = t.transitions(transitions)
+	}
+	if _, ok := states[initial]; !ok {
+		panic("the initial state must exist")
+	}
+	untyped := make(States, len(typed))
+	for state, transitions := range typed {
+		untyped[t.name(state)] = t.TypedFSM.transitions(transitions)
+	}
+	t.m = Machine(t.name(initial), untyped, opts...)
+
+	return t
+}
+
+// transitions returns the given transitions keyed by the event names.
+func (t *TypedEventFSM[S, E]) transitions(transitions EventTransitions[E]) Transitions {
+	named := make(Transitions, len(transitions))
+	for event, value := range transitions {
+		named[t.events.name(event)] = value
+	}
+	return named
+}
+
+// Event returns the name of the given event in the underlying FSM.
+func (t *TypedEventFSM[S, E]) Event(event E) string {
+	return t.events.name(event)
+}
+
+// Add behaves like the Add method of FSM, with typed transitions.
+func (t *TypedEventFSM[S, E]) Add(state S, transitions EventTransitions[E]) error {
+	return t.TypedFSM.Add(state, t.transitions(transitions))
+}
+
+// AddOrReplace behaves like the AddOrReplace method of FSM, with typed
+// transitions.
+func (t *TypedEventFSM[S, E]) AddOrReplace(state S, transitions EventTransitions[E]) {
+	t.TypedFSM.AddOrReplace(state, t.transitions(transitions))
+}
+
+// AddOrMerge behaves like the AddOrMerge method of FSM, with typed
+// transitions.
+func (t *TypedEventFSM[S, E]) AddOrMerge(state S, transitions EventTransitions[E]) {
+	t.TypedFSM.AddOrMerge(state, t.transitions(transitions))
+}
+
+// SetLifecycle sets the lifecycle action of the given state for the given
+// lifecycle event, which is either "@enter" or "@exit", replacing the previous
+// one. The possible types of the action are the same as for Machine.
+func (t *TypedEventFSM[S, E]) SetLifecycle(state S, lifecycle string, action interface{}) {
+	if lifecycle != "@enter" && lifecycle != "@exit" {
+		panic("the lifecycle event must be either @enter or @exit")
+	}
+	t.TypedFSM.AddOrMerge(state, Transitions{lifecycle: action})
+}
+
+// Do behaves like the Do method of FSM, with a typed event and returning the
+// typed state.
+func (t *TypedEventFSM[S, E]) Do(event E, args ...interface{}) (S, error) {
+	return t.TypedFSM.Do(t.events.name(event), args...)
+}
+
+// DoContext behaves like the DoContext method of FSM, with a typed event and
+// returning the typed state.
+func (t *TypedEventFSM[S, E]) DoContext(ctx context.Context, event E, args ...interface{}) (S, error) {
+	return t.TypedFSM.DoContext(ctx, t.events.name(event), args...)
+}
@@ -0,0 +1,92 @@
+package fine
+
+import "errors"
+
+// ErrNothingToUndo is returned by Undo when the journal of the FSM is empty.
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// undoEvent is the event of the transitions made by Undo.
+const undoEvent = "@undo"
+
+// WithUndo makes the FSM keep a journal of its last depth states, so that
+// Undo can return to them. Every state change is journaled, including the
+// ones of Reset and of the rollbacks of Atomic, except the ones made by Undo
+// itself. A non-positive depth disables the journal.
+func WithUndo(depth int) Option {
+	return func(m *FSM) {
+		m.undoDepth = depth
+	}
+}
+
+// Undo returns the FSM to the state it had before its last state change, as
+// recorded in the journal enabled with WithUndo, and returns that state. The
+// move is a full transition, whose event is "@undo": the @exit lifecycle action
+// of the current state runs, the subscribers are notified, and then the
+// @enter lifecycle action of the previous state runs, reversing the order in
+// which they ran when leaving it. Calling Undo repeatedly walks further back
+// through the journal.
+//
+// ErrNothingToUndo is returned, and nothing changes, if the journal is empty,
+// and ErrClosed if the FSM is closed.
+func (m *FSM) Undo() (string, error) {
+	held := m.tmu.lock()
+	defer m.tmu.unlock(held)
+
+	m.mu.Lock()
+	current := m.current
+	switch {
+	case m.closed:
+		m.mu.Unlock()
+		return current, ErrClosed
+	case len(m.journal) == 0:
+		m.mu.Unlock()
+		return current, ErrNothingToUndo
+	}
+	previous := m.journal[len(m.journal)-1]
+	metadata := Metadata{From: current, To: previous, Event: undoEvent}
+	m.journal = m.journal[:len(m.journal)-1]
+	m.mu.Unlock()
+
+	if err := m.writeAhead(metadata); err != nil {
+		m.mu.Lock()
+		m.journal = append(m.journal, previous)
+		m.mu.Unlock()
+		return current, err
+	}
+
+	m.transition(metadata, held)
+	m.reportWAL(m.writeDone(metadata))
+	return previous, nil
+}
+
+// journalize records the current state in the journal, if enabled, before it
+// changes to the given one as the outcome of the given event. The oldest
+// entry is dropped when the journal is full. The caller must hold m.mu for
+// writing.
+func (m *FSM) journalize(event, state string) {
+	if m.undoDepth <= 0 || event == undoEvent || state == m.current {
+		return
+	}
+	if len(m.journal) == m.undoDepth {
+		copy(m.journal, m.journal[1:])
+		m.journal = m.journal[:len(m.journal)-1]
+	}
+	m.journal = append(m.journal, m.current)
+}
+
+// pruneJournal removes the given state from the journal, merging the entries
+// that become adjacent, and the last ones if they become the current state, so
+// that Undo only returns to existing states. The caller must hold m.mu for
+// writing.
+func (m *FSM) pruneJournal(state string) {
+	journal := m.journal[:0]
+	for _, name := range m.journal {
+		if name != state && (len(journal) == 0 || journal[len(journal)-1] != name) {
+			journal = append(journal, name)
+		}
+	}
+	for len(journal) > 0 && journal[len(journal)-1] == m.current {
+		journal = journal[:len(journal)-1]
+	}
+	m.journal = journal
+}
@@ -0,0 +1,169 @@
+package fine_test
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestUndo(t *testing.T) {
+	var trace []string
+	lifecycle := func(state string) fine.Transitions {
+		return fine.Transitions{
+			"@enter": func(md fine.Metadata) {
+				trace = append(trace, "enter "+state+" on "+md.Event)
+			},
+			"@exit": func(md fine.Metadata) {
+				trace = append(trace, "exit "+state+" on "+md.Event)
+			},
+		}
+	}
+	states := fine.States{
+		"name":    lifecycle("name"),
+		"address": lifecycle("address"),
+		"confirm": lifecycle("confirm"),
+	}
+	states["name"]["next"] = "address"
+	states["address"]["next"] = "confirm"
+	m := fine.Machine("name", states, fine.WithUndo(10))
+
+	// Test that undoing with an empty journal fails.
+	if _, err := m.Undo(); !errors.Is(err, fine.ErrNothingToUndo) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrNothingToUndo)
+	}
+
+	m.Do("next")
+	m.Do("next")
+
+	// Test that undoing walks back the journal, running the lifecycle actions
+	// in reverse order.
+	trace = nil
+	for _, want := range []string{"address", "name"} {
+		state, err := m.Undo()
+		if err != nil {
+			t.Fatalf("no error expected, got: %v", err)
+		}
+		if state != want || m.State() != want {
+			t.Fatalf("wrong state: got %q (%v), want %q", m.State(), state, want)
+		}
+	}
+	want := []string{
+		"exit confirm on @undo", "enter address on @undo",
+		"exit address on @undo", "enter name on @undo",
+	}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("wrong trace: got %v, want %v", trace, want)
+	}
+
+	// Test that undoing is not journaled itself.
+	if _, err := m.Undo(); !errors.Is(err, fine.ErrNothingToUndo) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrNothingToUndo)
+	}
+}
+
+func TestUndoDepth(t *testing.T) {
+	m := fine.Machine("0", fine.States{
+		"0": {"next": "1"},
+		"1": {"next": "2"},
+		"2": {"next": "3"},
+		"3": {},
+	}, fine.WithUndo(2))
+	m.Do("next")
+	m.Do("next")
+	m.Do("next")
+
+	// Test that only the last states are journaled.
+	for _, want := range []string{"2", "1"} {
+		if state, err := m.Undo(); err != nil || state != want {
+			t.Fatalf("wrong undo: got (%q, %v), want (%q, <nil>)", state, err, want)
+		}
+	}
+	if _, err := m.Undo(); !errors.Is(err, fine.ErrNothingToUndo) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrNothingToUndo)
+	}
+
+	// Test that without a journal nothing can be undone.
+	m = fine.Machine("0", fine.States{"0": {"next": "1"}, "1": {}})
+	m.Do("next")
+	if _, err := m.Undo(); !errors.Is(err, fine.ErrNothingToUndo) {
+		t.Fatalf("wrong error: got %v, want %v", err, fine.ErrNothingToUndo)
+	}
+}
+
+func TestUndoRenameRemove(t *testing.T) {
+	newMachine := func(events ...string) *fine.FSM {
+		m := fine.Machine("a", fine.States{
+			"a": {"next": "b"},
+			"b": {"next": "c"},
+			"c": {"next": "d", "back": "b"},
+			"d": {},
+		}, fine.WithUndo(10))
+		for _, event := range events {
+			m.Do(event)
+		}
+		return m
+	}
+	undo := func(m *fine.FSM, states ...string) {
+		for _, want := range states {
+			if state, err := m.Undo(); err != nil || state != want || m.State() != want {
+				t.Fatalf("wrong undo: got (%q, %v), want (%q, <nil>)", state, err, want)
+			}
+		}
+		if _, err := m.Undo(); !errors.Is(err, fine.ErrNothingToUndo) {
+			t.Fatalf("wrong error: got %v, want %v", err, fine.ErrNothingToUndo)
+		}
+	}
+
+	// Test that the journal follows a renamed state.
+	m := newMachine("next", "next")
+	if err := m.Rename("b", "bee"); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	undo(m, "bee", "a")
+
+	// Test that a removed state is skipped by Undo.
+	m = newMachine("next", "next", "next")
+	if err := m.Remove("c"); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	undo(m, "b", "a")
+
+	// Test that the entries left adjacent to each other, or to the current
+	// state, by a removal are merged.
+	m = newMachine("next", "next", "back", "next", "next")
+	if err := m.Remove("c"); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	undo(m, "b", "a")
+	m = newMachine("next", "next", "back")
+	if err := m.Remove("c"); err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	undo(m, "a")
+}
+
+// Concurrency test (run with `-race`): test that concurrent Do and Undo calls
+// do not race.
+func TestUndoConcurrent(t *testing.T) {
+	m := fine.Machine("off", fine.States{
+		"off": {"toggle": "on"},
+		"on":  {"toggle": "off"},
+	}, fine.WithUndo(5))
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRuns; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			m.Do("toggle")
+		}()
+		go func() {
+			defer wg.Done()
+			m.Undo()
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,58 @@
+package fine
+
+// UnknownEvent is the key of the fallback action of a state, which handles
+// all the events that the state does not handle otherwise, neither with its
+// own transitions nor with global ones. It can have any of the types of a
+// regular action, and it receives the arguments of the unknown event. For
+// example, the following fallback action redirects all the unknown events to
+// the "error" state.
+//
+//	fine.UnknownEvent: "error"
+//
+// A global fallback action can be added with AddGlobal too, and it applies to
+// the states that do not have their own one. The fallback action cannot be
+// done directly.
+const UnknownEvent = "@unknown"
+
+// resolve returns the action handling the given event from the given state,
+// as lookup does, falling back to the fallback action.
+func resolve(s, global *state, event string) (action, bool) {
+	if a, ok := lookup(s, global, event); ok {
+		return a, true
+	}
+	return lookup(s, global, UnknownEvent)
+}
+
+// OnUnhandled registers a hook that is called whenever an event that is not
+// handled by the current state is done, that is when Do returns an error
+// because the action is not valid. The hook receives the metadata of the
+// rejected event, whose To field is empty. Multiple hooks can be registered,
+// and they run in registration order, without holding any lock.
+//
+// Events handled by a fallback action are not reported: see UnknownEvent.
+func (m *FSM) OnUnhandled(hook func(metadata Metadata)) {
+	m.mu.Lock()
+	m.unhandledHooks = append(m.unhandledHooks, hook)
+	m.mu.Unlock()
+}
+
+// OnRejected registers a hook that is called with the event, the current
+// state and the arguments of every event that is not handled by the current
+// state, as OnUnhandled does.
+func (m *FSM) OnRejected(hook func(event string, state string, args []interface{})) {
+	m.OnUnhandled(func(metadata Metadata) {
+		hook(metadata.Event, metadata.From, metadata.Args)
+	})
+}
+
+// unhandled passes the given unhandled event to all the hooks registered with
+// OnUnhandled.
+func (m *FSM) unhandled(metadata Metadata) {
+	m.mu.RLock()
+	hooks := m.unhandledHooks
+	m.mu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(metadata)
+	}
+}
@@ -0,0 +1,79 @@
+package fine_test
+
+import (
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestUnknownEvent(t *testing.T) {
+	var unknown []interface{}
+	machine := fine.Machine("idle", fine.States{
+		"idle": {
+			"start": "running",
+			fine.UnknownEvent: func(args ...interface{}) string {
+				unknown = append(unknown, args...)
+				return "error"
+			},
+		},
+		"running": {"stop": "idle"},
+		"error":   {"reset": "idle"},
+	})
+
+	var unhandled []string
+	machine.OnUnhandled(func(metadata fine.Metadata) {
+		unhandled = append(unhandled, metadata.From+" "+metadata.Event)
+	})
+
+	// Test that the fallback action handles the unknown events.
+	if state, err := machine.Do("jump", 42); err != nil || state != "error" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "error")
+	}
+	if len(unknown) != 1 || unknown[0] != 42 {
+		t.Fatalf("wrong arguments: got %v, want %v", unknown, []interface{}{42})
+	}
+	if e := machine.Explain("reset"); e.Mechanism != "transition" {
+		t.Fatalf("wrong explanation: got %+v", e)
+	}
+
+	// Test that the hooks receive the unhandled events.
+	if _, err := machine.Do("jump"); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+	if len(unhandled) != 1 || unhandled[0] != "error jump" {
+		t.Fatalf("wrong unhandled events: got %v", unhandled)
+	}
+
+	// Test that a global fallback action applies to the other states.
+	machine.AddGlobal(fine.UnknownEvent, nil)
+	if state, err := machine.Do("jump"); err != nil || state != "error" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "error")
+	}
+	if e := machine.Explain("jump"); e.Mechanism != "global fallback" {
+		t.Fatalf("wrong explanation: got %+v", e)
+	}
+	machine.Do("reset")
+	if e := machine.Explain("jump"); e.Mechanism != "fallback" || e.Target != "" {
+		t.Fatalf("wrong explanation: got %+v", e)
+	}
+
+	// Test that the fallback action cannot be done directly.
+	if _, err := machine.Do(fine.UnknownEvent); err == nil {
+		t.Fatal("error expected, got <nil>")
+	}
+	if len(unhandled) != 1 {
+		t.Fatalf("wrong unhandled events: got %v", unhandled)
+	}
+
+	// Test that the hooks registered with OnRejected receive the unhandled
+	// events too.
+	machine = fine.Machine("error", fine.States{"error": {"reset": "idle"}})
+	var rejected []interface{}
+	machine.OnRejected(func(event string, state string, args []interface{}) {
+		rejected = append(rejected, event, state, args)
+	})
+	machine.Do("jump", 1)
+	if len(rejected) != 3 || rejected[0] != "jump" || rejected[1] != "error" || rejected[2].([]interface{})[0] != 1 {
+		t.Fatalf("wrong rejected events: got %v", rejected)
+	}
+}
@@ -0,0 +1,93 @@
+package fine
+
+import "fmt"
+
+// Validate checks the machine definition made of the given initial state and
+// states, as accepted by Machine, reporting every problem that would otherwise
+// only show up while doing events, or not at all:
+//
+//   - the initial state not being among the states;
+//   - actions with an invalid type, which panic when dispatched;
+//   - static targets, such as the ones of string actions, that are not among
+//     the states;
+//   - states that are not reachable from the initial state.
+//
+// The errors are sorted by state, and nil is returned for a valid definition.
+//
+// Note: since the targets of function actions are not known statically, the
+// unreachable states are only reported if no function action is reachable
+// from the initial state, as it could lead to any state.
+func Validate(initialState string, states States) []error {
+	compiled := make(stateTable, len(states))
+	for name, transitions := range states {
+		compiled[name] = compileState(name, transitions)
+	}
+	return validate(initialState, compiled, nil, func(a, b string) bool { return a < b })
+}
+
+// Validate checks the current definition of the FSM, including its global
+// transitions, as the Validate function does, sorting the states in the order
+// given to MachineOrdered, if any.
+func (m *FSM) Validate() []error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return validate(m.initial, m.table(), m.global.Load(), m.stateLess())
+}
+
+// validate checks the given states and global transitions, which may be nil,
+// sorting the states with the given function.
+func validate(initial string, states stateTable, global *state, less func(a, b string) bool) []error {
+	var errs []error
+	if _, ok := states[initial]; !ok {
+		errs = append(errs, fmt.Errorf("the initial state %q is not among the states", initial))
+	}
+
+	d := describe(initial, initial, states, global, less)
+	reachable := d.reachable(initial)
+	dynamic := false
+	for name := range reachable {
+		for _, s := range []*state{states[name], global} {
+			if s != nil && s.dynamic() {
+				dynamic = true
+			}
+		}
+	}
+
+	edges := d.edges
+	for _, name := range d.states {
+		for _, event := range sortedKeys(states[name].transitions) {
+			if !validAction(event, states[name].transitions[event]) {
+				errs = append(errs, badActionType(event, name))
+			}
+		}
+		for ; len(edges) > 0 && edges[0].from == name; edges = edges[1:] {
+			if _, ok := states[edges[0].to]; !edges[0].dynamic && !ok {
+				errs = append(errs, fmt.Errorf(
+					"action %q on state %q leads to the missing state %q",
+					edges[0].event, name, edges[0].to,
+				))
+			}
+		}
+		if len(reachable) > 0 && !reachable[name] && !dynamic {
+			errs = append(errs, fmt.Errorf(
+				"state %q is unreachable from the initial state %q", name, initial,
+			))
+		}
+	}
+
+	return errs
+}
+
+// dynamic reports whether the state has any valid action whose target is not
+// known statically.
+func (s *state) dynamic() bool {
+	for _, a := range s.actions {
+		switch a.kind {
+		case kindNil, kindTarget, kindDispatch, kindInvalid:
+		default:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package fine_test
+
+import (
+	"errors"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestValidate(t *testing.T) {
+	// Test that a valid definition has no errors.
+	states := fine.States{
+		"idle":    {"start": "running"},
+		"running": {"stop": "idle", "@enter": func() {}},
+	}
+	if errs := fine.Validate("idle", states); errs != nil {
+		t.Fatalf("no errors expected, got: %v", errs)
+	}
+
+	// Test that every problem is reported, sorted by state.
+	states = fine.States{
+		"idle":    {"start": "running", "crash": "broken", "pause": 42},
+		"running": {"stop": "idle"},
+		"orphan":  {"adopt": "idle"},
+	}
+	want := []string{
+		`invalid action type for action "pause" on state "idle"`,
+		`action "crash" on state "idle" leads to the missing state "broken"`,
+		`state "orphan" is unreachable from the initial state "idle"`,
+	}
+	errs := fine.Validate("idle", states)
+	if len(errs) != len(want) {
+		t.Fatalf("wrong errors: got %v, want %v", errs, want)
+	}
+	for i, err := range errs {
+		if err.Error() != want[i] {
+			t.Fatalf("wrong error %d: got %q, want %q", i, err, want[i])
+		}
+	}
+	if !errors.Is(errs[0], fine.ErrBadActionType) {
+		t.Fatalf("wrong error: got %v, want %v", errs[0], fine.ErrBadActionType)
+	}
+
+	// Test that a missing initial state is reported.
+	if errs := fine.Validate("missing", states); len(errs) == 0 || errs[0].Error() != `the initial state "missing" is not among the states` {
+		t.Fatalf("wrong errors: got %v", errs)
+	}
+
+	// Test that unreachable states are not reported when a function action
+	// could lead to them.
+	states = fine.States{
+		"idle":   {"start": func() string { return "hidden" }},
+		"hidden": {},
+	}
+	if errs := fine.Validate("idle", states); errs != nil {
+		t.Fatalf("no errors expected, got: %v", errs)
+	}
+}
+
+func TestValidateMachine(t *testing.T) {
+	m := fine.Machine("idle", fine.States{
+		"idle":    {"start": "running"},
+		"running": {},
+	})
+
+	// Test that the states added later are validated too.
+	m.AddOrReplace("running", fine.Transitions{"fail": "failed"})
+	m.AddOrReplace("lost", fine.Transitions{})
+	errs := m.Validate()
+	if len(errs) != 2 {
+		t.Fatalf("wrong errors: got %v, want 2", errs)
+	}
+}
@@ -0,0 +1,167 @@
+package fine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The operations of the entries of a write-ahead log.
+const (
+	walBegin = "begin"
+	walEnd   = "end"
+)
+
+// walEntry is an entry of a write-ahead log, written as a line of JSON.
+type walEntry struct {
+	Op string `json:"op"`
+	LogEntry
+}
+
+// WithWAL makes the FSM write every state change to the given write-ahead log,
+// as a line of JSON, and again once the transition completed, after the @enter
+// lifecycle action. The first entry is written once the action of the event
+// ran and chose the new state, but before the state changes: before the @exit
+// lifecycle action, the action attached to the transition, and anything else
+// the transition executes. If w has a Sync method, such as *os.File, it is
+// called after every write, so that each entry reaches stable storage before
+// the FSM goes on. RecoverWAL reads the log back.
+//
+// The entries are written holding the transition lock, so that they are in
+// the order of the transitions, but not the lock guarding the state, so that
+// State, and the other methods only reading the FSM, do not wait for them.
+//
+// If the first entry cannot be written, Do and Undo return an error wrapping
+// the one of the writer, and the state does not change. The other errors, and
+// the ones of Reset and of the rollbacks of Atomic, which cannot fail, are
+// reported to the hooks registered with OnError.
+//
+// Clones do not inherit the log, since their entries would be interleaved
+// with the ones of this FSM.
+func WithWAL(w io.Writer) Option {
+	return func(m *FSM) {
+		m.wal = w
+	}
+}
+
+// writeWAL writes the given operation on the given transition to the
+// write-ahead log, if any, syncing it if possible.
+func (m *FSM) writeWAL(op string, metadata Metadata) error {
+	if m.wal == nil {
+		return nil
+	}
+	data, err := json.Marshal(walEntry{Op: op, LogEntry: LogEntry{
+		From:  metadata.From,
+		To:    metadata.To,
+		Event: metadata.Event,
+		Args:  metadata.Args,
+		Time:  m.clock.Now(),
+	}})
+	if err != nil {
+		return fmt.Errorf("writing ahead %q: %w", metadata.Event, err)
+	}
+
+	m.walMu.Lock()
+	defer m.walMu.Unlock()
+
+	if _, err := m.wal.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("writing ahead %q: %w", metadata.Event, err)
+	}
+	if s, ok := m.wal.(interface{ Sync() error }); ok {
+		if err := s.Sync(); err != nil {
+			return fmt.Errorf("writing ahead %q: %w", metadata.Event, err)
+		}
+	}
+	return nil
+}
+
+// writeAhead writes the beginning of the given transition to the write-ahead
+// log, if any.
+func (m *FSM) writeAhead(metadata Metadata) error {
+	return m.writeWAL(walBegin, metadata)
+}
+
+// writeDone writes the completion of the given transition to the write-ahead
+// log, if any.
+func (m *FSM) writeDone(metadata Metadata) error {
+	return m.writeWAL(walEnd, metadata)
+}
+
+// reportWAL reports the given error of the write-ahead log, if any, to the
+// hooks registered with OnError.
+func (m *FSM) reportWAL(err error) {
+	if err != nil {
+		m.report(err)
+	}
+}
+
+// RecoverWAL instantiates a new FSM from the given Definition, recovering it
+// from the given write-ahead log, as written by an FSM of the same Definition
+// created with WithWAL. The FSM is in the state the last completed transition
+// entered, without executing its @enter lifecycle action again, and with its
+// timeouts started anew, as for Restore.
+//
+// If the last transition did not complete, because the process stopped in the
+// middle of it, the FSM is put in the state it was leaving, and the whole
+// transition is executed again, with its lifecycle actions and the action
+// attached to it, so that every side effect runs at least once. The arguments
+// of the event are the ones decoded from JSON. A truncated last entry, as left
+// by an interrupted write, is ignored.
+//
+// A non-nil error is returned if the log cannot be read or is empty, or if any
+// state of its entries is not within the states of the Definition.
+func RecoverWAL(d *Definition, r io.Reader) (*FSM, error) {
+	var state string
+	var pending *walEntry
+	found := false
+	decoder := json.NewDecoder(r)
+	for {
+		var e walEntry
+		err := decoder.Decode(&e)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range []string{e.From, e.To} {
+			if _, ok := d.states[s]; !ok {
+				return nil, fmt.Errorf("the state %q is not in the definition", s)
+			}
+		}
+		found = true
+		switch e.Op {
+		case walBegin:
+			state, pending = e.From, &e
+		case walEnd:
+			state, pending = e.To, nil
+		default:
+			return nil, fmt.Errorf("unknown operation %q", e.Op)
+		}
+	}
+	if !found {
+		return nil, errors.New("the write-ahead log is empty")
+	}
+
+	m := d.instance(state)
+	m.mu.Lock()
+	m.scheduleTimeouts()
+	m.mu.Unlock()
+	if pending == nil {
+		return m, nil
+	}
+
+	// Execute the incomplete transition again, with the action attached to
+	// it, if its event is not a pseudo-event.
+	metadata := Metadata{From: pending.From, To: pending.To, Event: pending.Event, Args: pending.Args}
+	if next, ok := resolve(m.table()[pending.From], m.global.Load(), pending.Event); ok {
+		metadata.effect, metadata.history = next.effect, next.history
+	}
+	if err := m.writeAhead(metadata); err != nil {
+		return nil, err
+	}
+	m.transition(metadata, nil)
+	m.reportWAL(m.writeDone(metadata))
+	return m, nil
+}
@@ -0,0 +1,136 @@
+package fine_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+// failingWriter is an io.Writer failing every write.
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestWAL(t *testing.T) {
+	var wal bytes.Buffer
+	var charged, shipped int
+	d, err := fine.Define(fine.States{
+		"cart":    {"pay": fine.Transition{Target: "paid", Action: func(fine.Metadata) { charged++ }}},
+		"paid":    {"ship": "shipped", "@exit": func() { shipped++ }},
+		"shipped": {},
+	}, fine.WithWAL(&wal))
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	m := d.NewInstance("cart")
+	m.Do("pay")
+	m.Do("ship")
+
+	// Test that every transition is written when it begins and ends.
+	lines := strings.Split(strings.TrimSpace(wal.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[0], `"op":"begin"`) || !strings.Contains(lines[3], `"op":"end"`) {
+		t.Fatalf("wrong WAL: got %q", lines)
+	}
+
+	// Test that the FSM recovers from a complete log without executing
+	// anything.
+	charged, shipped = 0, 0
+	recovered, err := fine.RecoverWAL(d, strings.NewReader(wal.String()))
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if state := recovered.State(); state != "shipped" {
+		t.Fatalf("wrong state: got %q, want %q", state, "shipped")
+	}
+	if charged != 0 || shipped != 0 {
+		t.Fatalf("wrong actions: got %d charges and %d shipments, want none", charged, shipped)
+	}
+
+	// Test that an incomplete transition is executed again, ignoring a
+	// truncated entry.
+	incomplete := lines[0] + "\n" + lines[1][:len(lines[1])/2]
+	recovered, err = fine.RecoverWAL(d, strings.NewReader(incomplete))
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if state := recovered.State(); state != "paid" {
+		t.Fatalf("wrong state: got %q, want %q", state, "paid")
+	}
+	if charged != 1 {
+		t.Fatalf("wrong charges: got %d, want 1", charged)
+	}
+	incomplete = strings.Join(lines[:3], "\n")
+	if recovered, _ := fine.RecoverWAL(d, strings.NewReader(incomplete)); recovered.State() != "shipped" || shipped != 1 {
+		t.Fatalf("wrong recovery: got %q with %d shipments", recovered.State(), shipped)
+	}
+
+	// Test that empty and malformed logs cannot be recovered.
+	if _, err := fine.RecoverWAL(d, strings.NewReader("")); err == nil {
+		t.Fatalf("error expected for an empty log")
+	}
+	if _, err := fine.RecoverWAL(d, strings.NewReader(`{"op":"begin","from":"cart","to":"lost"}`)); err == nil {
+		t.Fatalf("error expected for an unknown state")
+	}
+}
+
+func TestWALError(t *testing.T) {
+	writeErr := errors.New("disk full")
+	d, err := fine.Define(fine.States{
+		"on":  {"toggle": "off"},
+		"off": {"toggle": "on"},
+	}, fine.WithWAL(failingWriter{writeErr}))
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	m := d.NewInstance("on")
+
+	// Test that the state does not change if the WAL cannot be written.
+	if _, err := m.Do("toggle"); !errors.Is(err, writeErr) {
+		t.Fatalf("wrong error: got %v, want %v", err, writeErr)
+	}
+	if state := m.State(); state != "on" {
+		t.Fatalf("wrong state: got %q, want %q", state, "on")
+	}
+}
+
+// blockingWriter blocks every write until it is released.
+type blockingWriter struct {
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.writing <- struct{}{}
+	<-w.release
+	return len(p), nil
+}
+
+// Test that writing the log, even on the fast path of an unobserved FSM, does
+// not block the readers of the state.
+func TestWALBlocking(t *testing.T) {
+	w := &blockingWriter{writing: make(chan struct{}), release: make(chan struct{})}
+	m := fine.Machine("a", fine.States{
+		"a": {"next": "b"},
+		"b": {},
+	}, fine.WithWAL(w))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Do("next")
+	}()
+	<-w.writing
+	if state := m.State(); state != "a" {
+		t.Fatalf("wrong state: got %q, want %q", state, "a")
+	}
+	w.release <- struct{}{}
+	<-w.writing
+	if state := m.State(); state != "b" {
+		t.Fatalf("wrong state: got %q, want %q", state, "b")
+	}
+	w.release <- struct{}{}
+	<-done
+}
@@ -0,0 +1,231 @@
+package fine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// xstateMachine is the subset of the XState machine configuration supported
+// by ExportXState and MachineFromXState.
+type xstateMachine struct {
+	ID      string                 `json:"id,omitempty"`
+	Initial string                 `json:"initial"`
+	States  map[string]xstateState `json:"states"`
+}
+
+// xstateState is a state of an XState machine configuration, whose
+// transitions are kept raw, since they come in several forms.
+type xstateState struct {
+	Type   string                     `json:"type,omitempty"`
+	On     map[string]json.RawMessage `json:"on,omitempty"`
+	States json.RawMessage            `json:"states,omitempty"`
+}
+
+// xstateTransition is an object transition of an XState machine
+// configuration. Guards are named "guard" by XState 5, and "cond" before.
+type xstateTransition struct {
+	Target  string          `json:"target,omitempty"`
+	Guard   string          `json:"guard,omitempty"`
+	Cond    string          `json:"cond,omitempty"`
+	Actions json.RawMessage `json:"actions,omitempty"`
+}
+
+// guard returns the name of the guard of the transition, if any.
+func (t xstateTransition) guard() (string, error) {
+	if t.Guard != "" && t.Cond != "" {
+		return "", errors.New("both guard and cond are set")
+	}
+	return t.Guard + t.Cond, nil
+}
+
+// ExportXState returns the JSON configuration of an XState machine with the
+// given id, describing the FSM, so that it can be edited with the Stately
+// visual editor, and read back with MachineFromXState. Every state is a
+// top-level state, final states have the "final" type, and every transition
+// is an entry of the "on" object of its state, with the event as key:
+//
+//   - string actions, and nil ones, are targets;
+//   - Dispatch actions are lists of transitions, guarded by their keys, except
+//     the DispatchDefault entry, which is the last unguarded one;
+//   - function actions, whose target is not known statically, are transitions
+//     with no target, and an action named after the event.
+//
+// Lifecycle actions, and the actions attached to Transition values, are not
+// exported, since XState can only reference them by name.
+func (m *FSM) ExportXState(id string) string {
+	d := m.describe()
+	finals := make(map[string]bool)
+	m.readStates(func(states stateTable) {
+		for name, s := range states {
+			if s.final {
+				finals[name] = true
+			}
+		}
+	})
+
+	type transition struct {
+		Target  string   `json:"target,omitempty"`
+		Guard   string   `json:"guard,omitempty"`
+		Actions []string `json:"actions,omitempty"`
+	}
+	type state struct {
+		Type string                 `json:"type,omitempty"`
+		On   map[string]interface{} `json:"on,omitempty"`
+	}
+	config := struct {
+		ID      string           `json:"id,omitempty"`
+		Initial string           `json:"initial"`
+		States  map[string]state `json:"states"`
+	}{ID: id, Initial: d.initial, States: make(map[string]state, len(d.states))}
+
+	for _, name := range d.states {
+		s := state{On: make(map[string]interface{})}
+		if finals[name] {
+			s.Type = "final"
+		}
+		config.States[name] = s
+	}
+	for _, e := range d.edges {
+		on := config.States[e.from].On
+		switch {
+		case e.dynamic:
+			on[e.event] = transition{Actions: []string{e.event}}
+		case e.branch != "":
+			// The edges are sorted by branch, so the default one is moved to
+			// the end, where XState expects the unguarded transition.
+			branches, _ := on[e.event].([]transition)
+			t := transition{Target: e.to, Guard: e.branch}
+			if e.branch == DispatchDefault {
+				t.Guard = ""
+			}
+			if n := len(branches); n > 0 && branches[n-1].Guard == "" {
+				branches = append(branches[:n-1], t, branches[n-1])
+			} else {
+				branches = append(branches, t)
+			}
+			on[e.event] = branches
+		default:
+			on[e.event] = e.to
+		}
+	}
+
+	data, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		// Only strings are marshaled, which cannot fail.
+		panic(err)
+	}
+	return string(data) + "\n"
+}
+
+// MachineFromXState instantiates a new FSM from the JSON configuration of an
+// XState machine, starting from its initial state, so that the output of
+// ExportXState can be read back. The supported subset is made of top-level
+// states, possibly of the "final" type, whose transitions are:
+//
+//   - target strings, or objects with a target, which become string actions;
+//   - objects with no target, which become nil actions, ignoring their
+//     actions;
+//   - lists of objects guarded by a "guard" or "cond" name, plus an optional
+//     unguarded last one, which become Dispatch actions keyed by the guard
+//     names, so that the guard is the first argument of Do.
+//
+// Since functions cannot be carried over, the resulting FSM is meant as a
+// skeleton, that can be completed in code with AddOrMerge, as for
+// MachineFromDOT.
+//
+// A non-nil error is returned if the configuration cannot be parsed, uses any
+// unsupported feature, such as nested states, or if the initial state or any
+// target is not among the states.
+func MachineFromXState(data []byte) (*FSM, error) {
+	var config xstateMachine
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	states := make(States, len(config.States))
+	for _, name := range sortedKeys(config.States) {
+		s := config.States[name]
+		if len(s.States) > 0 {
+			return nil, fmt.Errorf("nested states of state %q are not supported", name)
+		}
+		transitions := make(Transitions, len(s.On))
+		switch s.Type {
+		case "", "atomic":
+		case "final":
+			transitions[Final] = true
+		default:
+			return nil, fmt.Errorf("unsupported type %q of state %q", s.Type, name)
+		}
+		for _, event := range sortedKeys(s.On) {
+			action, err := xstateAction(s.On[event])
+			if err != nil {
+				return nil, fmt.Errorf("transition %q of state %q: %w", event, name, err)
+			}
+			transitions[event] = action
+		}
+		states[name] = transitions
+	}
+	if _, ok := states[config.Initial]; !ok {
+		return nil, fmt.Errorf("the initial state %q is not among the states", config.Initial)
+	}
+
+	d, err := Define(states)
+	if err != nil {
+		return nil, err
+	}
+	return d.NewInstance(config.Initial), nil
+}
+
+// xstateAction returns the action of the given XState transition.
+func xstateAction(raw json.RawMessage) (interface{}, error) {
+	raw = bytes.TrimSpace(raw)
+	switch {
+	case len(raw) == 0:
+		return nil, errors.New("empty transition")
+	case raw[0] == '"':
+		var target string
+		err := json.Unmarshal(raw, &target)
+		return target, err
+	case raw[0] == '{':
+		var t xstateTransition
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return nil, err
+		}
+		guard, err := t.guard()
+		switch {
+		case err != nil:
+			return nil, err
+		case guard != "":
+			return Dispatch{guard: t.Target}, nil
+		case t.Target == "":
+			return nil, nil
+		}
+		return t.Target, nil
+	case raw[0] != '[':
+		return nil, fmt.Errorf("unsupported transition %s", raw)
+	}
+
+	var branches []xstateTransition
+	if err := json.Unmarshal(raw, &branches); err != nil {
+		return nil, err
+	}
+	dispatch := make(Dispatch, len(branches))
+	for i, t := range branches {
+		guard, err := t.guard()
+		switch {
+		case err != nil:
+			return nil, err
+		case guard == "" && i < len(branches)-1:
+			return nil, errors.New("only the last transition can be unguarded")
+		case guard == "":
+			guard = DispatchDefault
+		}
+		if t.Target == "" {
+			return nil, errors.New("guarded transitions with no target are not supported")
+		}
+		dispatch[guard] = t.Target
+	}
+	return dispatch, nil
+}
@@ -0,0 +1,92 @@
+package fine_test
+
+import (
+	"strings"
+	"testing"
+
+	"interrato.dev/fine"
+)
+
+func TestXState(t *testing.T) {
+	machine := fine.Machine("idle", fine.States{
+		"idle": {
+			"start":  "running",
+			"signal": fine.Dispatch{"red": "stopped", "green": "running", fine.DispatchDefault: "idle"},
+		},
+		"running": {"stop": "stopped", "tick": func() {}},
+		"stopped": {fine.Final: true},
+	})
+
+	// Test that the export is read back as the same FSM, except for the
+	// function actions.
+	exported := machine.ExportXState("traffic")
+	imported, err := fine.MachineFromXState([]byte(exported))
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if got := imported.ExportXState("traffic"); got == exported {
+		t.Fatalf("function action exported as a target: %s", got)
+	}
+	if state, err := imported.Do("signal", "green"); err != nil || state != "running" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "running")
+	}
+	if state, err := imported.Do("tick"); err != nil || state != "running" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "running")
+	}
+	if state, err := imported.Do("stop"); err != nil || state != "stopped" {
+		t.Fatalf("wrong state: got %q (%v), want %q", state, err, "stopped")
+	}
+	if !strings.Contains(exported, `"type": "final"`) {
+		t.Fatalf("final state not exported: %s", exported)
+	}
+	again, err := fine.MachineFromXState([]byte(imported.ExportXState("traffic")))
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	if got, want := again.ExportXState("traffic"), imported.ExportXState("traffic"); got != want {
+		t.Fatalf("wrong round trip: got %s, want %s", got, want)
+	}
+
+	// Test that XState 4 configurations are supported.
+	v4 := `{
+		"id": "light",
+		"initial": "green",
+		"states": {
+			"green": {"on": {"TIMER": {"target": "yellow", "actions": ["log"]}}},
+			"yellow": {"on": {"TIMER": [{"target": "red", "cond": "night"}, {"target": "green"}]}},
+			"red": {"on": {"TIMER": "green", "WAIT": {}}}
+		}
+	}`
+	light, err := fine.MachineFromXState([]byte(v4))
+	if err != nil {
+		t.Fatalf("no error expected, got: %v", err)
+	}
+	for _, step := range []struct {
+		event string
+		args  []interface{}
+		want  string
+	}{
+		{"TIMER", nil, "yellow"},
+		{"TIMER", []interface{}{"night"}, "red"},
+		{"WAIT", nil, "red"},
+		{"TIMER", nil, "green"},
+	} {
+		if state, err := light.Do(step.event, step.args...); err != nil || state != step.want {
+			t.Fatalf("wrong state: got %q (%v), want %q", state, err, step.want)
+		}
+	}
+
+	// Test that unsupported configurations are rejected.
+	for _, config := range []string{
+		`{"initial": "a", "states": {"a": {"states": {"b": {}}}}}`,
+		`{"initial": "a", "states": {"a": {"type": "parallel"}}}`,
+		`{"initial": "a", "states": {"a": {"on": {"go": "b"}}}}`,
+		`{"initial": "b", "states": {"a": {}}}`,
+		`{"initial": "a", "states": {"a": {"on": {"go": [{"target": "a"}, {"target": "a", "guard": "g"}]}}}}`,
+		`{"initial": "a", "states": {"a": {"on": {"go": 42}}}}`,
+	} {
+		if _, err := fine.MachineFromXState([]byte(config)); err == nil {
+			t.Fatalf("error expected for %s", config)
+		}
+	}
+}